@@ -0,0 +1,137 @@
+// File: "admin.go"
+
+package xlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Состояние уровней журналирования для LevelHandler
+type adminLevels struct {
+	Level      string            `json:"level"`                // спецификация уровней
+	Escalation string            `json:"escalation,omitempty"` // временный уровень
+	Until      *time.Time        `json:"until,omitempty"`      // срок временного уровня
+	Loggers    map[string]string `json:"loggers,omitempty"`    // уровни Named логгеров
+}
+
+// checkLevelSpec проверяет спецификацию уровней журналирования
+// (неизвестные имена уровней - ошибка)
+func checkLevelSpec(spec string) error {
+	if _, _, _, err := ParseLevelSpec(spec); err != nil {
+		return err
+	}
+	for _, item := range strings.Split(spec, ",") {
+		if _, lvl, ok := strings.Cut(item, "="); ok {
+			item = lvl
+		}
+		if item = strings.TrimSpace(item); item != "" {
+			if _, ok := lookupLevel(item); !ok {
+				return fmt.Errorf("unknown level %q", item)
+			}
+		}
+	}
+	return nil
+}
+
+// LevelHandler возвращает HTTP хендлер для управления уровнями
+// журналирования логгера во время работы (например, на служебном порту):
+//
+//	GET                         - текущее состояние (JSON)
+//	POST level=debug            - изменить уровень (допускается спецификация
+//	                              уровней вида "info,db=trace", см. SetLvl)
+//	POST level=debug&for=10m    - временно изменить уровень (см. SetLevelFor)
+//	POST name=db&level=trace    - задать уровень Named логгера "db"
+//	DELETE                      - восстановить уровень (см. RestoreLevel)
+//	DELETE name=db              - сбросить уровень Named логгера "db"
+//
+// Параметры передаются в строке запроса или в теле формы.
+// Неизвестный уровень отклоняется (400), изменяются только существующие
+// Named логгеры (404 для неизвестного имени).
+func LevelHandler(log *Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name, level := r.Form.Get("name"), r.Form.Get("level")
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+
+		case http.MethodPost, http.MethodPut:
+			if level == "" {
+				http.Error(w, "level required", http.StatusBadRequest)
+				return
+			}
+			if name != "" || r.Form.Get("for") != "" { // один уровень
+				if _, ok := lookupLevel(strings.TrimSpace(level)); !ok {
+					http.Error(w, fmt.Sprintf("unknown level %q", level), http.StatusBadRequest)
+					return
+				}
+			} else if err := checkLevelSpec(level); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if name != "" { // уровень Named логгера
+				node := LoggerByName(name)
+				if node == nil {
+					http.Error(w, "unknown logger", http.StatusNotFound)
+					return
+				}
+				node.SetLvl(strings.TrimSpace(level))
+				break
+			}
+			if v := r.Form.Get("for"); v != "" { // временное изменение
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					http.Error(w, "bad duration", http.StatusBadRequest)
+					return
+				}
+				log.SetLvlFor(level, d)
+				break
+			}
+			if err := log.SetLevelSpec(level); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+		case http.MethodDelete:
+			if name != "" {
+				node := LoggerByName(name)
+				if node == nil {
+					http.Error(w, "unknown logger", http.StatusNotFound)
+					return
+				}
+				node.ResetLevel()
+				break
+			}
+			log.RestoreLevel()
+
+		default:
+			w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		} // switch
+
+		state := adminLevels{Level: log.GetLevelSpec()}
+		if lvl, until, ok := log.Escalation(); ok {
+			state.Escalation, state.Until = LevelToString(lvl), &until
+		}
+		for _, node := range Loggers() {
+			if node.IsSet() {
+				if state.Loggers == nil {
+					state.Loggers = map[string]string{}
+				}
+				state.Loggers[node.Name()] = node.GetLvl()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(state)
+	})
+}
+
+// EOF: "admin.go"
@@ -51,6 +51,7 @@ const (
 const (
 	ansiTime   = ansiYellow    // метка времени
 	ansiSource = ansiMagenta   // ссылка на исходные тексты
+	ansiName   = ansiBlue      // имя логгера (атрибут "logger")
 	ansiKey    = ansiCyan      // ключ атрибута
 	ansiErrKey = ansiRed       // ключ ошибки (err)
 	ansiErrVal = ansiBrightRed // текст ошибки
@@ -3,6 +3,7 @@
 package xlog
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log/slog" // go>=1.21
@@ -38,7 +39,14 @@ type ChecksumRes struct {
 	Source    map[string]any // ссылка на исходные тексты (если есть)
 	Message   string         // сообщение журнала
 	Goroutine int            // идентификатор горутины (если есть)
-	LogId     uuid.UUID      // идентификатор записи в журнале
+	Chain     string         // имя цепочки контрольных сумм (если есть)
+	TraceId   string         // идентификатор трассировки W3C (если есть)
+	SpanId    string         // идентификатор span'а W3C (если есть)
+	LogId     uuid.UUID      // идентификатор записи в журнале (если UUID)
+	Id        string         // идентификатор записи в журнале (как есть)
+	IdKind    string         // формат идентификатора записи ("uuid", "ulid", ...)
+	IdRaw     []byte         // бинарное представление идентификатора записи
+	IdTime    time.Time      // метка времени из идентификатора записи (если есть)
 	Err       string         // ошибка в сообщении с ключом "err"
 	LogSum    uint16         // контрольная сумма извлеченная их журнала
 	Sum       uint16         // контрольная сумма вычисленная
@@ -62,11 +70,35 @@ var crcTable = crc16.MakeTable(crc16.CRC16_XMODEM)
 func Checksum(
 	sum uint16, full, timeOn bool, r slog.Record, logId uuid.UUID) uint16 {
 
+	return ChecksumId(sum, full, timeOn, r, uuidSumData(logId))
+}
+
+// ChecksumId вычисляет контрольную сумму записи в журнале аналогично
+// функции Checksum(), но для идентификатора записи произвольного формата
+// (см. IdGenerator).
+//
+//	sum - значение контрольной суммы предыдущей записи или 0
+//	full - признак для вычисления контрольной суммы по всем атрибутам рекурсивно
+//	timeOn - включить в расчет CRC метку времени
+//	r - подготовленная для выдачи в slog-журнал запись
+//	id - учитываемая в КС часть идентификатора записи или nil
+func ChecksumId(
+	sum uint16, full, timeOn bool, r slog.Record, id []byte) uint16 {
+
 	if !full {
-		return ChecksumSimple(sum, timeOn, r, logId)
+		return checksumSimple(sum, timeOn, r, id)
 	} else {
-		return ChecksumFull(sum, timeOn, r, logId)
+		return checksumFull(sum, timeOn, r, id)
+	}
+}
+
+// uuidSumData возвращает учитываемую в КС часть UUID (старшие 14 байт)
+// или nil для нулевого UUID
+func uuidSumData(logId uuid.UUID) []byte {
+	if logId.IsNil() {
+		return nil
 	}
+	return logId[:14]
 }
 
 // ChecksumSimple вычисляет контрольную сумму (CRC16) записи в журнале.
@@ -87,6 +119,14 @@ func Checksum(
 func ChecksumSimple(
 	sum uint16, timeOn bool, r slog.Record, logId uuid.UUID) uint16 {
 
+	return checksumSimple(sum, timeOn, r, uuidSumData(logId))
+}
+
+// checksumSimple - реализация ChecksumSimple() для идентификатора
+// произвольного формата (id - учитываемая в КС часть или nil)
+func checksumSimple(
+	sum uint16, timeOn bool, r slog.Record, id []byte) uint16 {
+
 	// Сформировать буфер "sync pool" для сбора данны для CRC
 	buf := newBuffer()
 	defer buf.Free()
@@ -102,9 +142,9 @@ func ChecksumSimple(
 	// Учесть в CRC текст сообщения
 	buf.WriteString(r.Message)
 
-	if !logId.IsNil() {
-		// Учесть в CRC первые (старшие) 14 байт UUID идентификатора
-		*buf = append(*buf, logId[0:14]...)
+	if len(id) != 0 {
+		// Учесть в CRC идентификатор (для UUID первые/старшие 14 байт)
+		*buf = append(*buf, id...)
 	}
 
 	// Учесть к CRC ошибки "err", если они есть в атрибутах
@@ -150,6 +190,14 @@ func ChecksumSimple(
 func ChecksumFull(
 	sum uint16, timeOn bool, r slog.Record, logId uuid.UUID) uint16 {
 
+	return checksumFull(sum, timeOn, r, uuidSumData(logId))
+}
+
+// checksumFull - реализация ChecksumFull() для идентификатора
+// произвольного формата (id - учитываемая в КС часть или nil)
+func checksumFull(
+	sum uint16, timeOn bool, r slog.Record, id []byte) uint16 {
+
 	if timeOn {
 		// Учесть в контрольной сумме метку времени как строку в формате RFC3339Milli
 		sum ^= ChecksumAttr(TimeKey, r.Time.UTC().Format(RFC3339Milli))
@@ -167,9 +215,9 @@ func ChecksumFull(
 		return true
 	})
 
-	if !logId.IsNil() {
-		// Учесть в КС первые (старшие) 15 байт UUID идентификатора
-		sum ^= ChecksumAttr(IdKey, logId[:14])
+	if len(id) != 0 {
+		// Учесть в КС идентификатор (для UUID первые/старшие 14 байт)
+		sum ^= ChecksumAttr(IdKey, id)
 	}
 
 	return sum
@@ -432,6 +480,14 @@ func ChecksumVerifySimple(rec map[string]any) (ChecksumRes, error) {
 				continue
 			}
 		}
+
+		if k == ChainKey { // "logChain"
+			if val, ok := v.(string); ok {
+				res.Chain = val
+			}
+		}
+
+		res.parseTrace(k, v)
 	} // for k, v
 
 	// Учесть в CRC уровень журналирования как строку
@@ -460,18 +516,20 @@ func ChecksumVerifySimple(rec map[string]any) (ChecksumRes, error) {
 		}
 	} // for k, v
 
-	// Учесть в CRC первые (старшие) 14 байт UUID идентификатора
+	// Учесть в CRC идентификатор (для UUID первые/старшие 14 байт)
+	var gen IdGenerator
+	var id []byte
 	for k, v := range rec {
 		if k == IdKey { // "logId"
 			val, ok := v.(string)
 			if ok && len(val) > 0 {
-				id, err := uuid.FromString(val)
+				var err error
+				gen, id, err = res.parseId(val)
 				if err == nil {
-					res.LogId = id
-					*buf = append(*buf, id[0:14]...)
+					*buf = append(*buf, idSumData(gen, id)...)
 					continue
 				}
-				return res, fmt.Errorf("can't parse logId (UUID): %w", err)
+				return res, err
 			}
 		}
 	} // for k, v
@@ -493,22 +551,7 @@ func ChecksumVerifySimple(rec map[string]any) (ChecksumRes, error) {
 	// Вычислить CRC16
 	res.Sum = crc16.Checksum(*buf, crcTable)
 
-	if res.LogId.IsNil() && logSum == "" {
-		return res, fmt.Errorf("logId and logSum are nil both")
-	}
-
-	if logSum != "" { // найден отдельный атрибут "logSum"
-		sum, err := strconv.ParseInt(logSum, 16, 0)
-		if err != nil {
-			return res, fmt.Errorf("can't parse logSum: %w", err)
-		}
-		res.LogSum = uint16(sum)
-	} else { // извлечь контрольную сумму из "logId"
-		res.LogSum = uint16(res.LogId[14]) << 8
-		res.LogSum |= uint16(res.LogId[15])
-	}
-
-	return res, nil
+	return res, res.parseSum(logSum, gen, id)
 }
 
 // ChecksumVerifyFull производит вычисление контрольной суммы JSON записи
@@ -529,6 +572,8 @@ func ChecksumVerifyFull(rec map[string]any) (ChecksumRes, error) {
 		Sum:    uint16(0),
 	}
 	logSum := ""
+	var gen IdGenerator
+	var id []byte
 
 	for k, v := range rec {
 		if k == TimeKey { // "time"
@@ -572,6 +617,14 @@ func ChecksumVerifyFull(rec map[string]any) (ChecksumRes, error) {
 			return res, fmt.Errorf("msg is not string: type=%t", v)
 		}
 
+		if k == ChainKey { // "logChain" (в КС входит как обычный атрибут)
+			if val, ok := v.(string); ok {
+				res.Chain = val
+			}
+		}
+
+		res.parseTrace(k, v) // "trace_id", "span_id" (входят в КС)
+
 		if k == GoKey { // "goroutine"
 			switch id := v.(type) {
 			case int:
@@ -587,13 +640,13 @@ func ChecksumVerifyFull(rec map[string]any) (ChecksumRes, error) {
 		if k == IdKey { // "logId"
 			val, ok := v.(string)
 			if ok && len(val) > 0 {
-				id, err := uuid.FromString(val)
+				var err error
+				gen, id, err = res.parseId(val)
 				if err == nil {
-					res.LogId = id
-					res.Sum ^= ChecksumAttr(IdKey, id[:14])
+					res.Sum ^= ChecksumAttr(IdKey, idSumData(gen, id))
 					continue
 				}
-				return res, fmt.Errorf("can't parse logId (UUID): %w", err)
+				return res, err
 			}
 		}
 
@@ -608,22 +661,94 @@ func ChecksumVerifyFull(rec map[string]any) (ChecksumRes, error) {
 		res.Sum ^= ChecksumAttr(k, v)
 	} // for k, v
 
-	if res.LogId.IsNil() && logSum == "" {
-		return res, fmt.Errorf("logId and logSum are nil both")
+	return res, res.parseSum(logSum, gen, id)
+}
+
+// parseTrace заполняет поля TraceId и SpanId структуры ChecksumRes
+func (res *ChecksumRes) parseTrace(k string, v any) {
+	val, _ := v.(string)
+	switch k {
+	case TraceIdKey: // "trace_id"
+		res.TraceId = val
+	case SpanIdKey: // "span_id"
+		res.SpanId = val
 	}
+}
+
+// parseId распознаёт идентификатор записи в журнале (logId) и заполняет
+// поля Id, IdKind и LogId (для UUID) структуры ChecksumRes
+func (res *ChecksumRes) parseId(val string) (IdGenerator, []byte, error) {
+	gen, id, err := ParseLogId(val)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't parse logId: %w", err)
+	}
+	res.Id = val
+	res.IdKind = gen.Kind()
+	res.IdRaw = id
+	res.IdTime = gen.Time(id)
+	if gen.Kind() == IdFormatUUID {
+		res.LogId, _ = uuid.FromBytes(id)
+	}
+	return gen, id, nil
+}
 
+// IdDrift возвращает расхождение метки времени из идентификатора записи
+// и метки времени записи (Time). Если одна из меток отсутствует, то
+// возвращается 0. Расхождение может быть полезно для выявления подмены
+// идентификаторов или проблем с системными часами.
+func (res ChecksumRes) IdDrift() time.Duration {
+	if res.IdTime.IsZero() || res.Time.IsZero() {
+		return 0
+	}
+	return res.IdTime.Sub(res.Time)
+}
+
+// IdLess проверяет, что идентификатор записи строго больше идентификатора
+// предыдущей записи prev (в том же формате). Упакованная в идентификатор
+// контрольная сумма при сравнении не учитывается.
+// Проверка имеет смысл только для монотонных форматов идентификаторов
+// ("uuid", "snowflake", "counter"), см. IdMonotonic().
+func (prev ChecksumRes) IdLess(res ChecksumRes) bool {
+	if prev.IdKind != res.IdKind || len(prev.IdRaw) != len(res.IdRaw) {
+		return false
+	}
+	gen := idParser(res.IdKind)
+	if gen == nil {
+		return false
+	}
+	return bytes.Compare(idSumData(gen, prev.IdRaw), idSumData(gen, res.IdRaw)) < 0
+}
+
+// IdMonotonic возвращает признак того, что формат идентификатора записи
+// гарантирует его строгое монотонное возрастание в пределах процесса
+func (res ChecksumRes) IdMonotonic() bool {
+	return res.IdKind == IdFormatUUID || res.IdKind == IdFormatSnowflake
+}
+
+// parseSum заполняет поле LogSum структуры ChecksumRes из отдельного
+// атрибута "logSum" или извлекает КС из идентификатора записи "logId"
+// (если формат идентификатора предусматривает упаковку КС)
+func (res *ChecksumRes) parseSum(logSum string, gen IdGenerator, id []byte) error {
 	if logSum != "" { // найден отдельный атрибут "logSum"
 		sum, err := strconv.ParseInt(logSum, 16, 0)
 		if err != nil {
-			return res, fmt.Errorf("can't parse logSum: %w", err)
+			return fmt.Errorf("can't parse logSum: %w", err)
 		}
 		res.LogSum = uint16(sum)
-	} else { // извлечь контрольную сумму из "logId"
-		res.LogSum = uint16(res.LogId[14]) << 8
-		res.LogSum |= uint16(res.LogId[15])
+		return nil
+	}
+
+	if gen == nil {
+		return fmt.Errorf("logId and logSum are nil both")
+	}
+
+	if !gen.Embed() {
+		return fmt.Errorf("logSum not found (logId format %q has no sum)", gen.Kind())
 	}
 
-	return res, nil
+	// Извлечь контрольную сумму из "logId"
+	res.LogSum = idGetSum(id)
+	return nil
 }
 
 // SourceToString - преобразуем map/JSON представление ссылки на исходные тексты
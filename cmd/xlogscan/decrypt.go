@@ -0,0 +1,69 @@
+// File: "decrypt.go"
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/azorg/xlog"
+)
+
+// Расшифровать зашифрованные значения атрибутов журнала (enc:<keyId>:...)
+// и вывести журнал в stdout (формат строк журнала сохраняется)
+//
+//	logConf - конфигурация логгера
+//	opt - опции командной строки (ключи расшифровки, файл журнала)
+func decryptFields(logConf xlog.Conf, opt *Opt) {
+	// Сделать вывод журнала "человеческим" (ничего лишнего),
+	// stdout занят расшифрованным журналом
+	logConf.IdOn = false
+	logConf.SumOn = false
+	logConf.GoId = false
+	if logConf.File == "" {
+		logConf.Pipe = "stderr"
+	}
+	xlog.Setup(logConf)
+
+	dec := xlog.NewFieldDecryptor()
+	for _, spec := range strings.Split(opt.FieldKeys, ",") {
+		key, err := xlog.ParseFieldKey(spec)
+		if err != nil {
+			xlog.Fatal("bad -field-key option (use keyId:type:hex)", "err", err)
+		}
+		if key.Secret == nil && key.Private == nil {
+			xlog.Fatal("-field-key: private key required", "keyId", key.Id)
+		}
+		dec.AddKey(key)
+	}
+
+	file := os.Stdin
+	if opt.File != "" {
+		var err error
+		file, err = os.Open(opt.File)
+		if err != nil {
+			xlog.Fatal("can't open log file", "err", err, "file", opt.File)
+		}
+		defer file.Close()
+	}
+
+	lines, cnt := 0, 0 // счётчики строк и расшифрованных значений
+	out := bufio.NewWriter(os.Stdout)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line, n := dec.DecryptText(scanner.Text())
+		fmt.Fprintln(out, line)
+		lines++
+		cnt += n
+	}
+	out.Flush()
+	if err := scanner.Err(); err != nil {
+		xlog.Crit("can't read log file", "err", err, "file", opt.File)
+	}
+	xlog.Info("decrypt fields finished", "file", opt.File, "lines", lines, "decrypted", cnt)
+}
+
+// EOF: "decrypt.go"
@@ -5,6 +5,7 @@ package main
 import (
   "flag"
   "os"
+  "time"
 	
 	"github.com/azorg/xlog"
 	"github.com/azorg/xlog/signal"
@@ -12,8 +13,13 @@ import (
 
 // Опции командной строки
 type Opt struct {
-	File  string   // входной файл журнала
-  Chain bool     // признак обработки цепочки
+	File  string        // входной файл журнала
+  Chain bool          // признак обработки цепочки
+  ChainName string    // имя проверяемой цепочки (по умолчанию все)
+  Drift time.Duration // допустимое расхождение метки времени logId и time
+  Levels string       // пользовательские уровни журналирования
+  PseudoKey string    // ключ псевдонимизации ("keyId:hex")
+  FieldKeys string    // ключи расшифровки атрибутов ("keyId:type:hex,...")
 }
 
 func main() {
@@ -43,10 +49,20 @@ func main() {
   opt := &Opt{}
 	flag.StringVar(&opt.File, "file", "", "Input log file (use stdin by default)")
 	flag.BoolVar(&opt.Chain, "chain", false, "Check chain")
+	flag.StringVar(&opt.ChainName, "chain-name", "", "Check only named chain (all chains by default)")
+	flag.DurationVar(&opt.Drift, "drift", time.Second, "Max logId/time drift (0 - off)")
+	flag.StringVar(&opt.Levels, "levels", "", "Custom log levels (e.g. \"audit=6:AUDIT,security=11\")")
+	flag.StringVar(&opt.PseudoKey, "pseudo-key", "", "Pseudonymization key (keyId:hex)")
+	flag.StringVar(&opt.FieldKeys, "field-key", "", "Field decryption keys (keyId:aes|x25519:hex,...)")
   
   logOpt := xlog.NewOpt()
   flag.Parse()
 
+	// Зарегистрировать пользовательские уровни (до настройки логгера)
+	if err := xlog.RegisterLevels(opt.Levels); err != nil {
+		xlog.Fatal("bad -levels option", "err", err)
+	}
+
 	// Добавить настройки логгера, заданные в командной строке
 	logOpt.UpdateConf(&logConf)
 
@@ -90,16 +106,20 @@ func main() {
 	argc := len(args)
 
 	if argc == 0 {
-    scan(logConf, opt.File, opt.Chain)
+    scan(logConf, opt)
 		return
 	}
 	
   cmd := args[0] // argc != 0
 	switch cmd {
 	case "scan":
-    scan(logConf, opt.File, opt.Chain)
+    scan(logConf, opt)
   case "test":
     test(logConf)
+  case "pseudo":
+    pseudo(logConf, opt, args[1:])
+  case "decrypt-fields":
+    decryptFields(logConf, opt)
   default:
 		xlog.Fatal("Unknown command (run with --help option)", "cmd", cmd)
 	} // switch
@@ -0,0 +1,70 @@
+// File: "pseudo.go"
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/azorg/xlog"
+)
+
+// Вычислить токены псевдонимизации заданных значений (расследование
+// инцидентов) и, если задан файл журнала, вывести записи с этими токенами
+//
+//	logConf - конфигурация логгера
+//	opt - опции командной строки (ключ псевдонимизации, файл журнала)
+//	values - исходные значения (email, телефон, имя пользователя, ...)
+func pseudo(logConf xlog.Conf, opt *Opt, values []string) {
+	// Сделать вывод журнала "человеческим" (ничего лишнего)
+	logConf.IdOn = false
+	logConf.SumOn = false
+	logConf.GoId = false
+	xlog.Setup(logConf)
+
+	keyId, key, err := xlog.ParsePseudoKey(opt.PseudoKey)
+	if err != nil {
+		xlog.Fatal("bad -pseudo-key option (use keyId:hex)", "err", err)
+	}
+	if len(values) == 0 {
+		xlog.Fatal("no values to pseudonymize (xlogscan -pseudo-key id:hex pseudo <value>...)")
+	}
+
+	tokens := make([]string, 0, len(values))
+	for _, value := range values {
+		token := xlog.PseudoToken(keyId, key, value)
+		tokens = append(tokens, token)
+		xlog.Info("pseudo token", "keyId", keyId, "value", value, "token", token)
+	}
+
+	if opt.File == "" {
+		return
+	}
+	file, err := os.Open(opt.File)
+	if err != nil {
+		xlog.Fatal("can't open log file", "err", err, "file", opt.File)
+	}
+	defer file.Close()
+
+	cnt := 0 // счётчик найденных записей
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, token := range tokens {
+			if strings.Contains(line, token) {
+				fmt.Println(line)
+				cnt++
+				break
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		xlog.Crit("can't read log file", "err", err, "file", opt.File)
+	}
+	xlog.Info("pseudo lookup finished", "file", opt.File, "found", cnt)
+}
+
+// EOF: "pseudo.go"
@@ -14,9 +14,12 @@ import (
 // Сканировать файл журнала с целью проверки контрольных сумм
 //
 //  logConf - конфигурация логгера
-//  fileName - имя файла сканируемого журнала (по умолчанию stdin)
-//  sumChain - признак обработки цепочек
-func scan(logConf xlog.Conf, fileName string, sumChain bool) {
+//  opt - опции командной строки (файл журнала, признак обработки цепочек,
+//        имя проверяемой цепочки, допустимое расхождение метки времени
+//        logId и time)
+func scan(logConf xlog.Conf, opt *Opt) {
+  fileName, sumChain := opt.File, opt.Chain
+
   // Сделать вывод журнала "человеческим" (ничего лишнего)
   logConf.IdOn = false
   logConf.SumOn = false
@@ -24,7 +27,8 @@ func scan(logConf xlog.Conf, fileName string, sumChain bool) {
 	xlog.Setup(logConf)
 
   xlog.Info("start scan", "app", APP_NAME, "version", Version,
-    xlog.String("file", fileName), "chain", sumChain)
+    xlog.String("file", fileName), "chain", sumChain,
+    xlog.String("chainName", opt.ChainName), "drift", opt.Drift)
 
   file := os.Stdin
   if fileName != "" {
@@ -36,10 +40,13 @@ func scan(logConf xlog.Conf, fileName string, sumChain bool) {
     }
   }
 
-  sum := uint16(0)
+  sums := map[string]uint16{} // контрольные суммы цепочек по именам
   dec := json.NewDecoder(file)
   recCnt := int64(0) // счетчик записей
   errCnt := int64(0) // счетчик ошибок
+  driftCnt := int64(0) // счетчик расхождений метки времени logId и time
+  orderCnt := int64(0) // счетчик нарушений монотонности logId
+  prevs := map[string]xlog.ChecksumRes{} // предыдущие записи цепочек по именам
 
   for dec.More() {
     // Распарсить JSON запись журнала
@@ -53,12 +60,11 @@ func scan(logConf xlog.Conf, fileName string, sumChain bool) {
 
     // Распарсить запись и вычислить контрольную сумму
     res, err := xlog.ChecksumVerify(logConf.SumFull, rec)
+    if opt.ChainName != "" && res.Chain != opt.ChainName {
+      continue // проверять только заданную цепочку
+    }
     recCnt++
 
-		logId := ""
-		if !res.LogId.IsNil() {
-			logId = res.LogId.String()
-		}
 
 		resTime := ""
     if !res.Time.IsZero() {
@@ -71,7 +77,19 @@ func scan(logConf xlog.Conf, fileName string, sumChain bool) {
       "level", xlog.LevelToLabel(res.Level),
       "msg", res.Message,
       xlog.Int(xlog.GoKey, res.Goroutine),
-      xlog.String("logId", logId))
+      xlog.String("logId", res.Id))
+
+    if res.IdKind != "" && res.IdKind != xlog.IdFormatUUID {
+      log = log.With("idKind", res.IdKind)
+    }
+
+    if res.Chain != "" {
+      log = log.With("chain", res.Chain)
+    }
+
+    if res.TraceId != "" {
+      log = log.With("traceId", res.TraceId, "spanId", res.SpanId)
+    }
 
     if len(res.Source) != 0 {
       log = log.With("source", res.SourceToString())
@@ -83,6 +101,30 @@ func scan(logConf xlog.Conf, fileName string, sumChain bool) {
       continue
     }
 
+    if opt.Drift > 0 {
+      // Сравнить метку времени из logId с меткой времени записи
+      if drift := res.IdDrift(); drift > opt.Drift || drift < -opt.Drift {
+        driftCnt++
+        log.Warn("logId time drift", "drift", drift,
+          "idTime", res.IdTime.UTC().Format(time.RFC3339Nano),
+          "driftCnt", driftCnt)
+      }
+    }
+
+    if sumChain && res.IdMonotonic() {
+      // Идентификаторы монотонного формата должны строго возрастать
+      // в пределах цепочки (порядок вывода записей упорядочен только
+      // при SumChain, без него записи разных горутин могут меняться местами)
+      prev, ok := prevs[res.Chain]
+      if ok && prev.IdKind == res.IdKind && !prev.IdLess(res) {
+        orderCnt++
+        log.Warn("non-monotonic logId", "prevLogId", prev.Id,
+          "orderCnt", orderCnt)
+      }
+      prevs[res.Chain] = res
+    }
+
+    sum := sums[res.Chain] // каждая цепочка проверяется независимо
     if res.Sum ^ sum != res.LogSum {
       errCnt++
       log.Error("bad log check sum",
@@ -91,7 +133,7 @@ func scan(logConf xlog.Conf, fileName string, sumChain bool) {
         "errCnt", errCnt)
       
       if sumChain { // пропробовать выполнить коррекцию
-        sum = res.LogSum
+        sums[res.Chain] = res.LogSum
       }
     } else {
       log.Trace("scan record",
@@ -99,12 +141,13 @@ func scan(logConf xlog.Conf, fileName string, sumChain bool) {
         "sum", fmt.Sprintf("%04x", res.Sum ^ sum))
     
       if sumChain {
-        sum = res.LogSum
+        sums[res.Chain] = res.LogSum
       }
     }
   } // for
 
-  xlog.Info("finish scan", "recCnt", recCnt, "errCnt", errCnt)
+  xlog.Info("finish scan", "recCnt", recCnt, "errCnt", errCnt,
+    "driftCnt", driftCnt, "orderCnt", orderCnt)
 }
 
 // EOF: "scan.go"
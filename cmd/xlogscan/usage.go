@@ -24,12 +24,21 @@ Options:
   -v|--version|version - Show version and exit
 
   -file <log-file>     - Input log file (use stdin by default)
-  -chain               - Use SumChain option
+  -chain               - Use SumChain option (and check logId order per chain)
+  -chain-name <name>   - Check only named chain (all chains by default)
+  -drift <duration>    - Max logId/time drift (1s by default, 0 - off)
+  -levels <spec>       - Custom log levels (e.g. "audit=6:AUDIT,security=11")
+  -pseudo-key <id:hex> - Pseudonymization key (for pseudo command)
+  -field-key <keys>    - Field decryption keys (keyId:aes|x25519:hex,...)
   -log-*               - Logger options
 
 Commands:
   scan - default command
   test - generate test JSON log file
+  pseudo <value>... - print pseudonymization tokens of values
+                      (and records with them if -file is set)
+  decrypt-fields    - decrypt encrypted attributes (enc:<keyId>:...)
+                      and print log to stdout
 
 Keys (signals):
   Ctrl+C (SIGINT)  - terminate application
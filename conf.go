@@ -12,6 +12,11 @@ type Conf struct {
 	// логирования в процессе выполнения программы.
 	// Пустая строка интерпретируется как уровень "info".
 	//
+	// Допускается спецификация с переопределением уровня для пакетов
+	// (по месту вызова) и имён логгеров (атрибут "logger"), например
+	// "info,github.com/acme/db=trace,http=warn" (см. ParseLevelSpec).
+	// Переопределения можно изменять во время работы (см. SetLevelSpec).
+	//
 	//  flood  = slog.Level(-12) - чрезвычайно избыточный уровень журналирования
 	//  trace  = slog.Level(-8)  - уровень трассировки всех вызовов и переходов (syslog)
 	//  debug  = slog.LevelDebug - уровень вывода отладочный сообщений (опытная эксплуатация)
@@ -27,6 +32,51 @@ type Conf struct {
 	//  silent = slog.Level(20)  - полная блокировка вывода каких-либо сообщений в журнал
 	Level string `json:"level"`
 
+	// Выражение фильтра включения записей (пустая строка - все записи),
+	// например: `level>=debug && user=="42"` или `source.file~"db/"`.
+	// В журнал выводятся только записи, соответствующие выражению.
+	// Подробнее о выражениях см. CompileFilter().
+	Filter string `json:"filter"`
+
+	// Выражение фильтра исключения записей (пустая строка - нет),
+	// например: `msg~"^healthcheck"`.
+	// Записи, соответствующие выражению, в журнал не выводятся.
+	FilterOut string `json:"filter-out"`
+
+	// Маскировать секреты в записях журнала правилами по умолчанию
+	// (пароли, токены, ключи API, Bearer/JWT, номера карт),
+	// см. DefaultRedactRules(). Маскирование выполняется до вычисления
+	// контрольной суммы.
+	Redact bool `json:"redact"`
+
+	// Заданные правила маскирования секретов (nil - по Redact),
+	// см. NewRedactor()
+	Redactor *Redactor `json:"-"`
+
+	// Псевдонимизация персональных данных (nil - без псевдонимизации),
+	// см. NewPseudonymizer(). Токены подставляются в атрибуты записей
+	// и With до вычисления контрольной суммы.
+	Pseudonymizer *Pseudonymizer `json:"-"`
+
+	// Шифрование значений атрибутов (nil - без шифрования),
+	// см. NewFieldEncryptor(). Значения атрибутов записей и With
+	// шифруются до вычисления контрольной суммы.
+	FieldEncryptor *FieldEncryptor `json:"-"`
+
+	// Ограничения размера записей: длины сообщения и значений атрибутов,
+	// числа атрибутов, глубины вложенности и общего размера записи
+	// (nil - без ограничений), см. Limits и ParseLimits
+	Limits *Limits `json:"limits"`
+
+	// Цепочка именованных middleware из реестра (см. RegisterMiddleware),
+	// подключаемая в заявленном порядке до вычисления logId/logSum
+	Middlewares []MiddlewareConf `json:"middlewares"`
+
+	// Метрики журнала (nil - без метрик), см. NewMetrics().
+	// Подсчитываются записи по уровням, именам логгеров и местам вызова,
+	// байты и ошибки записи по направлениям вывода.
+	Metrics *Metrics `json:"-"`
+
 	// Заданный выходной поток ("stdout", "stderr", "null" или пустая строка).
 	// Если поток не задан (пустая строка) и не задан файл журнала (пустая
 	// строка), то по умолчанию используется "stdout" (действие по умолчанию).
@@ -77,12 +127,42 @@ type Conf struct {
 	// Добавлять в каждую запись в журнале идентификатор горутины с ключом "goroutine"
 	GoId bool `json:"go-id"`
 
+	// Добавлять в каждую запись идентификатор родительской горутины с ключом
+	// "goParent" (если его удаётся определить)
+	GoParent bool `json:"go-parent"`
+
+	// Добавлять в каждую запись pprof метки из контекста (pprof.WithLabels)
+	// группой с ключом "goLabels"
+	GoLabels bool `json:"go-labels"`
+
+	// Добавлять в каждую запись атрибуты W3C traceparent из контекста
+	// ("trace_id", "span_id", "trace_flags"), см. ContextWithTraceParent().
+	// При SumFull=true атрибуты входят в контрольную сумму.
+	TraceCtx bool `json:"trace-ctx"`
+
 	// Обогадить журнал уникальным UUID идентификатором каждую запись.
 	// К каждому сообщению в журнале добавляется UUIDv7
 	// идентификатор с ключом "logId". В UUID идентификаторе младшие биты могут
 	// быть перезаписаны контрольной суммой.
+	// UUIDv7 идентификаторы строго монотонно возрастают в пределах процесса
+	// (счётчик в пределах миллисекунды по RFC 9562).
 	IdOn bool `json:"id-on"`
 
+	// Формат идентификатора записи "logId" ("uuid", "ulid", "ksuid",
+	// "snowflake", "counter"). По умолчанию (пустая строка) используется
+	// UUIDv7. Форматы UUID, ULID и KSUID позволяют упаковать контрольную
+	// сумму в младшие биты идентификатора, для форматов Snowflake и
+	// счётчика контрольная сумма всегда выводится отдельным атрибутом
+	// с ключом "logSum".
+	// Подробнее см. функцию NewIdGenerator().
+	// Регистр строки не имеет значение.
+	IdFormat string `json:"id-format"`
+
+	// Номер узла (0...1023) для идентификаторов в формате "snowflake".
+	// Позволяет различать идентификаторы записей разных экземпляров
+	// приложения.
+	IdNode int `json:"id-node"`
+
 	// Добавить в журнал контрольную сумму для каждой записи.
 	// Контрольная сумма помещается в младшие биты UUID идентификатора или
 	// в шестнадцатеричном формате добавляется в журнал с ключом "logSum".
@@ -97,6 +177,8 @@ type Conf struct {
 	// контрольной суммы предыдущей записи в журнале.
 	// Данная опция позволяет отслеживать систематические потери или
 	// подмену записей в журнале.
+	// Логгер, полученный через WithChain(name), ведёт отдельную именованную
+	// цепочку (имя добавляется в запись атрибутом "logChain").
 	SumChain bool `json:"sum-chain"`
 
 	// Не упаковать контрольную сумму (КС) в младшие биты UUID
@@ -166,6 +248,16 @@ type Conf struct {
 	// программного комплекса.
 	SrcFields *Fields `json:"src-fields"`
 
+	// Минимальный уровень записей, для которых в журнал добавляется стек
+	// вызовов в месте вызова функции журналирования (атрибут "stack").
+	// Пустая строка - стек вызовов не добавляется. Имена файлов в кадрах
+	// стека укорачиваются в соответствии с SrcPkg и SrcExt.
+	StackLevel string `json:"stack-level"`
+
+	// Признак добавления в журнал дампа стеков всех горутин (атрибут
+	// "goroutines") для записей уровня EMERG и выше (если задан StackLevel)
+	StackAll bool `json:"stack-all"`
+
 	// Признак отключения "подкраски" журналов с помощью ANSI/Escape
 	// последовательностей, если Format="tinted"
 	ColorOff bool `json:"color-off"`
@@ -0,0 +1,66 @@
+// File: "context.go"
+
+package xlog
+
+import (
+	"context"
+	"log/slog" // go>=1.21
+	"time"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Ключ для хранения логгера в контексте
+type loggerKey struct{}
+
+// Ключ для хранения атрибутов в контексте
+type attrsKey struct{}
+
+// NewContext возвращает контекст с заданным логгером
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext извлекает логгер из контекста. Если логгера в контексте
+// нет, то возвращается текущий (глобальный) логгер (см. Current()).
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*Logger); ok && logger != nil {
+			return logger
+		}
+	}
+	return Current()
+}
+
+// ContextWith возвращает контекст с добавленными атрибутами
+// (аргументы аналогичны Logger.With()). Атрибуты накапливаются:
+// добавляются к атрибутам, уже имеющимся в контексте.
+// Хендлер, созданный NewHandler(), добавляет атрибуты контекста в каждую
+// запись, выводимую с данным контекстом (InfoContext, Log, ...), с учётом
+// открытых групп.
+func ContextWith(ctx context.Context, args ...any) context.Context {
+	r := slog.NewRecord(time.Time{}, 0, "", 0) // для разбора args
+	r.Add(args...)
+	if r.NumAttrs() == 0 {
+		return ctx
+	}
+
+	prev := ContextAttrs(ctx)
+	attrs := make([]slog.Attr, 0, len(prev)+r.NumAttrs())
+	attrs = append(attrs, prev...)
+	r.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// ContextAttrs возвращает атрибуты, накопленные в контексте ContextWith()
+func ContextAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// EOF: "context.go"
@@ -0,0 +1,239 @@
+// File: "damper.go"
+
+package xlog
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/maphash"
+	"log/slog" // go>=1.21
+	"sync"
+	"time"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Демпфер повторяющихся сообщений.
+// Каждой записи вычисляется отпечаток (сообщение, уровень, место вызова
+// и значения заданных атрибутов). Первые Burst записей с одинаковым
+// отпечатком в пределах окна Window выводятся, остальные подавляются.
+// По окончании окна, если были подавленные записи, выводится итоговая
+// запись (сообщение, уровень и атрибуты первой записи окна) с атрибутами
+// "repeated" (число подавленных записей), "first"/"last" (метки времени
+// первой и последней подавленной записи) и "interval" (интервал между
+// ними). Демпфер следует подключать методом Logger.WithMiddleware(),
+// т.е. перед IdHandler'ом: подавленные записи не получают logId/logSum
+// и не нарушают цепочку контрольных сумм (SumChain), а итоговые записи
+// включаются в цепочку как обычные.
+
+// Ключи атрибутов итоговой записи демпфера
+const (
+	RepeatedKey = "repeated" // число подавленных записей
+	FirstKey    = "first"    // метка времени первой подавленной записи
+	LastKey     = "last"     // метка времени последней подавленной записи
+	IntervalKey = "interval" // интервал подавления (last - first)
+)
+
+// Параметры демпфера по умолчанию
+const (
+	DefaultDamperWindow     = 10 * time.Second // окно подавления
+	DefaultDamperMaxEntries = 10000            // число отслеживаемых отпечатков
+)
+
+// Параметры демпфера повторяющихся сообщений
+type DamperOptions struct {
+	// Окно подавления (по умолчанию DefaultDamperWindow)
+	Window time.Duration
+
+	// Число записей с одинаковым отпечатком, выводимых в пределах окна
+	// (по умолчанию 1)
+	Burst int
+
+	// Ключи корневых атрибутов записи, значения которых входят в отпечаток
+	// (например, "peer" - подавлять повторы отдельно для каждого узла)
+	Keys []string
+
+	// Максимальное число одновременно отслеживаемых отпечатков
+	// (по умолчанию DefaultDamperMaxEntries). Записи сверх лимита
+	// выводятся без подавления.
+	MaxEntries int
+}
+
+// Damper - демпфер повторяющихся сообщений (см. NewDamper)
+type Damper struct {
+	opts DamperOptions
+	seed maphash.Seed            // затравка хеша отпечатков
+	m    map[uint64]*damperEntry // окна по отпечаткам
+	mx   sync.Mutex              // мьютекс для безопасного доступа к m
+}
+
+// Окно подавления записей с одинаковым отпечатком
+type damperEntry struct {
+	r          slog.Record // первая запись окна
+	next       HandleFunc  // следующий обработчик (для итоговой записи)
+	end        time.Time   // окончание окна
+	count      int         // число записей в окне
+	suppressed int         // число подавленных записей
+	first      time.Time   // метка времени первой подавленной записи
+	last       time.Time   // метка времени последней подавленной записи
+	done       bool        // признак закрытия окна
+}
+
+// NewDamper создаёт демпфер повторяющихся сообщений
+//
+//	opts - параметры демпфера или nil (параметры по умолчанию)
+func NewDamper(opts *DamperOptions) *Damper {
+	d := &Damper{seed: maphash.MakeSeed(), m: map[uint64]*damperEntry{}}
+	if opts != nil {
+		d.opts = *opts
+	}
+	if d.opts.Window <= 0 {
+		d.opts.Window = DefaultDamperWindow
+	}
+	if d.opts.Burst <= 0 {
+		d.opts.Burst = 1
+	}
+	if d.opts.MaxEntries <= 0 {
+		d.opts.MaxEntries = DefaultDamperMaxEntries
+	}
+	return d
+}
+
+// NewMiddlewareDamper создаёт Middleware демпфера повторяющихся сообщений
+//
+//	opts - параметры демпфера или nil (параметры по умолчанию)
+func NewMiddlewareDamper(opts *DamperOptions) Middleware {
+	return NewDamper(opts).Middleware()
+}
+
+// Middleware возвращает Middleware демпфера
+func (d *Damper) Middleware() Middleware {
+	return NewMiddleware(d.handle)
+}
+
+// fingerprint вычисляет отпечаток записи
+func (d *Damper) fingerprint(r slog.Record) uint64 {
+	var h maphash.Hash
+	h.SetSeed(d.seed)
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(r.Level))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(r.PC))
+	h.Write(buf[:])
+	h.WriteString(r.Message)
+	if len(d.opts.Keys) != 0 {
+		r.Attrs(func(attr slog.Attr) bool {
+			for _, key := range d.opts.Keys {
+				if attr.Key == key {
+					h.WriteByte(0)
+					h.WriteString(key)
+					h.WriteByte('=')
+					h.WriteString(attr.Value.Resolve().String())
+				}
+			}
+			return true
+		})
+	}
+	return h.Sum64()
+}
+
+// handle реализует MiddlewareFunc демпфера
+func (d *Damper) handle(ctx context.Context, r slog.Record, next HandleFunc) error {
+	fp := d.fingerprint(r)
+	now := time.Now()
+	t := r.Time
+	if t.IsZero() {
+		t = now
+	}
+
+	d.mx.Lock()
+	e, ok := d.m[fp]
+	if ok && !now.After(e.end) { // окно открыто
+		e.count++
+		if e.count > d.opts.Burst { // подавить запись
+			if e.suppressed == 0 {
+				e.first = t
+			}
+			e.suppressed++
+			e.last = t
+			e.next = next
+			d.mx.Unlock()
+			return nil
+		}
+		d.mx.Unlock()
+		return next(ctx, r)
+	}
+
+	var old *damperEntry
+	if ok { // окно истекло, но таймер ещё не сработал
+		old = d.close(fp, e)
+	}
+	if len(d.m) < d.opts.MaxEntries { // открыть новое окно
+		e = &damperEntry{r: r.Clone(), next: next, end: now.Add(d.opts.Window), count: 1}
+		d.m[fp] = e
+		time.AfterFunc(d.opts.Window, func() { d.expire(fp, e) })
+	}
+	d.mx.Unlock()
+
+	if old != nil {
+		d.summary(old)
+	}
+	return next(ctx, r)
+}
+
+// close закрывает окно (под мьютексом) и возвращает его, если требуется
+// итоговая запись
+func (d *Damper) close(fp uint64, e *damperEntry) *damperEntry {
+	if d.m[fp] == e {
+		delete(d.m, fp)
+	}
+	if e.done {
+		return nil
+	}
+	e.done = true
+	if e.suppressed == 0 {
+		return nil
+	}
+	return e
+}
+
+// expire закрывает окно по таймеру
+func (d *Damper) expire(fp uint64, e *damperEntry) {
+	d.mx.Lock()
+	e = d.close(fp, e)
+	d.mx.Unlock()
+	if e != nil {
+		d.summary(e)
+	}
+}
+
+// summary выводит итоговую запись окна
+func (d *Damper) summary(e *damperEntry) {
+	r := slog.NewRecord(time.Now(), e.r.Level, e.r.Message, e.r.PC)
+	e.r.Attrs(func(attr slog.Attr) bool {
+		r.AddAttrs(attr)
+		return true
+	})
+	r.AddAttrs(
+		slog.Int(RepeatedKey, e.suppressed),
+		slog.Time(FirstKey, e.first),
+		slog.Time(LastKey, e.last),
+		slog.Duration(IntervalKey, e.last.Sub(e.first)))
+	_ = e.next(context.Background(), r)
+}
+
+// Flush досрочно закрывает все окна и выводит итоговые записи
+// (например, перед завершением приложения)
+func (d *Damper) Flush() {
+	d.mx.Lock()
+	var es []*damperEntry
+	for fp, e := range d.m {
+		if e = d.close(fp, e); e != nil {
+			es = append(es, e)
+		}
+	}
+	d.mx.Unlock()
+	for _, e := range es {
+		d.summary(e)
+	}
+}
+
+// EOF: "damper.go"
@@ -3,6 +3,7 @@
 package xlog
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -53,13 +54,23 @@ func StringToInt(s string) int {
 // Анализируются следующие переменные окружения, соответствующие
 // (возможно с инверсией) полям структуры Conf:
 //
-//	LOG_LEVEL       (string/int: "debug", "trace", "error", "0", "-20"...)
+//	LOG_LEVEL       (string/int: "debug", "trace", "error", "0", "-20", "info,db=trace", "audit"...)
+//	LOG_FILTER      (string: ~`level>=debug && user=="42"`)
+//	LOG_FILTER_OUT  (string: ~`msg~"^healthcheck"`)
+//	LOG_REDACT      (bool)
+//	LOG_LIMITS      (string: ~"message=1024,value=4096,attrs=64,depth=8,size=65536")
+//	LOG_MIDDLEWARES (string: ~"redact; sampler:first=10,thereafter=100" или JSON)
 //	LOG_PIPE        (string: "stdout", "stderr", "null")
 //	LOG_FILE        (string: ~"logs/app.log")
 //	LOG_FILE_MODE   (string: ~"0640")
 //	LOG_FORMAT      (string: "json", "logfmt", "tinted", "default")
 //	LOG_GOID        (bool)
+//	LOG_GOPARENT    (bool)
+//	LOG_GOLABELS    (bool)
+//	LOG_TRACE_CTX   (bool)
 //	LOG_ID          (bool)
+//	LOG_ID_FORMAT   (string: "uuid", "ulid", "ksuid", "snowflake", "counter")
+//	LOG_ID_NODE     (int: 0...1023)
 //	LOG_SUM         (bool)
 //	LOG_SUM_FULL    (bool)
 //	LOG_SUM_CHAIN   (bool)
@@ -72,6 +83,8 @@ func StringToInt(s string) int {
 //	LOG_SRC_PKG     (bool)
 //	LOG_SRC_FUNC    (bool)
 //	LOG_SRC_EXT     (bool)
+//	LOG_STACK_LEVEL (string/int: "crit", "error", "10"...)
+//	LOG_STACK_ALL   (bool)
 //	LOG_COLOR       (bool)
 //	LOG_LEVEL_OFF   (bool)
 //	LOG_ROTATE      (bool)
@@ -100,6 +113,29 @@ func Env(conf *Conf, prefixOpt ...string) {
 	if v := os.Getenv(prefix + "LEVEL"); v != "" {
 		conf.Level = v
 	}
+	if v := os.Getenv(prefix + "FILTER"); v != "" {
+		conf.Filter = v
+	}
+	if v := os.Getenv(prefix + "FILTER_OUT"); v != "" {
+		conf.FilterOut = v
+	}
+	if v := os.Getenv(prefix + "REDACT"); v != "" {
+		conf.Redact = StringToBool(v)
+	}
+	if v := os.Getenv(prefix + "LIMITS"); v != "" {
+		if limits, err := ParseLimits(v); err == nil {
+			conf.Limits = limits
+		} else {
+			fmt.Fprintf(os.Stderr, "ERROR: bad %sLIMITS='%s': %v\n", prefix, v, err)
+		}
+	}
+	if v := os.Getenv(prefix + "MIDDLEWARES"); v != "" {
+		if mws, err := ParseMiddlewares(v); err == nil {
+			conf.Middlewares = mws
+		} else {
+			fmt.Fprintf(os.Stderr, "ERROR: bad %sMIDDLEWARES='%s': %v\n", prefix, v, err)
+		}
+	}
 	if v := os.Getenv(prefix + "PIPE"); v != "" {
 		conf.Pipe = v
 	}
@@ -115,9 +151,24 @@ func Env(conf *Conf, prefixOpt ...string) {
 	if v := os.Getenv(prefix + "GOID"); v != "" {
 		conf.GoId = StringToBool(v)
 	}
+	if v := os.Getenv(prefix + "GOPARENT"); v != "" {
+		conf.GoParent = StringToBool(v)
+	}
+	if v := os.Getenv(prefix + "GOLABELS"); v != "" {
+		conf.GoLabels = StringToBool(v)
+	}
+	if v := os.Getenv(prefix + "TRACE_CTX"); v != "" {
+		conf.TraceCtx = StringToBool(v)
+	}
 	if v := os.Getenv(prefix + "ID"); v != "" {
 		conf.IdOn = StringToBool(v)
 	}
+	if v := os.Getenv(prefix + "ID_FORMAT"); v != "" {
+		conf.IdFormat = v
+	}
+	if v := os.Getenv(prefix + "ID_NODE"); v != "" {
+		conf.IdNode = StringToInt(v)
+	}
 	if v := os.Getenv(prefix + "SUM"); v != "" {
 		conf.SumOn = StringToBool(v)
 	}
@@ -157,6 +208,12 @@ func Env(conf *Conf, prefixOpt ...string) {
 	if v := os.Getenv(prefix + "SRC_EXT"); v != "" {
 		conf.SrcExt = StringToBool(v)
 	}
+	if v := os.Getenv(prefix + "STACK_LEVEL"); v != "" {
+		conf.StackLevel = v
+	}
+	if v := os.Getenv(prefix + "STACK_ALL"); v != "" {
+		conf.StackAll = StringToBool(v)
+	}
 	if v := os.Getenv(prefix + "COLOR"); v != "" {
 		conf.ColorOff = !StringToBool(v)
 	}
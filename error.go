@@ -7,4 +7,19 @@ import "errors"
 // Ошибка: "ротация файла журнала не предусмотрена конфигурацией"
 var ErrNotRotatable = errors.New("logger is not rotatable")
 
+// Ошибка: "хендлер логгера не поддерживает переопределение уровней"
+var ErrNoLevels = errors.New("logger does not support level overrides")
+
+// Ошибка: "хендлер логгера не поддерживает фильтры записей"
+var ErrNoFilters = errors.New("logger does not support record filters")
+
+// Ошибка: "некорректный пользовательский уровень журналирования"
+var ErrBadLevel = errors.New("bad custom log level")
+
+// Ошибка: "некорректный ключ (идентификатор ключа)"
+var ErrBadKey = errors.New("bad key")
+
+// Ошибка: "некорректное имя или описание middleware"
+var ErrBadMiddleware = errors.New("bad middleware")
+
 // EOF: "error.go"
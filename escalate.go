@@ -0,0 +1,142 @@
+// File: "escalate.go"
+
+package xlog
+
+import (
+	"context"
+	"log/slog" // go>=1.21
+	"runtime"
+	"sync"
+	"time"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Временное изменение уровня журналирования с автоматическим возвратом.
+// Повторное изменение во время действующего заменяет уровень и срок
+// ("последнее побеждает"), а по истечении срока (или по RestoreLevel)
+// восстанавливается уровень, действовавший до первого изменения.
+// Оба перехода записываются в журнал с уровнем NOTICE независимо от
+// действующего уровня журналирования.
+// Состояние хранится для *slog.LevelVar, поэтому является общим для
+// всех дочерних логгеров (With, WithGroup, Named...).
+
+// Состояние временного изменения уровня
+type escalation struct {
+	prev  slog.Level  // уровень до первого изменения
+	level slog.Level  // временный уровень
+	until time.Time   // срок действия
+	timer *time.Timer // таймер возврата уровня
+	gen   uint64      // номер изменения (для таймера)
+}
+
+// Действующие временные изменения уровней
+var escalations = struct {
+	m   map[*slog.LevelVar]*escalation
+	gen uint64     // счётчик изменений
+	mx  sync.Mutex // мьютекс для безопасного доступа к m и gen
+}{m: map[*slog.LevelVar]*escalation{}}
+
+// SetLevelFor временно устанавливает уровень журналирования на заданное
+// время, после чего уровень автоматически восстанавливается
+func (c *Logger) SetLevelFor(level slog.Level, d time.Duration) {
+	if d <= 0 {
+		c.RestoreLevel()
+		return
+	}
+
+	escalations.mx.Lock()
+	e, ok := escalations.m[c.Level]
+	if !ok {
+		e = &escalation{prev: c.Level.Level()}
+		escalations.m[c.Level] = e
+	} else {
+		e.timer.Stop()
+	}
+	escalations.gen++
+	gen := escalations.gen
+	e.level, e.until, e.gen = level, time.Now().Add(d), gen
+	c.Level.Set(level)
+	e.timer = time.AfterFunc(d, func() { c.restoreLevel(gen) })
+	prev := e.prev
+	escalations.mx.Unlock()
+
+	c.notice("log level temporarily changed",
+		"logLevel", LevelToString(level), "prev", LevelToString(prev),
+		"for", d.String())
+}
+
+// SetLvlFor временно устанавливает уровень журналирования на основе строки
+// идентификатора типа "trace", "debug" и т.п. (см. SetLevelFor)
+func (c *Logger) SetLvlFor(level string, d time.Duration) {
+	c.SetLevelFor(LevelFromString(level), d)
+}
+
+// RestoreLevel досрочно восстанавливает уровень журналирования,
+// действовавший до временного изменения (SetLevelFor)
+func (c *Logger) RestoreLevel() { c.restoreLevel(0) }
+
+// restoreLevel восстанавливает уровень журналирования. Если задан номер
+// изменения gen (по таймеру), то восстановление производится, только если
+// изменение не было заменено новым.
+func (c *Logger) restoreLevel(gen uint64) {
+	escalations.mx.Lock()
+	e, ok := escalations.m[c.Level]
+	if !ok || (gen != 0 && e.gen != gen) {
+		escalations.mx.Unlock()
+		return
+	}
+	e.timer.Stop()
+	delete(escalations.m, c.Level)
+	c.Level.Set(e.prev)
+	escalations.mx.Unlock()
+
+	c.notice("log level restored",
+		"logLevel", LevelToString(e.prev), "was", LevelToString(e.level),
+		"expired", gen != 0)
+}
+
+// Ключ контекста записей, выводимых независимо от уровня журналирования
+type bypassKey struct{}
+
+// levelBypass проверяет, что запись выводится независимо от уровня
+// журналирования (см. notice)
+func levelBypass(ctx context.Context) bool {
+	return ctx != nil && ctx.Value(bypassKey{}) != nil
+}
+
+// notice выводит запись о переходе уровня с уровнем NOTICE минуя проверку
+// уровня (Enabled), иначе запись о возврате к уровню выше NOTICE
+// (например "warn") была бы отброшена
+func (c *Logger) notice(msg string, args ...any) {
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:]) // пропустить Callers и notice
+	r := slog.NewRecord(time.Now(), LevelNotice, msg, pcs[0])
+	r.Add(args...)
+	ctx := context.WithValue(context.Background(), bypassKey{}, true)
+	_ = c.Handler().Handle(ctx, r)
+}
+
+// Escalation возвращает временный уровень журналирования и срок его
+// действия. Признак ok=false означает, что временного изменения нет.
+func (c *Logger) Escalation() (level slog.Level, until time.Time, ok bool) {
+	escalations.mx.Lock()
+	defer escalations.mx.Unlock()
+	if e, ok := escalations.m[c.Level]; ok {
+		return e.level, e.until, true
+	}
+	return 0, time.Time{}, false
+}
+
+// SetLevelFor временно устанавливает уровень журналирования глобального
+// логгера на заданное время
+func SetLevelFor(level slog.Level, d time.Duration) { currentClog.SetLevelFor(level, d) }
+
+// SetLvlFor временно устанавливает уровень журналирования глобального
+// логгера на основе строки идентификатора типа "trace", "debug" и т.п.
+func SetLvlFor(level string, d time.Duration) { currentClog.SetLvlFor(level, d) }
+
+// RestoreLevel досрочно восстанавливает уровень журналирования
+// глобального логгера
+func RestoreLevel() { currentClog.RestoreLevel() }
+
+// EOF: "escalate.go"
@@ -0,0 +1,366 @@
+// File: "fieldenc.go"
+
+package xlog
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog" // go>=1.21
+	"regexp"
+	"strings"
+	"sync"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Шифрование значений отдельных атрибутов (паспортные данные и т.п.).
+// Значения заданных атрибутов заменяются строками вида
+// "enc:<keyId>:<base64url>", остальные атрибуты остаются открытыми.
+// Поддерживаются ключи двух типов:
+//
+//   - "aes" - симметричный ключ AES-256-GCM (32 байта);
+//   - "x25519" - конверт на открытом ключе X25519: для каждого значения
+//     генерируется эфемерная пара ключей, ключ AES-256-GCM выводится
+//     из общего секрета (SHA-256), в журнал пишутся эфемерный открытый
+//     ключ и шифротекст. Приложению достаточно открытого ключа,
+//     расшифровать значения может только владелец закрытого ключа.
+//
+// Шифратор подключается опцией Conf.FieldEncryptor (IdOptions), тогда
+// значения атрибутов записей и With шифруются до вычисления контрольной
+// суммы, и она проверяется без ключа. Middleware шифратора обрабатывает
+// только атрибуты записи (атрибуты With ему недоступны).
+// Расшифровать журнал можно FieldDecryptor'ом (команда
+// "xlogscan decrypt-fields").
+// Спецификация ключа (ParseFieldKey): "keyId:aes:<hex>",
+// "keyId:x25519:<hex закрытого ключа>" или "keyId:x25519-pub:<hex>".
+
+// Префикс зашифрованного значения
+const FieldEncPrefix = "enc:"
+
+// Типы ключей шифрования атрибутов
+const (
+	FieldKeyAES    = "aes"        // симметричный ключ AES-256-GCM
+	FieldKeyX25519 = "x25519"     // закрытый ключ X25519
+	FieldKeyPublic = "x25519-pub" // открытый ключ X25519
+)
+
+// Зашифрованное значение в тексте журнала
+var fieldEncRe = regexp.MustCompile(`enc:[A-Za-z0-9._-]+:[A-Za-z0-9_-]+`)
+
+// Допустимый идентификатор ключа
+var fieldKeyIdRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// FieldKey - ключ шифрования атрибутов (см. ParseFieldKey)
+type FieldKey struct {
+	Id      string           // идентификатор ключа (входит в значение)
+	Secret  []byte           // симметричный ключ AES-256 (или nil)
+	Public  *ecdh.PublicKey  // открытый ключ X25519 (или nil)
+	Private *ecdh.PrivateKey // закрытый ключ X25519 (или nil)
+}
+
+// ParseFieldKey разбирает спецификацию ключа шифрования атрибутов
+// "keyId:type:hex" (type - "aes", "x25519" или "x25519-pub")
+func ParseFieldKey(spec string) (FieldKey, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 3)
+	if len(parts) != 3 || !fieldKeyIdRe.MatchString(parts[0]) {
+		return FieldKey{}, fmt.Errorf("%w: use keyId:type:hex", ErrBadKey)
+	}
+	raw, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return FieldKey{}, fmt.Errorf("%w: %v", ErrBadKey, err)
+	}
+	k := FieldKey{Id: parts[0]}
+	switch parts[1] {
+	case FieldKeyAES:
+		if len(raw) != 32 {
+			return FieldKey{}, fmt.Errorf("%w: AES-256 key must be 32 bytes", ErrBadKey)
+		}
+		k.Secret = raw
+	case FieldKeyX25519:
+		k.Private, err = ecdh.X25519().NewPrivateKey(raw)
+		if err == nil {
+			k.Public = k.Private.PublicKey()
+		}
+	case FieldKeyPublic:
+		k.Public, err = ecdh.X25519().NewPublicKey(raw)
+	default:
+		err = fmt.Errorf("unknown key type %q", parts[1])
+	}
+	if err != nil {
+		return FieldKey{}, fmt.Errorf("%w: %v", ErrBadKey, err)
+	}
+	return k, nil
+}
+
+// String возвращает спецификацию ключа (для "x25519" - закрытого)
+func (k FieldKey) String() string {
+	switch {
+	case k.Secret != nil:
+		return k.Id + ":" + FieldKeyAES + ":" + hex.EncodeToString(k.Secret)
+	case k.Private != nil:
+		return k.Id + ":" + FieldKeyX25519 + ":" + hex.EncodeToString(k.Private.Bytes())
+	case k.Public != nil:
+		return k.Id + ":" + FieldKeyPublic + ":" + hex.EncodeToString(k.Public.Bytes())
+	}
+	return k.Id
+}
+
+// GenerateFieldKey создаёт новый ключ шифрования атрибутов заданного типа
+// ("aes" или "x25519")
+func GenerateFieldKey(keyId, keyType string) (FieldKey, error) {
+	if !fieldKeyIdRe.MatchString(keyId) {
+		return FieldKey{}, fmt.Errorf("%w: key id %q", ErrBadKey, keyId)
+	}
+	k := FieldKey{Id: keyId}
+	var err error
+	switch keyType {
+	case FieldKeyAES:
+		k.Secret = make([]byte, 32)
+		_, err = rand.Read(k.Secret)
+	case FieldKeyX25519:
+		k.Private, err = ecdh.X25519().GenerateKey(rand.Reader)
+		if err == nil {
+			k.Public = k.Private.PublicKey()
+		}
+	default:
+		err = fmt.Errorf("%w: unknown key type %q", ErrBadKey, keyType)
+	}
+	return k, err
+}
+
+// fieldAEAD создаёт AES-256-GCM
+func fieldAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// fieldEnvelopeKey выводит ключ AES-256 конверта X25519
+func fieldEnvelopeKey(shared, ephemeral, recipient []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("xlog field envelope"))
+	h.Write(shared)
+	h.Write(ephemeral)
+	h.Write(recipient)
+	return h.Sum(nil)
+}
+
+// encrypt шифрует значение ключом k
+func (k *FieldKey) encrypt(value string) (string, error) {
+	var payload []byte
+	aad := []byte(k.Id)
+	if k.Secret != nil { // nonce | шифротекст
+		aead, err := fieldAEAD(k.Secret)
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+		if _, err = rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload = aead.Seal(nonce, nonce, []byte(value), aad)
+	} else if k.Public != nil { // эфемерный открытый ключ | шифротекст
+		eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		shared, err := eph.ECDH(k.Public)
+		if err != nil {
+			return "", err
+		}
+		ephPub := eph.PublicKey().Bytes()
+		aead, err := fieldAEAD(fieldEnvelopeKey(shared, ephPub, k.Public.Bytes()))
+		if err != nil {
+			return "", err
+		}
+		// Ключ AES одноразовый, поэтому используется нулевой nonce
+		nonce := make([]byte, aead.NonceSize())
+		payload = aead.Seal(ephPub, nonce, []byte(value), aad)
+	} else {
+		return "", fmt.Errorf("%w: no encryption key %q", ErrBadKey, k.Id)
+	}
+	return FieldEncPrefix + k.Id + ":" + base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+// decrypt расшифровывает полезную нагрузку ключом k
+func (k *FieldKey) decrypt(payload []byte) (string, error) {
+	aad := []byte(k.Id)
+	if k.Secret != nil {
+		aead, err := fieldAEAD(k.Secret)
+		if err != nil {
+			return "", err
+		}
+		n := aead.NonceSize()
+		if len(payload) < n {
+			return "", fmt.Errorf("short encrypted value")
+		}
+		plain, err := aead.Open(nil, payload[:n], payload[n:], aad)
+		return string(plain), err
+	}
+	if k.Private == nil {
+		return "", fmt.Errorf("%w: no decryption key %q", ErrBadKey, k.Id)
+	}
+	if len(payload) < 32 {
+		return "", fmt.Errorf("short encrypted value")
+	}
+	eph, err := ecdh.X25519().NewPublicKey(payload[:32])
+	if err != nil {
+		return "", err
+	}
+	shared, err := k.Private.ECDH(eph)
+	if err != nil {
+		return "", err
+	}
+	aead, err := fieldAEAD(fieldEnvelopeKey(shared, payload[:32], k.Public.Bytes()))
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	plain, err := aead.Open(nil, nonce, payload[32:], aad)
+	return string(plain), err
+}
+
+// FieldEncryptor - шифратор значений атрибутов (см. NewFieldEncryptor)
+type FieldEncryptor struct {
+	rd  *Redactor // правила сопоставления ключей атрибутов
+	key FieldKey  // ключ шифрования
+}
+
+// NewFieldEncryptor создаёт шифратор значений атрибутов
+//
+//	key - ключ шифрования ("aes" или открытый ключ "x25519")
+//	keys - шаблоны ключей атрибутов (как в RedactRule.Key)
+func NewFieldEncryptor(key FieldKey, keys ...string) (*FieldEncryptor, error) {
+	if !fieldKeyIdRe.MatchString(key.Id) || key.Secret == nil && key.Public == nil {
+		return nil, fmt.Errorf("%w: no encryption key %q", ErrBadKey, key.Id)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("fieldenc: no attribute keys")
+	}
+	rules := make([]RedactRule, 0, len(keys))
+	for _, k := range keys {
+		rules = append(rules, RedactRule{Key: k})
+	}
+	rd, err := NewRedactor(rules...)
+	if err != nil {
+		return nil, err
+	}
+	e := &FieldEncryptor{rd: rd, key: key}
+	for _, r := range rd.keys {
+		r.fn = e.Encrypt
+	}
+	return e, nil
+}
+
+// NewMiddlewareFieldEnc создаёт Middleware шифрования значений атрибутов
+// (см. NewFieldEncryptor)
+func NewMiddlewareFieldEnc(key FieldKey, keys ...string) (Middleware, error) {
+	e, err := NewFieldEncryptor(key, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return e.Middleware(), nil
+}
+
+// Encrypt шифрует значение. При ошибке шифрования значение маскируется
+// (открытое значение в журнал не попадает).
+func (e *FieldEncryptor) Encrypt(value string) string {
+	s, err := e.key.encrypt(value)
+	if err != nil {
+		return RedactMaskString
+	}
+	return s
+}
+
+// Attrs шифрует значения списка атрибутов (исходный слайс не изменяется)
+func (e *FieldEncryptor) Attrs(attrs []slog.Attr) []slog.Attr {
+	return e.rd.Attrs(attrs)
+}
+
+// Record шифрует значения атрибутов записи
+func (e *FieldEncryptor) Record(r slog.Record) slog.Record {
+	return e.rd.Record(r)
+}
+
+// Middleware возвращает Middleware шифратора
+// (только атрибуты записи, см. Conf.FieldEncryptor)
+func (e *FieldEncryptor) Middleware() Middleware {
+	return NewMiddlewareRedact(e.rd)
+}
+
+// FieldDecryptor - дешифратор значений атрибутов (набор ключей)
+type FieldDecryptor struct {
+	keys map[string]*FieldKey // ключи по идентификаторам
+	mx   sync.RWMutex         // мьютекс для безопасного доступа к keys
+}
+
+// NewFieldDecryptor создаёт дешифратор значений атрибутов
+//
+//	keys - ключи расшифровки ("aes" или закрытые ключи "x25519")
+func NewFieldDecryptor(keys ...FieldKey) *FieldDecryptor {
+	d := &FieldDecryptor{keys: map[string]*FieldKey{}}
+	for _, k := range keys {
+		d.AddKey(k)
+	}
+	return d
+}
+
+// AddKey добавляет ключ расшифровки (например, после ротации ключей)
+func (d *FieldDecryptor) AddKey(key FieldKey) {
+	d.mx.Lock()
+	d.keys[key.Id] = &key
+	d.mx.Unlock()
+}
+
+// Decrypt расшифровывает значение вида "enc:<keyId>:<base64url>"
+func (d *FieldDecryptor) Decrypt(value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, FieldEncPrefix)
+	keyId, data, ok2 := strings.Cut(rest, ":")
+	if !ok || !ok2 {
+		return "", fmt.Errorf("not encrypted value")
+	}
+	d.mx.RLock()
+	k := d.keys[keyId]
+	d.mx.RUnlock()
+	if k == nil {
+		return "", fmt.Errorf("%w: unknown key id %q", ErrBadKey, keyId)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+	return k.decrypt(payload)
+}
+
+// DecryptText заменяет в тексте (строке журнала в любом формате)
+// зашифрованные значения расшифрованными. Расшифрованные значения
+// экранируются как содержимое JSON строки. Значения, которые не удалось
+// расшифровать (неизвестный ключ), остаются без изменений.
+// Возвращает текст и число расшифрованных значений.
+func (d *FieldDecryptor) DecryptText(text string) (string, int) {
+	n := 0
+	text = fieldEncRe.ReplaceAllStringFunc(text, func(s string) string {
+		plain, err := d.Decrypt(s)
+		if err != nil {
+			return s
+		}
+		n++
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(plain) // "...."\n
+		q := b.String()
+		return q[1 : len(q)-2]
+	})
+	return text, n
+}
+
+// EOF: "fieldenc.go"
@@ -0,0 +1,628 @@
+// File: "filter.go"
+
+package xlog
+
+import (
+	"context"
+	"fmt"
+	"log/slog" // go>=1.21
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Фильтры записей журнала на основе выражений, например:
+//
+//	level>=debug && user=="42"
+//	source.file~"db/" || (logger=="http" && status>=500)
+//	!(msg~"^healthcheck")
+//
+// Поля выражения:
+//
+//	level                 - уровень записи (сравнивается с именем уровня
+//	                        "debug", меткой "ERROR+2" или числом; неизвестный
+//	                        уровень - ошибка компиляции)
+//	msg, message          - текст сообщения
+//	source.file           - файл исходного текста (полный путь)
+//	source.func           - функция ("github.com/acme/db.(*Pool).Get")
+//	source.line           - номер строки
+//	logger                - имя логгера (см. Named, атрибут "logger")
+//	<key>, <group>.<key>  - атрибут записи, контекста (ContextWith) или
+//	                        корневой атрибут логгера (With)
+//
+// Операции: == != < <= > >= (числа сравниваются как числа, прочее - как
+// строки), ~ и !~ (соответствие регулярному выражению), && || ! и скобки.
+// Поле без операции проверяет наличие атрибута (или непустое значение).
+// Значения: строки в кавычках ("42"), числа, true/false, слова (debug).
+// Сравнение с отсутствующим атрибутом ложно (кроме "!=").
+//
+// Фильтр включения (Conf.Filter) пропускает только подходящие записи,
+// фильтр исключения (Conf.FilterOut) отбрасывает подходящие записи.
+// Выражения компилируются один раз (CompileFilter), IdHandler применяет
+// фильтры до вычисления контрольных сумм (цепочка SumChain не нарушается).
+// Фильтры можно заменять во время работы (см. Logger.SetFilter).
+
+// Filter - скомпилированное выражение фильтра записей
+type Filter struct {
+	expr  string                // исходное выражение
+	match func(*filterRec) bool // скомпилированное выражение
+}
+
+// Сведения о записи для вычисления фильтра
+type filterRec struct {
+	r      *slog.Record  // запись журнала
+	name   string        // имя логгера
+	with   []slog.Attr   // корневые атрибуты логгера (With)
+	groups []string      // открытые группы (префикс атрибутов записи)
+	frame  runtime.Frame // место вызова (если src=true)
+	src    bool          // признак заполнения frame
+	attrs  []slog.Attr   // атрибуты с полными именами (если flat=true)
+	flat   bool          // признак заполнения attrs
+}
+
+// source возвращает место вызова записи
+func (fr *filterRec) source() *runtime.Frame {
+	if !fr.src {
+		fr.src = true
+		if fr.r.PC != 0 {
+			fr.frame, _ = runtime.CallersFrames([]uintptr{fr.r.PC}).Next()
+		}
+	}
+	return &fr.frame
+}
+
+// attr ищет атрибут по полному имени ("group.key")
+func (fr *filterRec) attr(key string) (slog.Value, bool) {
+	if !fr.flat {
+		fr.flat = true
+		for _, a := range fr.with {
+			fr.attrs = flattenAttr(fr.attrs, "", a)
+		}
+		prefix := ""
+		if len(fr.groups) != 0 {
+			prefix = strings.Join(fr.groups, ".") + "."
+		}
+		fr.r.Attrs(func(a slog.Attr) bool {
+			fr.attrs = flattenAttr(fr.attrs, prefix, a)
+			return true
+		})
+	}
+	for i := len(fr.attrs) - 1; i >= 0; i-- { // последний побеждает
+		if fr.attrs[i].Key == key {
+			return fr.attrs[i].Value, true
+		}
+	}
+	return slog.Value{}, false
+}
+
+// flattenAttr добавляет атрибут (и вложенные атрибуты групп)
+// с полными именами
+func flattenAttr(attrs []slog.Attr, prefix string, a slog.Attr) []slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		return append(attrs, slog.Attr{Key: prefix + a.Key, Value: a.Value})
+	}
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range a.Value.Group() {
+		attrs = flattenAttr(attrs, prefix, ga)
+	}
+	return attrs
+}
+
+// CompileFilter компилирует выражение фильтра записей.
+// Пустое выражение соответствует любой записи.
+func CompileFilter(expr string) (*Filter, error) {
+	p := &filterParser{src: expr}
+	p.next()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.kind == tokEOF {
+		return &Filter{expr: expr, match: func(*filterRec) bool { return true }}, nil
+	}
+	match, err := p.parseOr()
+	if err == nil && p.tok.kind != tokEOF {
+		err = p.errorf("unexpected %q", p.tok.text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{expr: expr, match: match}, nil
+}
+
+// String возвращает исходное выражение фильтра
+func (f *Filter) String() string { return f.expr }
+
+// Match проверяет соответствие записи фильтру
+func (f *Filter) Match(r slog.Record) bool {
+	return f.match(&filterRec{r: &r})
+}
+
+// Filters - пара фильтров (включения и исключения), заменяемых
+// во время работы
+type Filters struct {
+	include atomic.Pointer[Filter] // фильтр включения (nil - все записи)
+	exclude atomic.Pointer[Filter] // фильтр исключения (nil - нет)
+}
+
+// NewFilters создаёт фильтры записей по выражениям включения и исключения
+// (пустое выражение - фильтр не используется). При ошибке компиляции
+// соответствующий фильтр не устанавливается.
+func NewFilters(include, exclude string) (*Filters, error) {
+	fs := &Filters{}
+	var err error
+	if f, e := compileFilter(include); e != nil {
+		err = e
+	} else {
+		fs.include.Store(f)
+	}
+	if f, e := compileFilter(exclude); e != nil {
+		err = e
+	} else {
+		fs.exclude.Store(f)
+	}
+	return fs, err
+}
+
+// compileFilter компилирует выражение (пустое выражение - nil)
+func compileFilter(expr string) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	return CompileFilter(expr)
+}
+
+// Set заменяет фильтры (безопасно во время работы). При ошибке
+// компиляции любого из выражений фильтры не изменяются.
+func (fs *Filters) Set(include, exclude string) error {
+	in, err := compileFilter(include)
+	if err != nil {
+		return err
+	}
+	ex, err := compileFilter(exclude)
+	if err != nil {
+		return err
+	}
+	fs.include.Store(in)
+	fs.exclude.Store(ex)
+	return nil
+}
+
+// Include возвращает выражение фильтра включения
+func (fs *Filters) Include() string {
+	if f := fs.include.Load(); f != nil {
+		return f.expr
+	}
+	return ""
+}
+
+// Exclude возвращает выражение фильтра исключения
+func (fs *Filters) Exclude() string {
+	if f := fs.exclude.Load(); f != nil {
+		return f.expr
+	}
+	return ""
+}
+
+// Match проверяет, проходит ли запись фильтры
+func (fs *Filters) Match(r slog.Record) bool {
+	return fs.match(&filterRec{r: &r})
+}
+
+// active сообщает, задан ли хотя бы один фильтр
+func (fs *Filters) active() bool {
+	return fs != nil && (fs.include.Load() != nil || fs.exclude.Load() != nil)
+}
+
+// match проверяет, проходит ли запись фильтры
+func (fs *Filters) match(fr *filterRec) bool {
+	if f := fs.include.Load(); f != nil && !f.match(fr) {
+		return false
+	}
+	if f := fs.exclude.Load(); f != nil && f.match(fr) {
+		return false
+	}
+	return true
+}
+
+// NewMiddlewareFilter создаёт Middleware, пропускающий записи по
+// выражениям фильтров включения и исключения (см. CompileFilter).
+// Middleware видит только атрибуты записи; для фильтрации с учётом
+// атрибутов логгера и до вычисления контрольных сумм следует использовать
+// Conf.Filter/Conf.FilterOut (или Logger.SetFilter).
+func NewMiddlewareFilter(include, exclude string) (Middleware, error) {
+	fs, err := NewFilters(include, exclude)
+	if err != nil {
+		return nil, err
+	}
+	mwf := func(ctx context.Context, r slog.Record, next HandleFunc) error {
+		if !fs.match(&filterRec{r: &r}) {
+			return nil
+		}
+		return next(ctx, r)
+	}
+	return NewMiddleware(mwf), nil
+}
+
+// filtersHandler - интерфейс slog.Handler'а с поддержкой фильтров
+// записей (см. IdHandler.Filters)
+type filtersHandler interface {
+	Filters() *Filters
+}
+
+// Filters возвращает фильтры записей логгера (или nil, если хендлер
+// логгера фильтры не поддерживает)
+func (c *Logger) Filters() *Filters {
+	if fh, ok := c.Handler().(filtersHandler); ok {
+		return fh.Filters()
+	}
+	return nil
+}
+
+// SetFilter заменяет выражения фильтров включения и исключения записей
+// логгера во время работы (пустая строка - фильтр не используется)
+func (c *Logger) SetFilter(include, exclude string) error {
+	fs := c.Filters()
+	if fs == nil {
+		return ErrNoFilters
+	}
+	return fs.Set(include, exclude)
+}
+
+// GetFilter возвращает выражения фильтров включения и исключения записей
+func (c *Logger) GetFilter() (include, exclude string) {
+	if fs := c.Filters(); fs != nil {
+		return fs.Include(), fs.Exclude()
+	}
+	return "", ""
+}
+
+// SetFilter заменяет выражения фильтров записей глобального логгера
+func SetFilter(include, exclude string) error {
+	return currentClog.SetFilter(include, exclude)
+}
+
+// GetFilter возвращает выражения фильтров записей глобального логгера
+func GetFilter() (include, exclude string) {
+	return currentClog.GetFilter()
+}
+
+// Лексемы выражения фильтра
+const (
+	tokEOF    = iota // конец выражения
+	tokIdent         // поле или слово
+	tokString        // строка в кавычках
+	tokNumber        // число
+	tokOp            // операция или скобка
+)
+
+// Лексема выражения фильтра
+type filterToken struct {
+	kind int    // тип лексемы
+	text string // текст лексемы (для строк - без кавычек)
+	pos  int    // позиция в выражении
+}
+
+// Разборщик выражения фильтра (рекурсивный спуск)
+type filterParser struct {
+	src string      // выражение
+	pos int         // текущая позиция
+	tok filterToken // текущая лексема
+	err error       // ошибка лексического анализа
+}
+
+// errorf формирует ошибку разбора с позицией текущей лексемы
+func (p *filterParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("filter %q: pos %d: %s",
+		p.src, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// next выделяет следующую лексему
+func (p *filterParser) next() {
+	src := p.src
+	for p.pos < len(src) && (src[p.pos] == ' ' || src[p.pos] == '\t') {
+		p.pos++
+	}
+	start := p.pos
+	p.tok = filterToken{kind: tokEOF, pos: start}
+	if start >= len(src) {
+		return
+	}
+
+	c := src[start]
+	switch {
+	case c == '"':
+		end := start + 1
+		for end < len(src) && src[end] != '"' {
+			if src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(src) {
+			p.err = p.errorf("unterminated string")
+			p.pos = len(src)
+			return
+		}
+		s, err := strconv.Unquote(src[start : end+1])
+		if err != nil {
+			p.err = p.errorf("bad string: %v", err)
+		}
+		p.tok, p.pos = filterToken{tokString, s, start}, end+1
+
+	case c >= '0' && c <= '9' || c == '-':
+		end := start + 1
+		for end < len(src) && strings.IndexByte("0123456789.eE+-", src[end]) >= 0 {
+			end++
+		}
+		p.tok, p.pos = filterToken{tokNumber, src[start:end], start}, end
+
+	case isIdentByte(c):
+		end := start + 1
+		for end < len(src) && isIdentByte(src[end]) {
+			end++
+		}
+		p.tok, p.pos = filterToken{tokIdent, src[start:end], start}, end
+
+	default:
+		for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "!~",
+			"<", ">", "~", "!", "(", ")"} {
+			if strings.HasPrefix(src[start:], op) {
+				p.tok, p.pos = filterToken{tokOp, op, start}, start+len(op)
+				return
+			}
+		}
+		p.err = p.errorf("unexpected character %q", c)
+		p.pos = len(src)
+	}
+}
+
+// isIdentByte проверяет символ поля/слова
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == '/' || c == '+' ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// parseOr разбирает выражение "a || b || ..."
+func (p *filterParser) parseOr() (func(*filterRec) bool, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.tok.kind == tokOp && p.tok.text == "||" {
+		p.next()
+		var right func(*filterRec) bool
+		if right, err = p.parseAnd(); err == nil {
+			l := left
+			left = func(fr *filterRec) bool { return l(fr) || right(fr) }
+		}
+	}
+	return left, err
+}
+
+// parseAnd разбирает выражение "a && b && ..."
+func (p *filterParser) parseAnd() (func(*filterRec) bool, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.tok.kind == tokOp && p.tok.text == "&&" {
+		p.next()
+		var right func(*filterRec) bool
+		if right, err = p.parseUnary(); err == nil {
+			l := left
+			left = func(fr *filterRec) bool { return l(fr) && right(fr) }
+		}
+	}
+	return left, err
+}
+
+// parseUnary разбирает выражения "!a", "(a)" и сравнения
+func (p *filterParser) parseUnary() (func(*filterRec) bool, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.kind == tokOp && p.tok.text == "!" {
+		p.next()
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(fr *filterRec) bool { return !f(fr) }, nil
+	}
+	if p.tok.kind == tokOp && p.tok.text == "(" {
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokOp || p.tok.text != ")" {
+			return nil, p.errorf("missing \")\"")
+		}
+		p.next()
+		return f, nil
+	}
+	if p.tok.kind != tokIdent {
+		return nil, p.errorf("field expected")
+	}
+	field := p.tok.text
+	p.next()
+	if p.err != nil {
+		return nil, p.err
+	}
+	switch field {
+	case "true":
+		return func(*filterRec) bool { return true }, nil
+	case "false":
+		return func(*filterRec) bool { return false }, nil
+	}
+
+	op := ""
+	if p.tok.kind == tokOp {
+		switch p.tok.text {
+		case "==", "!=", "<", "<=", ">", ">=", "~", "!~":
+			op = p.tok.text
+			p.next()
+		}
+	}
+	if op == "" { // проверка наличия
+		return filterExists(field), nil
+	}
+	if p.tok.kind != tokString && p.tok.kind != tokNumber && p.tok.kind != tokIdent {
+		return nil, p.errorf("value expected after %q", op)
+	}
+	lit := p.tok
+	p.next()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return filterCompare(field, op, lit)
+}
+
+// filterExists компилирует проверку наличия поля
+func filterExists(field string) func(*filterRec) bool {
+	switch field {
+	case "level":
+		return func(*filterRec) bool { return true }
+	case "msg", "message":
+		return func(fr *filterRec) bool { return fr.r.Message != "" }
+	case "logger":
+		return func(fr *filterRec) bool {
+			_, ok := fr.attr(LoggerKey)
+			return fr.name != "" || ok
+		}
+	case "source.file", "source.func", "source.function", "source.line":
+		return func(fr *filterRec) bool { return fr.r.PC != 0 }
+	}
+	return func(fr *filterRec) bool {
+		_, ok := fr.attr(field)
+		return ok
+	}
+}
+
+// filterCompare компилирует сравнение поля со значением
+func filterCompare(field, op string, lit filterToken) (func(*filterRec) bool, error) {
+	var re *regexp.Regexp
+	if op == "~" || op == "!~" {
+		var err error
+		if re, err = regexp.Compile(lit.text); err != nil {
+			return nil, fmt.Errorf("filter: bad regexp %q: %w", lit.text, err)
+		}
+	}
+
+	// Результат сравнения (cmp: -1, 0, +1) или соответствия (s)
+	result := func(cmp int, s string) bool {
+		switch op {
+		case "==":
+			return cmp == 0
+		case "!=":
+			return cmp != 0
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		case "~":
+			return re.MatchString(s)
+		}
+		return !re.MatchString(s) // "!~"
+	}
+
+	num, numErr := strconv.ParseFloat(lit.text, 64)
+	isNum := lit.kind != tokString && numErr == nil
+
+	// Сравнение строкового поля
+	str := func(get func(*filterRec) string) func(*filterRec) bool {
+		return func(fr *filterRec) bool {
+			s := get(fr)
+			return result(strings.Compare(s, lit.text), s)
+		}
+	}
+
+	switch field {
+	case "level":
+		var level slog.Level
+		if re == nil { // идентификатор ("debug"), метка ("ERROR+2") или число
+			var ok bool
+			if level, ok = lookupLevel(lit.text); !ok {
+				return nil, fmt.Errorf("filter: unknown level %q", lit.text)
+			}
+		}
+		return func(fr *filterRec) bool {
+			return result(cmpInt(int(fr.r.Level), int(level)), LevelToLabel(fr.r.Level))
+		}, nil
+
+	case "msg", "message":
+		return str(func(fr *filterRec) string { return fr.r.Message }), nil
+
+	case "source.file":
+		return str(func(fr *filterRec) string { return fr.source().File }), nil
+
+	case "source.func", "source.function":
+		return str(func(fr *filterRec) string { return fr.source().Function }), nil
+
+	case "source.line":
+		line := int(num)
+		return func(fr *filterRec) bool {
+			l := fr.source().Line
+			return result(cmpInt(l, line), strconv.Itoa(l))
+		}, nil
+
+	case "logger":
+		return str(func(fr *filterRec) string {
+			if fr.name != "" {
+				return fr.name
+			}
+			if v, ok := fr.attr(LoggerKey); ok {
+				return v.String()
+			}
+			return ""
+		}), nil
+	}
+
+	return func(fr *filterRec) bool {
+		v, ok := fr.attr(field)
+		if !ok {
+			return op == "!=" || op == "!~"
+		}
+		if f, ok := filterNumber(v); ok && isNum {
+			switch {
+			case f < num:
+				return result(-1, "")
+			case f > num:
+				return result(1, "")
+			}
+			return result(0, v.String())
+		}
+		s := v.String()
+		return result(strings.Compare(s, lit.text), s)
+	}, nil
+}
+
+// filterNumber возвращает числовое значение атрибута
+func filterNumber(v slog.Value) (float64, bool) {
+	switch v.Kind() {
+	case slog.KindInt64:
+		return float64(v.Int64()), true
+	case slog.KindUint64:
+		return float64(v.Uint64()), true
+	case slog.KindFloat64:
+		return v.Float64(), true
+	}
+	return 0, false
+}
+
+// cmpInt сравнивает целые числа (-1, 0, +1)
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// EOF: "filter.go"
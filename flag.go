@@ -2,7 +2,11 @@
 
 package xlog
 
-import "flag"
+import (
+	"flag"
+	"fmt"
+	"os"
+)
 
 // Префикс для флагов по умолчанию
 const DefaultFlagPrefix = "log-"
@@ -24,12 +28,22 @@ const DefaultFlagPrefix = "log-"
 //	mylog.Info("application started")
 type Opt struct {
 	Level            string // -log-level
+	Filter           string // -log-filter
+	FilterOut        string // -log-filter-out
+	Redact           string // -log-redact
+	Limits           string // -log-limits
+	Middlewares      string // -log-middlewares
 	Pipe             string // -log-pipe
 	File             string // -log-file
 	FileMode         string // -log-file-mode
 	Format           string // -log-format
 	GoId             string // -log-goid
+	GoParent         string // -log-goparent
+	GoLabels         string // -log-golabels
+	TraceCtx         string // -log-trace-ctx
 	Id               string // -log-id
+	IdFormat         string // -log-id-format
+	IdNode           string // -log-id-node
 	Sum              string // -log-sum
 	SumFull          string // -log-sum-full
 	SumChain         string // -log-sum-chain
@@ -42,6 +56,8 @@ type Opt struct {
 	SrcPkg           string // -log-src-pkg
 	SrcFunc          string // -log-src-func
 	SrcExt           string // -log-src-ext
+	StackLevel       string // -log-stack-level
+	StackAll         string // -log-stack-all
 	Color            string // -log-color
 	LevelOff         string // -log-level-off
 	Rotate           string // -log-rotate
@@ -62,12 +78,22 @@ type Opt struct {
 // Приложения могут включить в свой usage-вывод следующий текст:
 //
 //	-log-level <level>              - log level (flood/trace/debug/info/notice/warm/error/crit)
+//	-log-filter <expr>              - include records filter (level>=debug && user=="42")
+//	-log-filter-out <expr>          - exclude records filter (msg~"^healthcheck")
+//	-log-redact <on/off>            - force on/off secrets redaction
+//	-log-limits <limits>            - record size limits (message=1024,value=4096,attrs=64,depth=8,size=65536)
+//	-log-middlewares <chain>        - named middlewares chain (redact; sampler:first=10,thereafter=100)
 //	-log-pipe <pipe>                - log pipe (stdout/stderr/null)
 //	-log-file <file>                - log file path
 //	-log-file-mode <perm>           - log file mode (0640, 0600, 0644)
 //	-log-format <format>            - log format (json|prod/text|logfmt/tint|tinted|human/default|std)
 //	-log-goid <on/off>              - force on/off goroutine id for each record (goroutine)
+//	-log-goparent <on/off>          - force on/off parent goroutine id for each record (goParent)
+//	-log-golabels <on/off>          - force on/off pprof labels for each record (goLabels)
+//	-log-trace-ctx <on/off>         - force on/off W3C traceparent from context (trace_id, span_id)
 //	-log-id <on/off>                - force on/off id (UUID) for each record (logId)
+//	-log-id-format <format>         - logId format (uuid/ulid/ksuid/snowflake/counter)
+//	-log-id-node <node>             - node number for snowflake logId (0...1023)
 //	-log-sum <on/off>               - force on/off check sum for each record
 //	-log-sum-full <on/off>          - force on/off calculate full sum for earch record
 //	-log-sum-chain <on/off>         - force on/off check sum chain
@@ -80,6 +106,8 @@ type Opt struct {
 //	-log-src-pkg <on/off>           - force on/off log source directory/file name and line number
 //	-log-src-func <on/off>          - force on/off log function name
 //	-log-src-ext <on/off>           - force enable/disable show ".go" extension of source file name
+//	-log-stack-level <level>        - add call stack to records at or above level (crit/error/...)
+//	-log-stack-all <on/off>         - force on/off all goroutines dump for EMERG records
 //	-log-color <on/off>             - force enable/disable tinted colors (ANSI/Escape)
 //	-log-level-off <true/false>     - force disable/enable level output
 //	-log-rotate <on/off>            - force on/off log rotate
@@ -96,12 +124,22 @@ func NewOpt(prefixOpt ...string) *Opt {
 	opt := &Opt{}
 
 	flag.StringVar(&opt.Level, prefix+"level", "", "override log level (flood/trace/debug/info/notice/warm/error/crit)")
+	flag.StringVar(&opt.Filter, prefix+"filter", "", "include records filter (level>=debug && user==\"42\")")
+	flag.StringVar(&opt.FilterOut, prefix+"filter-out", "", "exclude records filter (msg~\"^healthcheck\")")
+	flag.StringVar(&opt.Redact, prefix+"redact", "", "force on/off secrets redaction")
+	flag.StringVar(&opt.Limits, prefix+"limits", "", "record size limits (message=1024,value=4096,attrs=64,depth=8,size=65536)")
+	flag.StringVar(&opt.Middlewares, prefix+"middlewares", "", "named middlewares chain (redact; sampler:first=10,thereafter=100)")
 	flag.StringVar(&opt.Pipe, prefix+"pipe", "", "log pipe (stdout/stderr/null)")
 	flag.StringVar(&opt.File, prefix+"file", "", "log file path")
 	flag.StringVar(&opt.FileMode, prefix+"file-mode", "", "log file mode (0640, 0600, 0644)")
 	flag.StringVar(&opt.Format, prefix+"format", "", "log format (json|prod/text|logfmt/tint|tinted|human/std|default)")
 	flag.StringVar(&opt.GoId, prefix+"goid", "", "force on/off goroutine id for each record (goroutine)")
+	flag.StringVar(&opt.GoParent, prefix+"goparent", "", "force on/off parent goroutine id for each record (goParent)")
+	flag.StringVar(&opt.GoLabels, prefix+"golabels", "", "force on/off pprof labels for each record (goLabels)")
+	flag.StringVar(&opt.TraceCtx, prefix+"trace-ctx", "", "force on/off W3C traceparent from context (trace_id, span_id)")
 	flag.StringVar(&opt.Id, prefix+"id", "", "force on/off id (UUID) for each record (logId)")
+	flag.StringVar(&opt.IdFormat, prefix+"id-format", "", "logId format (uuid/ulid/ksuid/snowflake/counter)")
+	flag.StringVar(&opt.IdNode, prefix+"id-node", "", "node number for snowflake logId (0...1023)")
 	flag.StringVar(&opt.Sum, prefix+"sum", "", "force on/off check sum for each record")
 	flag.StringVar(&opt.SumFull, prefix+"sum-full", "", "force on/off calculate full check sum for each record")
 	flag.StringVar(&opt.SumChain, prefix+"sum-chain", "", "force on/off check sum chain")
@@ -114,6 +152,8 @@ func NewOpt(prefixOpt ...string) *Opt {
 	flag.StringVar(&opt.SrcPkg, prefix+"src-pkg", "", "force on/off log source directory/file name and line number")
 	flag.StringVar(&opt.SrcFunc, prefix+"src-func", "", "force enable/disable functions name")
 	flag.StringVar(&opt.SrcExt, prefix+"src-ext", "", "force enable/disable show '.go' extension of source file name")
+	flag.StringVar(&opt.StackLevel, prefix+"stack-level", "", "add call stack to records at or above level (crit/error/...)")
+	flag.StringVar(&opt.StackAll, prefix+"stack-all", "", "force on/off all goroutines dump for EMERG records")
 	flag.StringVar(&opt.Color, prefix+"color", "", "force enable/disable tinted colors")
 	flag.StringVar(&opt.LevelOff, prefix+"level-off", "", "force disable/enable level output")
 	flag.StringVar(&opt.Rotate, prefix+"rotate", "", "force enable/disable log rotate")
@@ -133,6 +173,29 @@ func (opt *Opt) UpdateConf(conf *Conf) {
 	if opt.Level != "" {
 		conf.Level = opt.Level
 	}
+	if opt.Filter != "" {
+		conf.Filter = opt.Filter
+	}
+	if opt.FilterOut != "" {
+		conf.FilterOut = opt.FilterOut
+	}
+	if opt.Redact != "" {
+		conf.Redact = StringToBool(opt.Redact)
+	}
+	if opt.Limits != "" {
+		if limits, err := ParseLimits(opt.Limits); err == nil {
+			conf.Limits = limits
+		} else {
+			fmt.Fprintf(os.Stderr, "ERROR: bad log limits='%s': %v\n", opt.Limits, err)
+		}
+	}
+	if opt.Middlewares != "" {
+		if mws, err := ParseMiddlewares(opt.Middlewares); err == nil {
+			conf.Middlewares = mws
+		} else {
+			fmt.Fprintf(os.Stderr, "ERROR: bad log middlewares='%s': %v\n", opt.Middlewares, err)
+		}
+	}
 	if opt.Pipe != "" {
 		conf.Pipe = opt.Pipe
 	}
@@ -148,9 +211,24 @@ func (opt *Opt) UpdateConf(conf *Conf) {
 	if opt.GoId != "" {
 		conf.GoId = StringToBool(opt.GoId)
 	}
+	if opt.GoParent != "" {
+		conf.GoParent = StringToBool(opt.GoParent)
+	}
+	if opt.GoLabels != "" {
+		conf.GoLabels = StringToBool(opt.GoLabels)
+	}
+	if opt.TraceCtx != "" {
+		conf.TraceCtx = StringToBool(opt.TraceCtx)
+	}
 	if opt.Id != "" {
 		conf.IdOn = StringToBool(opt.Id)
 	}
+	if opt.IdFormat != "" {
+		conf.IdFormat = opt.IdFormat
+	}
+	if opt.IdNode != "" {
+		conf.IdNode = StringToInt(opt.IdNode)
+	}
 	if opt.Sum != "" {
 		conf.SumOn = StringToBool(opt.Sum)
 	}
@@ -177,6 +255,12 @@ func (opt *Opt) UpdateConf(conf *Conf) {
 	if opt.SrcExt != "" {
 		conf.SrcExt = StringToBool(opt.SrcExt)
 	}
+	if opt.StackLevel != "" {
+		conf.StackLevel = opt.StackLevel
+	}
+	if opt.StackAll != "" {
+		conf.StackAll = StringToBool(opt.StackAll)
+	}
 	if opt.Time != "" {
 		conf.TimeOff = !StringToBool(opt.Time)
 		if conf.TimeOff {
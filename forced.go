@@ -0,0 +1,113 @@
+// File: "forced.go"
+
+package xlog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog" // go>=1.21
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Принудительный уровень журналирования для отдельного запроса.
+// Контекст, созданный WithForcedLevel(), разрешает вывод записей с уровнем
+// не ниже заданного независимо от уровня логгера (включая переопределения
+// Levels и уровни Named логгеров). Учитывается методами Enabled() хендлеров
+// (IdHandler, TintHandler, обёртки стандартного логгера), поэтому работает
+// для всех форматов, но только для записей с контекстом (InfoContext,
+// DebugfContext, Log, ...). Записи, выведенные только благодаря
+// принудительному уровню, помечаются IdHandler'ом атрибутом "forced"=true
+// (входит в "logSum"), что позволяет отфильтровать их в журнале.
+// Для включения из HTTP запроса служит подписанный HMAC-SHA256 заголовок
+// (см. SignForcedLevel, ForcedLevelMiddleware).
+
+// Ключ атрибута принудительно выведенной записи в журнале
+const ForcedKey = "forced"
+
+// HTTP заголовок принудительного уровня журналирования
+const ForcedLevelHeader = "X-Log-Level"
+
+// Ключ для хранения принудительного уровня в контексте
+type forcedKey struct{}
+
+// WithForcedLevel возвращает контекст с принудительным уровнем
+// журналирования level
+func WithForcedLevel(ctx context.Context, level slog.Level) context.Context {
+	return context.WithValue(ctx, forcedKey{}, level)
+}
+
+// ForcedLevel возвращает принудительный уровень журналирования контекста.
+// Признак ok=false означает, что уровень в контексте не задан.
+func ForcedLevel(ctx context.Context) (level slog.Level, ok bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	level, ok = ctx.Value(forcedKey{}).(slog.Level)
+	return level, ok
+}
+
+// forcedEnabled проверяет, разрешён ли вывод записи уровня level
+// принудительным уровнем контекста
+func forcedEnabled(ctx context.Context, level slog.Level) bool {
+	forced, ok := ForcedLevel(ctx)
+	return ok && level >= forced
+}
+
+// signForced вычисляет подпись значения заголовка ForcedLevelHeader
+func signForced(key []byte, data string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignForcedLevel формирует значение HTTP заголовка ForcedLevelHeader
+// вида "trace:1767225600:<hmac>", действующее до момента until
+//
+//	key - секретный ключ HMAC-SHA256 (общий с ForcedLevelMiddleware)
+//	level - принудительный уровень журналирования
+//	until - срок действия заголовка
+func SignForcedLevel(key []byte, level slog.Level, until time.Time) string {
+	data := LevelToString(level) + ":" + strconv.FormatInt(until.Unix(), 10)
+	return data + ":" + signForced(key, data)
+}
+
+// ForcedLevelFromHeader проверяет подпись и срок действия HTTP заголовка
+// ForcedLevelHeader и возвращает принудительный уровень журналирования.
+// Признак ok=false означает, что заголовка нет или он недействителен.
+func ForcedLevelFromHeader(header http.Header, key []byte) (level slog.Level, ok bool) {
+	val := header.Get(ForcedLevelHeader)
+	i := strings.LastIndexByte(val, ':')
+	if i < 0 || len(key) == 0 {
+		return 0, false
+	}
+	data, sign := val[:i], val[i+1:]
+	if !hmac.Equal([]byte(sign), []byte(signForced(key, data))) {
+		return 0, false
+	}
+	lvl, until, _ := strings.Cut(data, ":")
+	sec, err := strconv.ParseInt(until, 10, 64)
+	if err != nil || time.Now().Unix() > sec {
+		return 0, false
+	}
+	return LevelFromString(lvl), true
+}
+
+// ForcedLevelMiddleware возвращает HTTP хендлер, который для запросов
+// с действительным заголовком ForcedLevelHeader (см. SignForcedLevel)
+// передаёт в next контекст с принудительным уровнем журналирования
+func ForcedLevelMiddleware(key []byte, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if level, ok := ForcedLevelFromHeader(r.Header, key); ok {
+			r = r.WithContext(WithForcedLevel(r.Context(), level))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// EOF: "forced.go"
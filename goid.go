@@ -0,0 +1,142 @@
+// File: "goid.go"
+
+package xlog
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// Идентификатор горутины определяется двумя способами:
+//
+//   - быстрый: чтение поля goid (и parentGoid) структуры runtime.g текущей
+//     горутины по смещению, найденному при калибровке (amd64 и arm64);
+//   - медленный (резервный): разбор заголовка "goroutine N [...]"
+//     результата runtime.Stack().
+//
+// Смещения полей runtime.g зависят от версии Go, поэтому они не задаются
+// константами, а ищутся один раз при первом обращении: поле должно совпасть
+// с результатом медленного способа в нескольких горутинах с разными
+// идентификаторами. Если калибровка не удалась, используется только
+// медленный способ (идентификатор родительской горутины не определяется).
+
+// Максимальное число 64-битных слов runtime.g, просматриваемых при калибровке
+// (заведомо меньше размера структуры runtime.g)
+const goScanWords = 48
+
+// Число горутин (цепочка родитель -> потомок), используемых при калибровке
+const goCalibrateDepth = 4
+
+var (
+	goOnce      sync.Once // однократная калибровка
+	goIdOff     = -1      // смещение goid в runtime.g (-1 - не найдено)
+	goParentOff = -1      // смещение parentGoid в runtime.g (-1 - не найдено)
+)
+
+// GoId возвращает идентификатор текущей горутины
+func GoId() uint64 {
+	goOnce.Do(goCalibrate)
+	if goIdOff >= 0 {
+		return *(*uint64)(unsafe.Add(getg(), goIdOff))
+	}
+	return goIdSlow()
+}
+
+// GoParentId возвращает идентификатор горутины, создавшей текущую,
+// или 0, если он не известен
+func GoParentId() uint64 {
+	goOnce.Do(goCalibrate)
+	if goParentOff >= 0 {
+		return *(*uint64)(unsafe.Add(getg(), goParentOff))
+	}
+	return 0
+}
+
+// Пул буферов для runtime.Stack (буфер "убегает" в кучу).
+// Заголовок стека с максимальным uint64 занимает 32 байта.
+var goBufPool = sync.Pool{New: func() any { return new([64]byte) }}
+
+// goIdSlow возвращает идентификатор текущей горутины разбором
+// заголовка стека "goroutine N [running]:" без выделения памяти
+func goIdSlow() uint64 {
+	buf := goBufPool.Get().(*[64]byte)
+	defer goBufPool.Put(buf)
+	n := runtime.Stack(buf[:], false)
+	const prefix = "goroutine "
+	if n <= len(prefix) || string(buf[:len(prefix)]) != prefix {
+		return 0
+	}
+	id := uint64(0)
+	for _, c := range buf[len(prefix):n] {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + uint64(c-'0')
+	}
+	return id
+}
+
+// Результат проверки одной горутины при калибровке
+type goSample struct {
+	ids     [goScanWords]bool // слова runtime.g, равные goid
+	parents [goScanWords]bool // слова runtime.g, равные goid родителя
+}
+
+// goProbe заполняет s для текущей горутины, зная идентификатор родителя
+func goProbe(s *goSample, parent uint64) {
+	g := getg()
+	id := goIdSlow()
+	for i := 0; i < goScanWords; i++ {
+		v := *(*uint64)(unsafe.Add(g, i*8))
+		s.ids[i] = v == id
+		s.parents[i] = v == parent
+	}
+}
+
+// goCalibrate ищет смещения полей goid и parentGoid в runtime.g
+func goCalibrate() {
+	if getg() == nil { // архитектура не поддерживается
+		return
+	}
+
+	// Цепочка горутин: каждая проверяет себя и запускает следующую
+	var samples [goCalibrateDepth]goSample
+	var wg sync.WaitGroup
+	var spawn func(i int, parent uint64)
+	spawn = func(i int, parent uint64) {
+		defer wg.Done()
+		goProbe(&samples[i], parent)
+		if i+1 < goCalibrateDepth {
+			wg.Add(1)
+			go spawn(i+1, goIdSlow())
+		}
+	}
+	wg.Add(1)
+	go spawn(0, goIdSlow())
+	wg.Wait()
+
+	// Искомое поле должно быть единственным совпавшим во всех горутинах
+	find := func(get func(s *goSample) []bool) int {
+		off := -1
+		for i := 0; i < goScanWords; i++ {
+			ok := true
+			for j := range samples {
+				ok = ok && get(&samples[j])[i]
+			}
+			if ok {
+				if off >= 0 {
+					return -1 // неоднозначно
+				}
+				off = i * 8
+			}
+		}
+		return off
+	}
+	goIdOff = find(func(s *goSample) []bool { return s.ids[:] })
+	if goIdOff >= 0 {
+		goParentOff = find(func(s *goSample) []bool { return s.parents[:] })
+	}
+}
+
+// EOF: "goid.go"
@@ -0,0 +1,11 @@
+// File: "goid_amd64.s"
+
+#include "textflag.h"
+
+// func getg() unsafe.Pointer
+TEXT ·getg(SB),NOSPLIT,$0-8
+	MOVQ (TLS), AX
+	MOVQ AX, ret+0(FP)
+	RET
+
+// EOF: "goid_amd64.s"
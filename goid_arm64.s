@@ -0,0 +1,11 @@
+// File: "goid_arm64.s"
+
+#include "textflag.h"
+
+// func getg() unsafe.Pointer
+TEXT ·getg(SB),NOSPLIT,$0-8
+	MOVD g, R0
+	MOVD R0, ret+0(FP)
+	RET
+
+// EOF: "goid_arm64.s"
@@ -0,0 +1,13 @@
+// File: "goid_g.go"
+//go:build amd64 || arm64
+// +build amd64 arm64
+
+package xlog
+
+import "unsafe"
+
+// getg возвращает указатель на runtime.g текущей горутины
+// (реализация на ассемблере: goid_amd64.s, goid_arm64.s)
+func getg() unsafe.Pointer
+
+// EOF: "goid_g.go"
@@ -0,0 +1,12 @@
+// File: "goid_nog.go"
+//go:build !amd64 && !arm64
+// +build !amd64,!arm64
+
+package xlog
+
+import "unsafe"
+
+// getg для прочих архитектур не реализована (используется runtime.Stack)
+func getg() unsafe.Pointer { return nil }
+
+// EOF: "goid_nog.go"
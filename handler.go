@@ -6,9 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog" // go>=1.21
-	"path"
-	"path/filepath"
-	"time"
+	"os"
 	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
 )
 
@@ -35,8 +33,32 @@ func NewHandler(conf Conf, writer io.Writer, mws ...Middleware) (
 		return NewStdHandler(conf, mws...)
 	}
 
+	// Именованные middleware (redact, pseudo, ... задают опции IdHandler)
+	conf, ms := confMiddlewares(conf)
+
 	var level slog.LevelVar
-	level.Set(LevelFromString(conf.Level))
+	base, _, rules, err := ParseLevelSpec(conf.Level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: bad log level='%s': %v\n", conf.Level, err)
+	}
+	level.Set(base)
+	levels := NewLevels(&level, rules...) // с переопределениями по пакетам
+	filters, err := NewFilters(conf.Filter, conf.FilterOut)
+	if err != nil { // ошибочный фильтр не устанавливается
+		fmt.Fprintf(os.Stderr, "ERROR: bad log filter: %v\n", err)
+	}
+	redactor := conf.Redactor
+	if redactor == nil && conf.Redact {
+		redactor = DefaultRedactor()
+	}
+	var stackLevel slog.Leveler // nil - без стека вызовов
+	if conf.StackLevel != "" {
+		if lvl, ok := lookupLevel(conf.StackLevel); ok {
+			stackLevel = lvl
+		} else { // без стека вызовов (а не для всех записей уровня по умолчанию)
+			fmt.Fprintf(os.Stderr, "ERROR: bad log stack level='%s'\n", conf.StackLevel)
+		}
+	}
 
 	if format == logFmtTint { // использовать TintHandler
 		// Выбрать формат временной метки
@@ -55,7 +77,7 @@ func NewHandler(conf Conf, writer io.Writer, mws ...Middleware) (
 
 		// Использовать Tinted Handler
 		opts := &TintOptions{
-			Level:       &level, // slog.Leveler
+			Level:       levels, // slog.Leveler
 			AddSource:   conf.Src,
 			SourcePkg:   conf.SrcPkg,
 			SourceFunc:  conf.SrcFunc,
@@ -71,7 +93,7 @@ func NewHandler(conf Conf, writer io.Writer, mws ...Middleware) (
 	} else { // использовать стандартный slog Text/JSON handler
 		opts := &slog.HandlerOptions{
 			AddSource: conf.Src,
-			Level:     &level, // slog.Leveler
+			Level:     levels, // slog.Leveler
 		}
 
 		if format == logFmtJSON {
@@ -79,7 +101,11 @@ func NewHandler(conf Conf, writer io.Writer, mws ...Middleware) (
 		}
 
 		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
-			if format == logFmtJSON {
+			// Value.Any() для чисел и времени выделяет память,
+			// поэтому типы проверяются только для значений KindAny
+			isAny := a.Value.Kind() == slog.KindAny
+
+			if isAny && format == logFmtJSON {
 				// Выдать значение complex128 в JSON журнал как строку
 				cval, ok := a.Value.Any().(complex128)
 				if ok {
@@ -87,7 +113,7 @@ func NewHandler(conf Conf, writer io.Writer, mws ...Middleware) (
 				}
 			}
 
-			if addLevels { // заменить метод String() типа slog.Level
+			if isAny && addLevels { // заменить метод String() типа slog.Level
 				level, ok := a.Value.Any().(slog.Level)
 				if ok {
 					a.Value = slog.StringValue(LevelToLabel(level))
@@ -104,10 +130,10 @@ func NewHandler(conf Conf, writer io.Writer, mws ...Middleware) (
 					return slog.Attr{}
 				}
 
-				t, ok := a.Value.Any().(time.Time)
-				if !ok {
+				if a.Value.Kind() != slog.KindTime {
 					return a // вернуть атрибут как есть (это не время)
 				}
+				t := a.Value.Time()
 
 				if !conf.TimeLocal { // вывести метку времени в UTC
 					t = t.UTC()
@@ -137,15 +163,7 @@ func NewHandler(conf Conf, writer io.Writer, mws ...Middleware) (
 					if src.File == "" { // FIX some bug if slog work as standard logger
 						return slog.Attr{}
 					}
-					if conf.SrcPkg { // directory + file name
-						dir, file := filepath.Split(src.File)
-						src.File = filepath.Join(filepath.Base(dir), file)
-					} else { // only file name
-						src.File = path.Base(src.File)
-					}
-					if !conf.SrcExt { // remove ".go" extension
-						src.File = removeGoExt(src.File)
-					}
+					src.File = trimSrcFile(src.File, conf.SrcPkg, conf.SrcExt)
 					//src.Function = getFuncName(7) // skip=7 (some magic)
 					src.Function = cropFuncName(src.Function)
 					if conf.SrcFunc { // add function name (not for JSON)
@@ -200,6 +218,13 @@ func NewHandler(conf Conf, writer io.Writer, mws ...Middleware) (
 		mws = append(ms, mws...)
 	}
 
+	if conf.Metrics != nil {
+		// Подсчитывать записи первым middleware (после logId/logSum)
+		ms := make([]Middleware, 0, len(mws)+1)
+		ms = append(ms, conf.Metrics.Middleware())
+		mws = append(ms, mws...)
+	}
+
 	// Использовать IdHandler безусловно (для полноценной работы slog.LogValuer'ов)
 	if true || conf.GoId || conf.IdOn || conf.SumOn || len(mws) != 0 {
 		// Создать дополнительный хендлер-обёртку
@@ -207,16 +232,37 @@ func NewHandler(conf Conf, writer io.Writer, mws ...Middleware) (
 		// и с заданными middleware(s)
 		idOpts := &IdOptions{
 			GoId:     conf.GoId,
+			GoParent: conf.GoParent,
+			GoLabels: conf.GoLabels,
+			TraceCtx: conf.TraceCtx,
 			LogId:    conf.IdOn,
+			IdGen:    NewIdGenerator(conf.IdFormat, conf.IdNode),
 			AddSum:   conf.SumOn,
 			SumFull:  conf.SumFull,
 			SumTime:  !conf.TimeOff,
 			SumChain: conf.SumChain,
 			SumAlone: conf.SumAlone,
+			Levels:   levels,
+			Filters:  filters,
+			Redactor: redactor,
+			Limits:   conf.Limits,
+
+			Pseudonymizer:  conf.Pseudonymizer,
+			FieldEncryptor: conf.FieldEncryptor,
+
+			StackLevel: stackLevel,
+			StackAll:   conf.StackAll,
+			StackPkg:   conf.SrcPkg,
+			StackExt:   conf.SrcExt,
 		}
 		handler = NewIdHandler(handler, idOpts, 0x00, mws...) // sum=0x00
 	}
 
+	if len(ms) != 0 {
+		// Подключить именованные middleware до вычисления logId/logSum
+		handler = NewMiddlewareHandler(handler, ms...)
+	}
+
 	if conf.AddKey != "" && conf.AddValue != nil {
 		// Обогатить вывод хендлера заданным дополнительным Key/Value
 		attr := slog.Any(conf.AddKey, slog.AnyValue(conf.AddValue))
@@ -236,14 +282,38 @@ func NewStdHandler(conf Conf, mws ...Middleware) (slog.Handler, *slog.LevelVar)
 	// Настроить стандартный (legacy) логгер
 	SetupLog(defaultLog, conf)
 
+	// Именованные middleware (redact, pseudo, ... задают опции IdHandler)
+	conf, ms := confMiddlewares(conf)
+
 	var level slog.LevelVar
-	level.Set(LevelFromString(conf.Level))
+	base, _, rules, err := ParseLevelSpec(conf.Level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: bad log level='%s': %v\n", conf.Level, err)
+	}
+	level.Set(base)
+	levels := NewLevels(&level, rules...) // с переопределениями по пакетам
+	filters, err := NewFilters(conf.Filter, conf.FilterOut)
+	if err != nil { // ошибочный фильтр не устанавливается
+		fmt.Fprintf(os.Stderr, "ERROR: bad log filter: %v\n", err)
+	}
+	redactor := conf.Redactor
+	if redactor == nil && conf.Redact {
+		redactor = DefaultRedactor()
+	}
+	var stackLevel slog.Leveler // nil - без стека вызовов
+	if conf.StackLevel != "" {
+		if lvl, ok := lookupLevel(conf.StackLevel); ok {
+			stackLevel = lvl
+		} else { // без стека вызовов (а не для всех записей уровня по умолчанию)
+			fmt.Fprintf(os.Stderr, "ERROR: bad log stack level='%s'\n", conf.StackLevel)
+		}
+	}
 
 	handler := defaultSlog.Handler() // slog.defaultHandler
 
 	// Создать дополнительный хендлер-обёртку для того, чтобы управлять
 	// уровнем логирования стандартного логгера slog
-	handler = newLvlHandler(handler, &level)
+	handler = newLvlHandler(handler, levels)
 
 	if conf.Src &&
 		conf.SrcFields != nil && len(*conf.SrcFields) != 0 {
@@ -254,22 +324,51 @@ func NewStdHandler(conf Conf, mws ...Middleware) (slog.Handler, *slog.LevelVar)
 		mws = append(ms, mws...)
 	}
 
-	if conf.GoId || conf.IdOn || conf.SumOn || len(mws) != 0 {
+	if conf.Metrics != nil {
+		// Подсчитывать записи первым middleware (после logId/logSum)
+		ms := make([]Middleware, 0, len(mws)+1)
+		ms = append(ms, conf.Metrics.Middleware())
+		mws = append(ms, mws...)
+	}
+
+	// Использовать IdHandler безусловно (переопределения уровней, Named)
+	if true || conf.GoId || conf.IdOn || conf.SumOn || len(mws) != 0 {
 		// Создать дополнительный хендлер-обёртку
 		// для добавления в журнал goroutine, logId, logSum
 		// и с заданными middleware(s)
 		idOpts := &IdOptions{
 			GoId:     conf.GoId,
+			GoParent: conf.GoParent,
+			GoLabels: conf.GoLabels,
+			TraceCtx: conf.TraceCtx,
 			LogId:    conf.IdOn,
+			IdGen:    NewIdGenerator(conf.IdFormat, conf.IdNode),
 			AddSum:   conf.SumOn,
 			SumFull:  conf.SumFull,
 			SumTime:  !conf.TimeOff,
 			SumChain: conf.SumChain,
 			SumAlone: conf.SumAlone,
+			Levels:   levels,
+			Filters:  filters,
+			Redactor: redactor,
+			Limits:   conf.Limits,
+
+			Pseudonymizer:  conf.Pseudonymizer,
+			FieldEncryptor: conf.FieldEncryptor,
+
+			StackLevel: stackLevel,
+			StackAll:   conf.StackAll,
+			StackPkg:   conf.SrcPkg,
+			StackExt:   conf.SrcExt,
 		}
 		handler = NewIdHandler(handler, idOpts, 0x00, mws...) // sum=0x00
 	}
 
+	if len(ms) != 0 {
+		// Подключить именованные middleware до вычисления logId/logSum
+		handler = NewMiddlewareHandler(handler, ms...)
+	}
+
 	if conf.AddKey != "" && conf.AddValue != nil {
 		// Обогатить вывод хендлера заданным дополнительным Key/Value
 		attr := slog.Any(conf.AddKey, slog.AnyValue(conf.AddValue))
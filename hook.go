@@ -0,0 +1,143 @@
+// File: "hook.go"
+
+package xlog
+
+import (
+	"context"
+	"log/slog" // go>=1.21
+	"sync"
+	"sync/atomic"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Хуки по уровню записей.
+// Hooks вызывает зарегистрированные функции (HookFunc) для записей
+// с уровнем не ниже заданного (по умолчанию ALERT). Вызовы выполняются
+// асинхронно в отдельной горутине: запись (копия) помещается в очередь
+// без блокировки, при переполнении очереди запись для хуков отбрасывается
+// (см. Dropped). Паника в хуке перехватывается. Таким образом хуки никогда
+// не блокируют журналирование и не влияют на результат вывода записи.
+// Middleware хуков, переданный в New(conf, mws...), видит также logId
+// и logSum записи; атрибуты With хукам не передаются.
+// Встроенный хук - уведомление через webhook (см. NewWebhook).
+
+// Размер очереди хуков по умолчанию
+const DefaultHooksQueue = 1000
+
+// HookFunc - функция хука (вызывается асинхронно)
+type HookFunc func(r slog.Record)
+
+// Hooks - набор хуков по уровню записей (см. NewHooks)
+type Hooks struct {
+	level   slog.Leveler               // минимальный уровень записей
+	hooks   atomic.Pointer[[]HookFunc] // зарегистрированные хуки
+	ch      chan slog.Record           // очередь записей
+	dropped atomic.Uint64              // число отброшенных записей
+	panics  atomic.Uint64              // число паник в хуках
+	once    sync.Once                  // однократное закрытие очереди
+	done    chan struct{}              // признак завершения горутины
+	mx      sync.RWMutex               // защита ch от записи после Close
+	closed  bool                       // признак закрытия
+}
+
+// NewHooks создаёт набор хуков и запускает горутину их вызова
+//
+//	level - минимальный уровень записей (nil - LevelAlert)
+//	queue - размер очереди записей (0 - DefaultHooksQueue)
+//	hooks - хуки (можно добавить позже методом Add)
+func NewHooks(level slog.Leveler, queue int, hooks ...HookFunc) *Hooks {
+	if level == nil {
+		level = LevelAlert
+	}
+	if queue <= 0 {
+		queue = DefaultHooksQueue
+	}
+	h := &Hooks{
+		level: level,
+		ch:    make(chan slog.Record, queue),
+		done:  make(chan struct{}),
+	}
+	hs := append([]HookFunc(nil), hooks...)
+	h.hooks.Store(&hs)
+	go h.run()
+	return h
+}
+
+// Add регистрирует хук
+func (h *Hooks) Add(fn HookFunc) {
+	for {
+		old := h.hooks.Load()
+		hs := append((*old)[:len(*old):len(*old)], fn) // всегда копия
+		if h.hooks.CompareAndSwap(old, &hs) {
+			return
+		}
+	}
+}
+
+// Dropped возвращает число записей, отброшенных из-за переполнения
+// очереди, и число паник в хуках
+func (h *Hooks) Dropped() (dropped, panics uint64) {
+	return h.dropped.Load(), h.panics.Load()
+}
+
+// Fire ставит запись в очередь хуков (без блокировки), если её уровень
+// не ниже заданного
+func (h *Hooks) Fire(r slog.Record) {
+	if r.Level < h.level.Level() {
+		return
+	}
+	h.mx.RLock()
+	defer h.mx.RUnlock()
+	if h.closed {
+		h.dropped.Add(1)
+		return
+	}
+	select {
+	case h.ch <- r.Clone():
+	default:
+		h.dropped.Add(1)
+	}
+}
+
+// Middleware возвращает Middleware хуков
+func (h *Hooks) Middleware() Middleware {
+	mwf := func(ctx context.Context, r slog.Record, next HandleFunc) error {
+		h.Fire(r)
+		return next(ctx, r)
+	}
+	return NewMiddleware(mwf)
+}
+
+// run вызывает хуки для записей из очереди
+func (h *Hooks) run() {
+	defer close(h.done)
+	for r := range h.ch {
+		for _, fn := range *h.hooks.Load() {
+			h.call(fn, r)
+		}
+	}
+}
+
+// call вызывает хук с перехватом паники
+func (h *Hooks) call(fn HookFunc, r slog.Record) {
+	defer func() {
+		if p := recover(); p != nil {
+			h.panics.Add(1)
+		}
+	}()
+	fn(r)
+}
+
+// Close обрабатывает записи, оставшиеся в очереди, и останавливает
+// горутину хуков (записи после Close отбрасываются)
+func (h *Hooks) Close() {
+	h.once.Do(func() {
+		h.mx.Lock()
+		h.closed = true
+		close(h.ch)
+		h.mx.Unlock()
+	})
+	<-h.done
+}
+
+// EOF: "hook.go"
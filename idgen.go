@@ -0,0 +1,489 @@
+// File: "idgen.go"
+
+package xlog
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Форматы идентификаторов записей в журнале ("logId")
+const (
+	IdFormatUUID      = "uuid"      // UUIDv7 (по умолчанию)
+	IdFormatULID      = "ulid"      // ULID (https://github.com/ulid/spec)
+	IdFormatKSUID     = "ksuid"     // KSUID (https://github.com/segmentio/ksuid)
+	IdFormatSnowflake = "snowflake" // Snowflake (время + узел + счётчик)
+	IdFormatCounter   = "counter"   // локальный (в пределах процесса) счётчик
+)
+
+// Ошибка: "не удалось распознать формат идентификатора записи"
+var ErrBadLogId = errors.New("unknown logId format")
+
+// IdGenerator - интерфейс генератора идентификаторов записей в журнале
+// ("logId") для IdHandler'а.
+//
+// Генератор определяет бинарное и строковое представление идентификатора,
+// а также возможность упаковки контрольной суммы (КС) в идентификатор.
+// Если КС упаковывается (Embed()=true), то она записывается в два
+// последних (младших) байта идентификатора, а в расчёт КС входят все
+// байты идентификатора кроме двух последних. Иначе в расчёт КС входит
+// весь идентификатор, а сама КС выводится отдельным атрибутом "logSum".
+type IdGenerator interface {
+	// Kind возвращает имя формата идентификатора ("uuid", "ulid", ...)
+	Kind() string
+
+	// NewId формирует новый идентификатор в бинарном виде
+	NewId() []byte
+
+	// Embed возвращает признак возможности упаковки КС в идентификатор
+	Embed() bool
+
+	// Format преобразует идентификатор в строку для журнала
+	Format(id []byte) string
+
+	// Parse преобразует строку из журнала в бинарный идентификатор
+	Parse(s string) ([]byte, error)
+
+	// Time извлекает метку времени из идентификатора
+	// (нулевое время, если формат не содержит метки времени)
+	Time(id []byte) time.Time
+}
+
+// NewIdGenerator создаёт генератор идентификаторов записей в журнале
+// по имени формата ("uuid", "ulid", "ksuid", "snowflake", "counter").
+// Регистр строки не имеет значения. Для неизвестного формата или
+// пустой строки возвращается генератор UUIDv7.
+//
+//	format - имя формата идентификатора
+//	node - номер узла для формата "snowflake" (0...1023)
+func NewIdGenerator(format string, node int) IdGenerator {
+	switch strings.ToLower(format) {
+	case IdFormatULID:
+		return ULIDGen{}
+	case IdFormatKSUID:
+		return KSUIDGen{}
+	case IdFormatSnowflake:
+		return NewSnowflakeGen(node)
+	case IdFormatCounter:
+		return NewCounterGen(0)
+	default:
+		return UUIDGen{}
+	}
+}
+
+// Встроенные генераторы в порядке распознавания строкового представления
+// идентификатора при проверке журнала (см. ParseLogId).
+// Snowflake и счётчик имеют одинаковое представление (десятичное число),
+// поэтому при проверке журнала не различаются.
+var idParsers = []IdGenerator{UUIDGen{}, ULIDGen{}, KSUIDGen{}, &SnowflakeGen{}}
+
+// ParseLogId распознаёт формат идентификатора записи в журнале и
+// возвращает генератор (для формата) и бинарное представление.
+func ParseLogId(s string) (IdGenerator, []byte, error) {
+	for _, gen := range idParsers {
+		if id, err := gen.Parse(s); err == nil {
+			return gen, id, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: %q", ErrBadLogId, s)
+}
+
+// idParser возвращает встроенный генератор по имени формата или nil
+func idParser(kind string) IdGenerator {
+	for _, gen := range idParsers {
+		if gen.Kind() == kind {
+			return gen
+		}
+	}
+	return nil
+}
+
+// idSumData возвращает часть идентификатора, учитываемую в КС
+func idSumData(gen IdGenerator, id []byte) []byte {
+	if gen.Embed() && len(id) > 2 {
+		return id[:len(id)-2]
+	}
+	return id
+}
+
+// idPutSum упаковывает КС в два последних байта идентификатора
+func idPutSum(id []byte, sum uint16) {
+	binary.BigEndian.PutUint16(id[len(id)-2:], sum)
+}
+
+// idGetSum извлекает КС из двух последних байт идентификатора
+func idGetSum(id []byte) uint16 {
+	return binary.BigEndian.Uint16(id[len(id)-2:])
+}
+
+// Максимальное значение счётчика UUIDv7 в пределах миллисекунды (12 бит rand_a)
+const uuidSeqMax = 0xFFF
+
+// Общее для всех UUIDGen состояние генератора UUIDv7
+var uuidState struct {
+	ms  int64      // время последнего идентификатора (мс)
+	seq int64      // счётчик в пределах миллисекунды
+	mx  sync.Mutex // мьютекс для безопасного доступа к ms/seq
+}
+
+// UUIDGen - генератор идентификаторов UUIDv7 (формат по умолчанию).
+//
+// Идентификаторы строго монотонно возрастают в пределах процесса
+// (RFC 9562, раздел 6.2, метод 1): поле rand_a (12 бит) содержит счётчик,
+// который обнуляется с наступлением новой миллисекунды и увеличивается
+// для каждого следующего идентификатора в той же миллисекунде.
+// При переполнении счётчика (или если системные часы пошли назад)
+// метка времени идентификатора сдвигается вперёд на 1 мс относительно
+// предыдущей. Поле rand_b заполняется случайными данными.
+//
+// Порядок записей в выходном потоке совпадает с порядком идентификаторов,
+// если вывод сериализован (один логгер или SumChain=true).
+type UUIDGen struct{}
+
+func (UUIDGen) Kind() string { return IdFormatUUID }
+func (UUIDGen) Embed() bool  { return true }
+
+func (UUIDGen) NewId() []byte {
+	uuidState.mx.Lock()
+	ms := time.Now().UnixMilli()
+	if ms <= uuidState.ms {
+		ms = uuidState.ms
+		uuidState.seq++
+		if uuidState.seq > uuidSeqMax { // счётчик исчерпан - занять следующую мс
+			ms++
+			uuidState.seq = 0
+		}
+	} else {
+		uuidState.seq = 0
+	}
+	uuidState.ms = ms
+	seq := uuidState.seq
+	uuidState.mx.Unlock()
+
+	var id uuid.UUID
+	rand.Read(id[8:])
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+	id[6] = byte(seq >> 8)
+	id[7] = byte(seq)
+	id.SetVersion(uuid.V7)
+	id.SetVariant(uuid.VariantRFC4122)
+	return id[:]
+}
+
+func (UUIDGen) Format(id []byte) string {
+	u, _ := uuid.FromBytes(id)
+	return u.String()
+}
+
+func (UUIDGen) Parse(s string) ([]byte, error) {
+	u, err := uuid.FromString(s)
+	if err != nil {
+		return nil, err
+	}
+	return u[:], nil
+}
+
+func (UUIDGen) Time(id []byte) time.Time {
+	if len(id) != 16 || id[6]>>4 != uuid.V7 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(uint48(id)))
+}
+
+// uint48 извлекает 48 бит (big endian) из начала идентификатора
+func uint48(id []byte) uint64 {
+	return uint64(id[0])<<40 | uint64(id[1])<<32 | uint64(id[2])<<24 |
+		uint64(id[3])<<16 | uint64(id[4])<<8 | uint64(id[5])
+}
+
+// Алфавит Crockford's Base32 для ULID
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGen - генератор идентификаторов ULID (16 байт: 48 бит
+// миллисекунд UNIX времени и 80 бит случайных данных).
+// Строковое представление - 26 символов в Crockford's Base32.
+type ULIDGen struct{}
+
+func (ULIDGen) Kind() string { return IdFormatULID }
+func (ULIDGen) Embed() bool  { return true }
+
+func (ULIDGen) NewId() []byte {
+	id := make([]byte, 16)
+	ms := uint64(time.Now().UnixMilli())
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+	rand.Read(id[6:])
+	return id
+}
+
+func (ULIDGen) Format(id []byte) string {
+	if len(id) != 16 {
+		return ""
+	}
+	// 128 бит кодируются 26 символами по 5 бит (старшие 2 бита - нули)
+	var dst [26]byte
+	var acc uint32 // аккумулятор бит
+	bits := 2      // первый символ содержит только 3 бита
+	j := 0
+	for _, b := range id {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			dst[j] = crockford[(acc>>bits)&0x1F]
+			j++
+		}
+	}
+	return string(dst[:])
+}
+
+func (ULIDGen) Parse(s string) ([]byte, error) {
+	if len(s) != 26 {
+		return nil, ErrBadLogId
+	}
+	id := make([]byte, 16)
+	var acc uint32
+	bits := -2 // старшие 2 бита первого символа отбрасываются
+	j := 0
+	for i := 0; i < len(s); i++ {
+		v := strings.IndexByte(crockford, upperASCII(s[i]))
+		if v < 0 || (i == 0 && v > 7) {
+			return nil, ErrBadLogId
+		}
+		acc = acc<<5 | uint32(v)
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			id[j] = byte(acc >> bits)
+			j++
+		}
+	}
+	return id, nil
+}
+
+func (ULIDGen) Time(id []byte) time.Time {
+	if len(id) != 16 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(uint48(id)))
+}
+
+// upperASCII переводит латинскую букву в верхний регистр
+func upperASCII(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// Начало эпохи KSUID (2014-05-13T16:53:20Z)
+const ksuidEpoch = 1400000000
+
+// Алфавит Base62 для KSUID
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// KSUIDGen - генератор идентификаторов KSUID (20 байт: 32 бита секунд от
+// начала эпохи KSUID и 128 бит случайных данных).
+// Строковое представление - 27 символов в Base62.
+type KSUIDGen struct{}
+
+func (KSUIDGen) Kind() string { return IdFormatKSUID }
+func (KSUIDGen) Embed() bool  { return true }
+
+func (KSUIDGen) NewId() []byte {
+	id := make([]byte, 20)
+	binary.BigEndian.PutUint32(id, uint32(time.Now().Unix()-ksuidEpoch))
+	rand.Read(id[4:])
+	return id
+}
+
+func (KSUIDGen) Format(id []byte) string {
+	if len(id) != 20 {
+		return ""
+	}
+	// Перевод из системы счисления 256 в 62 делением "в столбик"
+	num := append([]byte{}, id...)
+	var dst [27]byte
+	for i := len(dst) - 1; i >= 0; i-- {
+		rem := 0
+		for j := range num {
+			acc := rem<<8 | int(num[j])
+			num[j] = byte(acc / 62)
+			rem = acc % 62
+		}
+		dst[i] = base62[rem]
+	}
+	return string(dst[:])
+}
+
+func (KSUIDGen) Parse(s string) ([]byte, error) {
+	if len(s) != 27 {
+		return nil, ErrBadLogId
+	}
+	// Перевод из системы счисления 62 в 256 умножением "в столбик"
+	id := make([]byte, 20)
+	for i := 0; i < len(s); i++ {
+		v := strings.IndexByte(base62, s[i])
+		if v < 0 {
+			return nil, ErrBadLogId
+		}
+		carry := v
+		for j := len(id) - 1; j >= 0; j-- {
+			acc := int(id[j])*62 + carry
+			id[j] = byte(acc)
+			carry = acc >> 8
+		}
+		if carry != 0 {
+			return nil, ErrBadLogId // переполнение
+		}
+	}
+	return id, nil
+}
+
+func (KSUIDGen) Time(id []byte) time.Time {
+	if len(id) != 20 {
+		return time.Time{}
+	}
+	return time.Unix(int64(binary.BigEndian.Uint32(id))+ksuidEpoch, 0)
+}
+
+// Начало эпохи Snowflake идентификаторов (2020-01-01T00:00:00Z)
+const snowflakeEpoch = 1577836800000 // мс
+
+// Разрядность полей Snowflake идентификатора
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeNodeMax  = 1<<snowflakeNodeBits - 1
+	snowflakeSeqMax   = 1<<snowflakeSeqBits - 1
+)
+
+// SnowflakeGen - генератор идентификаторов в стиле Twitter Snowflake
+// (64 бита: 41 бит миллисекунд от 2020-01-01, 10 бит номера узла и
+// 12 бит счётчика в пределах миллисекунды).
+// Строковое представление - десятичное число.
+// КС в идентификатор не упаковывается.
+type SnowflakeGen struct {
+	node int64      // номер узла
+	ms   int64      // время последнего идентификатора (мс)
+	seq  int64      // счётчик в пределах миллисекунды
+	mx   sync.Mutex // мьютекс для безопасного доступа к ms/seq
+}
+
+// NewSnowflakeGen создаёт генератор Snowflake идентификаторов
+// с заданным номером узла (0...1023)
+func NewSnowflakeGen(node int) *SnowflakeGen {
+	return &SnowflakeGen{node: int64(node) & snowflakeNodeMax}
+}
+
+func (*SnowflakeGen) Kind() string { return IdFormatSnowflake }
+func (*SnowflakeGen) Embed() bool  { return false }
+
+func (g *SnowflakeGen) NewId() []byte {
+	g.mx.Lock()
+	ms := time.Now().UnixMilli() - snowflakeEpoch
+	if ms <= g.ms {
+		ms = g.ms
+		g.seq = (g.seq + 1) & snowflakeSeqMax
+		if g.seq == 0 { // счётчик исчерпан - занять следующую миллисекунду
+			ms++
+		}
+	} else {
+		g.seq = 0
+	}
+	g.ms = ms
+	val := ms<<(snowflakeNodeBits+snowflakeSeqBits) |
+		g.node<<snowflakeSeqBits | g.seq
+	g.mx.Unlock()
+
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, uint64(val))
+	return id
+}
+
+func (*SnowflakeGen) Format(id []byte) string { return formatUint64Id(id) }
+func (*SnowflakeGen) Parse(s string) ([]byte, error) {
+	return parseUint64Id(s)
+}
+
+func (*SnowflakeGen) Time(id []byte) time.Time {
+	if len(id) != 8 {
+		return time.Time{}
+	}
+	ms := int64(binary.BigEndian.Uint64(id) >> (snowflakeNodeBits + snowflakeSeqBits))
+	if ms == 0 { // вероятно это не Snowflake, а счётчик
+		return time.Time{}
+	}
+	return time.UnixMilli(ms + snowflakeEpoch)
+}
+
+// CounterGen - генератор идентификаторов на основе локального
+// (в пределах процесса) монотонного счётчика.
+// Строковое представление - десятичное число.
+// КС в идентификатор не упаковывается.
+type CounterGen struct {
+	cnt atomic.Uint64 // последнее выданное значение счётчика
+}
+
+// NewCounterGen создаёт генератор идентификаторов на основе счётчика
+// с заданным начальным значением (первый идентификатор будет start+1)
+func NewCounterGen(start uint64) *CounterGen {
+	g := &CounterGen{}
+	g.cnt.Store(start)
+	return g
+}
+
+func (*CounterGen) Kind() string { return IdFormatCounter }
+func (*CounterGen) Embed() bool  { return false }
+
+func (g *CounterGen) NewId() []byte {
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, g.cnt.Add(1))
+	return id
+}
+
+func (*CounterGen) Format(id []byte) string { return formatUint64Id(id) }
+func (*CounterGen) Parse(s string) ([]byte, error) {
+	return parseUint64Id(s)
+}
+
+func (*CounterGen) Time([]byte) time.Time { return time.Time{} }
+
+// formatUint64Id преобразует 64-х битный идентификатор в десятичную строку
+func formatUint64Id(id []byte) string {
+	if len(id) != 8 {
+		return ""
+	}
+	return strconv.FormatUint(binary.BigEndian.Uint64(id), 10)
+}
+
+// parseUint64Id преобразует десятичную строку в 64-х битный идентификатор
+func parseUint64Id(s string) ([]byte, error) {
+	val, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, val)
+	return id, nil
+}
+
+// EOF: "idgen.go"
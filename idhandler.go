@@ -7,12 +7,8 @@ import (
 	"fmt"
 	"log/slog" // go>=1.21
 	//"os"
-	"runtime"
-	"strconv"
-	"strings"
+	"runtime/pprof"
 	"sync"
-
-	"github.com/gofrs/uuid"
 	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
 )
 
@@ -21,11 +17,20 @@ const (
 	// Ключ идентификации горутины (если GoId=true)
 	GoKey = "goroutine"
 
+	// Ключ идентификатора родительской горутины (если GoParent=true)
+	GoParentKey = "goParent"
+
+	// Ключ группы pprof меток горутины (если GoLabels=true)
+	GoLabelsKey = "goLabels"
+
 	// Ключ UUID идентификатора записи в журнале (если LogId=true)
 	IdKey = "logId"
 
 	// Ключ контрольной суммы в журнале (если SumAlone=true)
 	SumKey = "logSum"
+
+	// Ключ имени цепочки контрольных сумм (для именованных цепочек)
+	ChainKey = "logChain"
 )
 
 // Структура конфигурации для IdHandler'а
@@ -33,9 +38,22 @@ type IdOptions struct {
 	// Добавить в журнал идентификатор горутины ("goroutine")
 	GoId bool `json:"goId"`
 
+	// Добавить в журнал идентификатор родительской горутины ("goParent")
+	GoParent bool `json:"goParent"`
+
+	// Добавить в журнал pprof метки из контекста ("goLabels")
+	GoLabels bool `json:"goLabels"`
+
+	// Добавить в журнал атрибуты W3C traceparent из контекста
+	// ("trace_id", "span_id", "trace_flags")
+	TraceCtx bool `json:"traceCtx"`
+
 	// Добавлять UUID идентификатор к каждой записи в журнале ("logId")
 	LogId bool `json:"logId"`
 
+	// Генератор идентификаторов записей (по умолчанию UUIDv7)
+	IdGen IdGenerator `json:"-"`
+
 	// Добавить подсчёт контрольной суммы (КС)
 	AddSum bool `json:"addSum"`
 
@@ -50,27 +68,145 @@ type IdOptions struct {
 
 	// Не упаковать КС в последний байт UUID, а добавить ключ "LogSum"
 	SumAlone bool `json:"sumAlone"`
+
+	// Уровни журналирования с переопределениями по пакетам и именам
+	// логгеров (nil - без переопределений)
+	Levels *Levels `json:"-"`
+
+	// Фильтры записей (nil - без фильтров), см. CompileFilter
+	Filters *Filters `json:"-"`
+
+	// Маскирование секретов (nil - без маскирования), см. NewRedactor
+	Redactor *Redactor `json:"-"`
+
+	// Псевдонимизация персональных данных (nil - без псевдонимизации),
+	// см. NewPseudonymizer
+	Pseudonymizer *Pseudonymizer `json:"-"`
+
+	// Шифрование значений атрибутов (nil - без шифрования),
+	// см. NewFieldEncryptor
+	FieldEncryptor *FieldEncryptor `json:"-"`
+
+	// Ограничения размера записей (nil - без ограничений), см. Limits
+	Limits *Limits `json:"-"`
+
+	// Минимальный уровень записей для добавления стека вызовов ("stack")
+	// (nil - без стека вызовов)
+	StackLevel slog.Leveler `json:"-"`
+
+	// Добавить дамп стеков всех горутин ("goroutines") для записей EMERG
+	StackAll bool `json:"stackAll"`
+
+	// Оставить каталог в именах файлов стека вызовов (как SrcPkg)
+	StackPkg bool `json:"stackPkg"`
+
+	// Оставить расширение ".go" в именах файлов стека вызовов (как SrcExt)
+	StackExt bool `json:"stackExt"`
 }
 
-// Структура безопасного хранения контрольной суммы
+// Структура безопасного хранения контрольной суммы.
+// В режиме SumChain записи цепочки выводятся строго по очереди:
+// вместе с logId запись получает номер в очереди вывода (take), затем
+// без блокировок вычисляется её КС, после чего запись дожидается своей
+// очереди (wait), обновляет значение цепочки и выводится, а следующая
+// запись цепочки выводится только после завершения вывода (done).
+// Так порядок записей в журнале совпадает с порядком КС и logId цепочки
+// ценой последовательного вывода записей одной цепочки; маскирование,
+// ограничения, генерация logId и расчёт КС выполняются параллельно.
 type idSum struct {
-	val uint16     // значение CRC16
-	mx  sync.Mutex // мьютекс для безопасного совместного доступа к val
+	name string     // имя цепочки контрольных сумм ("" - цепочка по умолчанию)
+	val  uint16     // значение CRC16
+	mx   sync.Mutex // мьютекс доступа к val и turn
+	cond sync.Cond  // ожидание очереди вывода (L = &mx)
+	turn uint64     // номер очереди выводимой записи
+	idMx sync.Mutex // мьютекс выдачи номеров очереди и logId
+	next uint64     // номер очереди следующей записи
+}
+
+// newIdSum создаёт цепочку контрольных сумм
+func newIdSum(name string, val uint16) *idSum {
+	s := &idSum{name: name, val: val}
+	s.cond.L = &s.mx
+	return s
+}
+
+// take выдаёт номер очереди вывода и новый идентификатор записи
+// (gen == nil - без идентификатора), чтобы logId возрастал в порядке вывода
+func (s *idSum) take(gen IdGenerator) (ticket uint64, id []byte) {
+	s.idMx.Lock()
+	defer s.idMx.Unlock()
+	if gen != nil {
+		id = gen.NewId()
+	}
+	ticket = s.next
+	s.next++
+	return ticket, id
+}
+
+// wait дожидается очереди вывода записи ticket и возвращает её КС
+// с учётом предыдущей записи цепочки (part - КС самой записи)
+func (s *idSum) wait(ticket uint64, part uint16) uint16 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for s.turn != ticket {
+		s.cond.Wait()
+	}
+	s.val ^= part
+	return s.val
+}
+
+// done передаёт очередь вывода после записи ticket следующей записи
+// цепочки (в том числе если запись не выведена из-за паники)
+func (s *idSum) done(ticket uint64) {
+	s.mx.Lock()
+	for s.turn != ticket {
+		s.cond.Wait()
+	}
+	s.turn++
+	s.mx.Unlock()
+	s.cond.Broadcast()
+}
+
+// Реестр именованных цепочек контрольных сумм, общий для всех
+// производных (With/WithGroup/WithChain) IdHandler'ов
+type idChains struct {
+	sums map[string]*idSum // цепочки по именам
+	mx   sync.Mutex        // мьютекс для безопасного доступа к sums
+}
+
+// get возвращает цепочку контрольных сумм по имени (создаёт при необходимости)
+func (c *idChains) get(name string) *idSum {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	sum, ok := c.sums[name]
+	if !ok {
+		sum = newIdSum(name, 0)
+		c.sums[name] = sum
+	}
+	return sum
 }
 
 // IdHandler - это обертка заданного slog.Handler'а для возможности
 // обогащения журнала дополнительными атрибутами (goroutine, logId, logSum).
 // Кроме того, IdHandler поддерживает Middleware для метода Handle
 // интерфейса slog.Handler.
+//
+// Состояние IdHandler'а (группы, атрибуты, valuer'ы) не изменяется после
+// создания - методы With/WithGroup/WithChain возвращают новый хендлер,
+// поэтому метод Handle не требует блокировок. Только в режиме SumChain
+// вывод записей одной цепочки упорядочивается (см. idSum).
 type IdHandler struct {
 	handler slog.Handler  // исходный (оборачиваемый) хендлер
 	opts    *IdOptions    // заданные опции для всей цепочки
 	sum     *idSum        // контрольная сумма предыдущей записи
+	chains  *idChains     // реестр именованных цепочек контрольных сумм
+	name    string        // имя логгера (атрибут "logger")
+	node    *LoggerNode   // узел именованного логгера (см. Named)
 	withSum uint16        // контрольная сумма "With" атрибутов
+	with    []slog.Attr   // корневые "With" атрибуты (для фильтров)
 	valuers []slog.Attr   // корневые атрибуты содержащие slog.LogValuer'ы
 	groups  []string      // цепочка открытых групп
 	attrs   [][]slog.Attr // атрибуты открытых групп
-	mx      sync.Mutex    // мьютекс для безопасного совместного доступа к groups/attrs
 	mws     []Middleware  // обёртки для метода Handle
 }
 
@@ -95,10 +231,12 @@ func NewIdHandler(
 	if ih, ok := handler.(*IdHandler); ok {
 		handler = ih.handler
 	}
+	sum0 := newIdSum("", sum) // цепочка по умолчанию
 	h := &IdHandler{
 		handler: handler,
 		opts:    &IdOptions{},
-		sum:     &idSum{val: sum},
+		sum:     sum0,
+		chains:  &idChains{sums: map[string]*idSum{"": sum0}},
 		withSum: uint16(0),
 		valuers: make([]slog.Attr, 0),
 		groups:  make([]string, 0),
@@ -113,53 +251,97 @@ func NewIdHandler(
 
 // Метод Enabled() реализует интерфейс slog.Handler
 func (h *IdHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return forcedEnabled(ctx, level) || h.enabled(ctx, level)
+}
+
+// enabled проверяет уровень записи без учёта принудительного уровня
+// контекста (см. WithForcedLevel)
+func (h *IdHandler) enabled(ctx context.Context, level slog.Level) bool {
+	if h.node != nil { // уровень именованного логгера (если задан)
+		if lvl, ok := h.node.Level(); ok {
+			return level >= lvl
+		}
+	}
 	return h.handler.Enabled(ctx, level)
 }
 
-// addIdAndSum обогащает запись журнала дополнительными атрибутами
-// (goroutine, logId, logSum)
-func (h *IdHandler) addIdAndSum(r *slog.Record) {
+// addAttrs добавляет к as дополнительные атрибуты записи журнала
+// (goroutine, goParent, goLabels, trace_id/span_id/trace_flags, stack,
+// logger, forced, logChain)
+func (h *IdHandler) addAttrs(ctx context.Context, r *slog.Record, as []slog.Attr) []slog.Attr {
 	if h.opts.GoId { // добавить в журнал goroutine
-		var buf [64]byte // FIXME: magic size
-		n := runtime.Stack(buf[:], false)
-		idField := strings.Fields(strings.TrimPrefix(string(buf[:n]), "goroutine "))[0]
-		goroutine, err := strconv.Atoi(idField)
-		if err == nil {
-			r.AddAttrs(slog.Int(GoKey, goroutine))
+		as = append(as, slog.Uint64(GoKey, GoId()))
+	}
+
+	if h.opts.GoParent { // добавить в журнал goParent (если известен)
+		if parent := GoParentId(); parent != 0 {
+			as = append(as, slog.Uint64(GoParentKey, parent))
 		}
 	}
 
-	var logSum uint16
-	if h.opts.LogId { // добавить в журнал logId
-		logId, _ := uuid.NewV7()
-		if h.opts.AddSum {
-			logSum = h.sum.val ^ Checksum(h.withSum,
-				h.opts.SumFull, h.opts.SumTime, *r, logId)
-			if h.opts.SumChain {
-				h.sum.val = logSum
-			}
+	if h.opts.GoLabels && ctx != nil { // добавить в журнал pprof метки
+		var labels []slog.Attr
+		pprof.ForLabels(ctx, func(key, value string) bool {
+			labels = append(labels, slog.String(key, value))
+			return true
+		})
+		if len(labels) != 0 {
+			as = append(as, slog.Attr{Key: GoLabelsKey, Value: slog.GroupValue(labels...)})
+		}
+	}
 
-			if h.opts.SumAlone { // добавить в журнал logId и logSum
-				r.AddAttrs(
-					slog.String(IdKey, logId.String()),
-					slog.String(SumKey, fmt.Sprintf("%04x", logSum)))
-			} else { // добавить в журнал только logId с logSum внутри
-				logId[14] = byte((logSum >> 8) & 0xFF)
-				logId[15] = byte(logSum & 0xFF)
-				r.AddAttrs(slog.String(IdKey, logId.String()))
-			}
-		} else { // добаить в журнал только logId без logSum
-			r.AddAttrs(slog.String(IdKey, logId.String()))
+	if h.opts.TraceCtx && ctx != nil { // добавить в журнал traceparent
+		if tp, ok := TraceFromContext(ctx); ok {
+			as = append(as, tp.Attrs()...)
+		}
+	}
+
+	if lvl := h.opts.StackLevel; lvl != nil && r.Level >= lvl.Level() {
+		// Добавить в журнал стек вызовов
+		stack, dump := recordStack(r.PC, h.opts.StackPkg, h.opts.StackExt), ""
+		if h.opts.StackAll && r.Level >= LevelEmerg {
+			dump = allGoroutines()
+		}
+		if l := h.opts.Limits; l != nil { // в пределах общего размера записи
+			stack, dump = l.stack(*r, stack, dump)
 		}
-	} else if h.opts.AddSum {
-		// Добавить в журнал только logSum
-		logSum = h.sum.val ^ Checksum(h.withSum,
-			h.opts.SumFull, h.opts.SumTime, *r, uuid.UUID{})
-		if h.opts.SumChain {
-			h.sum.val = logSum
+		if len(stack) != 0 {
+			as = append(as, slog.Any(StackKey, stack))
 		}
-		r.AddAttrs(slog.String(SumKey, fmt.Sprintf("%04x", logSum)))
+		if dump != "" {
+			as = append(as, slog.String(GoroutinesKey, dump))
+		}
+	}
+
+	if h.node != nil { // добавить в журнал имя логгера
+		as = append(as, slog.String(LoggerKey, h.name))
+	}
+
+	if h.forced(ctx, r.Level, r.PC) { // пометить принудительный вывод
+		as = append(as, slog.Bool(ForcedKey, true))
 	}
+
+	if h.sum.name != "" && h.opts.AddSum { // добавить в журнал имя цепочки
+		as = append(as, slog.String(ChainKey, h.sum.name))
+	}
+	return as
+}
+
+// addIdAndSum добавляет к as атрибуты logId и logSum
+// (id == nil - без идентификатора)
+func (h *IdHandler) addIdAndSum(as []slog.Attr, gen IdGenerator, id []byte, logSum uint16) []slog.Attr {
+	switch {
+	case id == nil: // добавить в журнал только logSum
+		as = append(as, slog.String(SumKey, fmt.Sprintf("%04x", logSum)))
+	case h.opts.SumAlone || !gen.Embed(): // добавить в журнал logId и logSum
+		as = append(as,
+			slog.String(IdKey, gen.Format(id)),
+			slog.String(SumKey, fmt.Sprintf("%04x", logSum)))
+	default: // добавить в журнал только logId с logSum внутри
+		idPutSum(id, logSum)
+		as = append(as, slog.String(IdKey, gen.Format(id)))
+	}
+	return as
 }
 
 // Добавить атрибуты в последнюю открытую группу.
@@ -179,19 +361,25 @@ func attrsAdd(as [][]slog.Attr, attrs []slog.Attr) [][]slog.Attr {
 	return bs
 }
 
-// Создать атрибут с групповым значением из всех открытых групп
+// Создать атрибут с групповым значением из всех открытых групп.
+// Списки атрибутов attrs не изменяются (могут быть общими для
+// нескольких хендлеров), вложенные группы собираются в новых слайсах.
 func groupAttr(groups []string, attrs [][]slog.Attr) slog.Attr {
-	for ix := len(attrs) - 1; ix > 0; ix-- {
+	ix := len(attrs) - 1
+	as := attrs[ix]
+	for ; ix > 0; ix-- {
 		i := ix - 1
-		attrs[i] = append(attrs[i], slog.Attr{
+		b := make([]slog.Attr, 0, len(attrs[i])+1)
+		b = append(b, attrs[i]...)
+		as = append(b, slog.Attr{
 			Key:   groups[ix],
-			Value: slog.GroupValue(attrs[ix]...),
+			Value: slog.GroupValue(as...),
 		})
 	}
 
 	return slog.Attr{
-		Key:   groups[0],                    // ключ
-		Value: slog.GroupValue(attrs[0]...), // групповое значение
+		Key:   groups[0],              // ключ
+		Value: slog.GroupValue(as...), // групповое значение
 	}
 }
 
@@ -211,25 +399,108 @@ func (h *IdHandler) middleware(ctx context.Context, r slog.Record) error {
 	return handle(ctx, r)
 }
 
+// Обогатить запись требуемыми полями (goroutine, logId, logSum)
+// и обработать цепочку middleware
+func (h *IdHandler) handle(ctx context.Context, r slog.Record) error {
+	if rd := h.opts.Redactor; rd != nil {
+		r = rd.Record(r) // замаскировать секреты до вычисления КС
+	}
+
+	if p := h.opts.Pseudonymizer; p != nil {
+		r = p.Record(r) // заменить персональные данные токенами до вычисления КС
+	}
+
+	if e := h.opts.FieldEncryptor; e != nil {
+		r = e.Record(r) // зашифровать значения атрибутов до вычисления КС
+	}
+
+	if l := h.opts.Limits; l != nil {
+		r = l.Record(r) // укоротить запись до вычисления КС
+	}
+
+	// Дополнительные атрибуты добавляются в запись одним вызовом AddAttrs,
+	// чтобы при переполнении встроенного в slog.Record массива атрибутов
+	// память выделялась один раз (независимо от числа атрибутов)
+	var buf [8]slog.Attr
+	as := h.addAttrs(ctx, &r, buf[:0])
+
+	var gen IdGenerator
+	if h.opts.LogId {
+		gen = h.opts.IdGen
+		if gen == nil {
+			gen = UUIDGen{}
+		}
+	}
+
+	if !h.opts.AddSum {
+		if gen != nil { // добаить в журнал только logId без logSum
+			as = append(as, slog.String(IdKey, gen.Format(gen.NewId())))
+		}
+		r.AddAttrs(as...)
+		return h.middleware(ctx, r)
+	}
+
+	if !h.opts.SumChain { // значение цепочки не изменяется
+		var id []byte
+		if gen != nil {
+			id = gen.NewId()
+		}
+		as = h.addIdAndSum(as, gen, id, h.sum.val^h.checksum(r, as, gen, id))
+		r.AddAttrs(as...)
+		return h.middleware(ctx, r)
+	}
+
+	// Режим SumChain: вывести запись в порядке очереди цепочки (см. idSum)
+	ticket, id := h.sum.take(gen)
+	defer h.sum.done(ticket)
+	logSum := h.sum.wait(ticket, h.checksum(r, as, gen, id))
+	r.AddAttrs(h.addIdAndSum(as, gen, id, logSum)...)
+	return h.middleware(ctx, r)
+}
+
+// checksum вычисляет КС записи r с дополнительными атрибутами as
+// без учёта предыдущей записи цепочки
+func (h *IdHandler) checksum(r slog.Record, as []slog.Attr, gen IdGenerator, id []byte) uint16 {
+	var data []byte
+	if id != nil {
+		data = idSumData(gen, id)
+	}
+	sum := ChecksumId(h.withSum, h.opts.SumFull, h.opts.SumTime, r, data)
+	if h.opts.SumFull { // КС атрибутов складываются по модулю 2 (см. ChecksumFull)
+		for _, a := range as {
+			sum ^= ChecksumAttrSlog(a.Key, a.Value)
+		}
+	}
+	return sum
+}
+
 // Метод Handle() реализует интерфейс slog.Handler
 func (h *IdHandler) Handle(ctx context.Context, r slog.Record) error {
-	if h.opts.SumChain {
-		// Захватить мьютек доступа к общей контрольной суммы до завершения вывода
-		h.sum.mx.Lock()
-		defer h.sum.mx.Unlock()
+	if !h.levelEnabled(r.Level, r.PC) && !forcedEnabled(ctx, r.Level) && !levelBypass(ctx) {
+		return nil // уровень переопределён для пакета или имени логгера
 	}
 
-	h.mx.Lock()
-	defer h.mx.Unlock()
+	if attrs := ContextAttrs(ctx); len(attrs) != 0 {
+		// Добавить атрибуты контекста (ContextWith) перед атрибутами записи
+		rCtx := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+		rCtx.AddAttrs(attrs...)
+		r.Attrs(func(attr slog.Attr) bool {
+			rCtx.AddAttrs(attr)
+			return true
+		})
+		r = rCtx
+	}
+
+	if fs := h.opts.Filters; fs.active() && !fs.match(&filterRec{
+		r: &r, name: h.name, with: h.with, groups: h.groups}) {
+		return nil // запись отброшена фильтром
+	}
 
 	if len(h.groups) == 0 && len(h.valuers) == 0 {
 		// Нет открытых групп, нет slog.LogValuer'ов.
 		// Обогатить существующую запись требуемыми полями
 		// (goroutine, logId, logSum).
-		h.addIdAndSum(&r)
-
-		// Обработать цепочку middleware
-		return h.middleware(ctx, r)
+		return h.handle(ctx, r)
 	}
 
 	// Создать новую запись
@@ -248,10 +519,7 @@ func (h *IdHandler) Handle(ctx context.Context, r slog.Record) error {
 		})
 
 		// Обогатить новую запись требуемыми полями (goroutine, logId, logSum)
-		h.addIdAndSum(&rNew)
-
-		// Обработать цепочку middleware
-		return h.middleware(ctx, rNew)
+		return h.handle(ctx, rNew)
 	}
 
 	// Получить список атрибутов из старой записи (r -> attrs)
@@ -271,17 +539,11 @@ func (h *IdHandler) Handle(ctx context.Context, r slog.Record) error {
 	rNew.AddAttrs(grpAttr)
 
 	// Обогатить новую запись требуемыми полями (goroutine, logId, logSum)
-	h.addIdAndSum(&rNew)
-
-	// Обработать цепочку middleware
-	return h.middleware(ctx, rNew)
+	return h.handle(ctx, rNew)
 }
 
 // Метод WithAttrs() реализует интерфейс slog.Handler
 func (h *IdHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	h.mx.Lock()
-	defer h.mx.Unlock()
-
 	// valuers - признак того, что в списке атрибутов найдено
 	// значение с "отложенным" вычислением (slog.LogValuer или FieldsProvider)
 	valuers := false
@@ -294,8 +556,27 @@ func (h *IdHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 		} // switch
 	} // for
 
+	name, with := h.name, h.with
+	if len(h.groups) == 0 {
+		with = append(with[:len(with):len(with)], attrs...) // всегда копия
+		for _, attr := range attrs {
+			if attr.Key == LoggerKey && attr.Value.Kind() == slog.KindString {
+				name = attr.Value.String() // имя логгера
+			}
+		}
+	}
+
 	if len(h.groups) == 0 && len(h.valuers) == 0 && !valuers {
 		// Нет открытых групп, нет slog.Valuer'ов
+		if rd := h.opts.Redactor; rd != nil {
+			attrs = rd.Attrs(attrs) // замаскировать секреты до вычисления КС
+		}
+		if p := h.opts.Pseudonymizer; p != nil {
+			attrs = p.Attrs(attrs) // заменить персональные данные токенами
+		}
+		if e := h.opts.FieldEncryptor; e != nil {
+			attrs = e.Attrs(attrs) // зашифровать значения атрибутов
+		}
 		withSum := h.withSum
 		if h.opts.SumFull {
 			for _, attr := range attrs {
@@ -307,7 +588,11 @@ func (h *IdHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 			handler: h.handler.WithAttrs(attrs),
 			opts:    h.opts,
 			sum:     h.sum,
+			chains:  h.chains,
+			name:    name,
+			node:    h.node,
 			withSum: withSum,
+			with:    with,
 			valuers: h.valuers,
 			groups:  h.groups,
 			attrs:   h.attrs,
@@ -319,7 +604,7 @@ func (h *IdHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	as := h.attrs
 
 	if valuers || len(h.valuers) != 0 {
-		vs = append(vs, attrs...)
+		vs = append(vs[:len(vs):len(vs)], attrs...) // всегда копия
 	} else { // len(h.groups) != 0
 		// Добавить атрибуты в последнюю открытую группу
 		as = attrsAdd(as, attrs)
@@ -329,7 +614,11 @@ func (h *IdHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 		handler: h.handler,
 		opts:    h.opts,
 		sum:     h.sum,
+		chains:  h.chains,
+		name:    name,
+		node:    h.node,
 		withSum: h.withSum,
+		with:    with,
 		valuers: vs,
 		groups:  h.groups,
 		attrs:   as,
@@ -343,19 +632,103 @@ func (h *IdHandler) WithGroup(name string) slog.Handler {
 		return h
 	}
 
-	h.mx.Lock()
-	defer h.mx.Unlock()
+	// Открыть новую группу (добавить пустой слайс атрибутов);
+	// слайсы родителя не изменяются (append всегда создаёт копию)
+	gs, as := h.groups, h.attrs
+	return &IdHandler{
+		handler: h.handler,
+		opts:    h.opts,
+		sum:     h.sum,
+		chains:  h.chains,
+		name:    h.name,
+		node:    h.node,
+		withSum: h.withSum,
+		with:    h.with,
+		valuers: h.valuers,
+		groups:  append(gs[:len(gs):len(gs)], name),
+		attrs:   append(as[:len(as):len(as)], []slog.Attr{}),
+		mws:     h.mws,
+	}
+}
 
-	// Открыть новую группу (добавить пустой слайс атрибутов)
+// WithChain возвращает копию хендлера, привязанную к именованной цепочке
+// контрольных сумм. Каждая цепочка имеет собственную контрольную сумму и
+// собственный мьютекс, поэтому записи разных цепочек (подсистем) не
+// сериализуются между собой, а проверить цепочку можно независимо от
+// других, даже если записи цепочек перемешаны в одном журнале.
+// Записи именованной цепочки содержат атрибут "logChain" с её именем.
+// Пустое имя соответствует цепочке по умолчанию (без атрибута "logChain").
+func (h *IdHandler) WithChain(name string) slog.Handler {
+	return &IdHandler{
+		handler: h.handler,
+		opts:    h.opts,
+		sum:     h.chains.get(name),
+		chains:  h.chains,
+		name:    h.name,
+		node:    h.node,
+		withSum: h.withSum,
+		with:    h.with,
+		valuers: h.valuers,
+		groups:  h.groups,
+		attrs:   h.attrs,
+		mws:     h.mws,
+	}
+}
+
+// levelEnabled проверяет переопределение уровня журналирования для места
+// вызова pc и имени логгера (см. Levels)
+func (h *IdHandler) levelEnabled(level slog.Level, pc uintptr) bool {
+	if h.node != nil {
+		if _, ok := h.node.Level(); ok {
+			return true // решение принято в Enabled() по уровню узла
+		}
+	}
+	lv := h.opts.Levels
+	return lv == nil || lv.Enabled(level, pc, h.name)
+}
+
+// forced проверяет, выводится ли запись только благодаря принудительному
+// уровню контекста (см. WithForcedLevel)
+func (h *IdHandler) forced(ctx context.Context, level slog.Level, pc uintptr) bool {
+	if !forcedEnabled(ctx, level) {
+		return false
+	}
+	return !h.enabled(context.Background(), level) || !h.levelEnabled(level, pc)
+}
+
+// Levels возвращает уровни журналирования с переопределениями (или nil)
+func (h *IdHandler) Levels() *Levels { return h.opts.Levels }
+
+// Filters возвращает фильтры записей (или nil)
+func (h *IdHandler) Filters() *Filters { return h.opts.Filters }
+
+// Named возвращает копию хендлера именованного логгера (см. Logger.Named).
+// Имя добавляется к имени родителя через точку, в каждую запись
+// добавляется атрибут "logger" с полным именем.
+func (h *IdHandler) Named(name string) slog.Handler {
+	if h.name != "" {
+		name = h.name + LoggerSep + name
+	}
 	return &IdHandler{
 		handler: h.handler,
 		opts:    h.opts,
 		sum:     h.sum,
+		chains:  h.chains,
+		name:    name,
+		node:    loggerNode(name),
 		withSum: h.withSum,
-		groups:  append(h.groups, name),
-		attrs:   append(h.attrs, []slog.Attr{}),
+		with:    h.with,
+		valuers: h.valuers,
+		groups:  h.groups,
+		attrs:   h.attrs,
 		mws:     h.mws,
 	}
 }
 
+// Name возвращает имя логгера хендлера
+func (h *IdHandler) Name() string { return h.name }
+
+// Chain возвращает имя цепочки контрольных сумм хендлера
+func (h *IdHandler) Chain() string { return h.sum.name }
+
 // EOF: "idhandler.go"
@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
 )
@@ -76,6 +77,10 @@ const (
 	labelSilent = "SILENT"
 )
 
+// Мьютекс для безопасного доступа к таблицам уровней
+// (таблицы пополняются функцией RegisterLevel)
+var levelMx sync.RWMutex
+
 // Таблица преобразования идентификаторов уровней
 var parseLvl = map[string]slog.Level{
 	LvlFlood:  LevelFlood,
@@ -111,7 +116,6 @@ var parseLevel = map[slog.Level]string{
 }
 
 // Обратная таблица преобразования метки уровня
-// (используется в т.ч. как пополняемая кеш таблица)
 var levelFromLabel = map[string]slog.Level{
 	labelFlood:  LevelFlood,
 	labelTrace:  LevelTrace,
@@ -131,42 +135,14 @@ var levelFromLabel = map[string]slog.Level{
 // LevelToLabel преобразует уровень логирования к строке/метке для
 // представления в журнале ("INFO", "ERROR" и др.) в стиле slog,
 // подобно одноименному методам String() типов slog.Level/slog.LevelVar.
-// Поддерживаются дополнительные уровни (TRACE, NOTICE, CRIT и др.).
+// Поддерживаются дополнительные уровни (TRACE, NOTICE, CRIT и др.),
+// а также уровни, зарегистрированные RegisterLevel().
 func LevelToLabel(level slog.Level) string {
-	str := func(base string, delta slog.Level) string {
-		if delta == 0 {
-			return base
-		}
-		return fmt.Sprintf("%s%+d", base, delta)
-	}
-	switch {
-	case level < LevelTrace:
-		return str(labelFlood, level-LevelFlood)
-	case level < LevelDebug:
-		return str(labelTrace, level-LevelTrace)
-	case level < LevelInfo:
-		return str(labelDebug, level-LevelDebug)
-	case level < LevelNotice:
-		return str(labelInfo, level-LevelInfo)
-	case level < LevelWarn:
-		return str(labelNotice, level-LevelNotice)
-	case level < LevelError:
-		return str(labelWarn, level-LevelWarn)
-	case level < LevelCrit:
-		return str(labelError, level-LevelError)
-	case level < LevelAlert:
-		return str(labelCrit, level-LevelCrit)
-	case level < LevelEmerg:
-		return str(labelAlert, level-LevelAlert)
-	case level < LevelFatal:
-		return str(labelEmerg, level-LevelEmerg)
-	case level < LevelPanic:
-		return str(labelFatal, level-LevelFatal)
-	case level < LevelSilent:
-		return str(labelPanic, level-LevelPanic)
-	default: // level >= LevelSilent
-		return str(labelSilent, level-LevelSilent)
+	l, delta := findLevelLabel(level)
+	if delta == 0 {
+		return l.label
 	}
+	return fmt.Sprintf("%s%+d", l.label, delta)
 }
 
 // LevelToColorLabel преобразует уровень логирования к строке/метке для
@@ -175,40 +151,11 @@ func LevelToLabel(level slog.Level) string {
 // заданы Format="tinted" и Color=true.
 // Поддерживаются дополнительные уровни (FLOOD, EMERG, ALERT и др.).
 func LevelToColorLabel(level slog.Level) string {
-	str := func(ansi, base string, delta slog.Level) string {
-		if delta == 0 {
-			return ansi + base + ansiReset
-		}
-		return fmt.Sprintf("%s%s%+d"+ansiReset, ansi, base, delta)
-	}
-	switch {
-	case level < LevelTrace:
-		return str(ansiFlood, labelFlood, level-LevelFlood)
-	case level < LevelDebug:
-		return str(ansiTrace, labelTrace, level-LevelTrace)
-	case level < LevelInfo:
-		return str(ansiDebug, labelDebug, level-LevelDebug)
-	case level < LevelNotice:
-		return str(ansiInfo, labelInfo, level-LevelInfo)
-	case level < LevelWarn:
-		return str(ansiNotice, labelNotice, level-LevelNotice)
-	case level < LevelError:
-		return str(ansiWarn, labelWarn, level-LevelWarn)
-	case level < LevelCrit:
-		return str(ansiError, labelError, level-LevelError)
-	case level < LevelAlert:
-		return str(ansiCrit, labelCrit, level-LevelCrit)
-	case level < LevelEmerg:
-		return str(ansiAlert, labelAlert, level-LevelAlert)
-	case level < LevelFatal:
-		return str(ansiEmerg, labelEmerg, level-LevelEmerg)
-	case level < LevelPanic:
-		return str(ansiFatal, labelFatal, level-LevelFatal)
-	case level < LevelSilent:
-		return str(ansiPanic, labelPanic, level-LevelPanic)
-	default: // level >= LevelSilent
-		return str(ansiPanic, labelSilent, level-LevelSilent)
+	l, delta := findLevelLabel(level)
+	if delta == 0 {
+		return l.ansi + l.label + ansiReset
 	}
+	return fmt.Sprintf("%s%s%+d"+ansiReset, l.ansi, l.label, delta)
 }
 
 // LevelFromString преобразует строку идентификатор уровня логирования
@@ -217,7 +164,9 @@ func LevelToColorLabel(level slog.Level) string {
 // может быть задан как строкой, так и десятичным целым числом.
 func LevelFromString(level string) slog.Level {
 	level = strings.ToLower(level)
+	levelMx.RLock()
 	lvl, ok := parseLvl[level]
+	levelMx.RUnlock()
 	if !ok {
 		i, err := strconv.Atoi(level)
 		if err != nil {
@@ -233,7 +182,9 @@ func LevelFromString(level string) slog.Level {
 // Если задан не известный уровень, то возвращается его десятичное
 // представление.
 func LevelToString(level slog.Level) string {
+	levelMx.RLock()
 	lvl, ok := parseLevel[level]
+	levelMx.RUnlock()
 	if !ok {
 		return fmt.Sprintf("%d", int(level))
 	}
@@ -245,19 +196,43 @@ func LevelToString(level slog.Level) string {
 // Входное значением может быть вида "ERROR+2", принятого в slog.
 func LevelFromLabel(label string) slog.Level {
 	label = strings.ToUpper(label)
-	level, ok := levelFromLabel[label] // поиск значения в кеше
+	levelMx.RLock()
+	level, ok := levelFromLabel[label]
+	levelMx.RUnlock()
 	if ok {
 		return level
 	}
-	for level = slog.Level(-20); level <= slog.Level(20); level++ {
-		if label == strings.ToUpper(LevelToLabel(level)) {
-			levelFromLabel[label] = level // кешировать сведения
-			return level
+	if i := strings.LastIndexAny(label, "+-"); i > 0 { // "ERROR+2"
+		levelMx.RLock()
+		base, ok := levelFromLabel[label[:i]]
+		levelMx.RUnlock()
+		if delta, err := strconv.Atoi(label[i:]); ok && err == nil {
+			level = base + slog.Level(delta)
+			if LevelToLabel(level) == label { // только каноническая форма
+				return level
+			}
 		}
 	}
 	return DefaultLevel
 }
 
+// lookupLevel разбирает уровень журналирования, заданный идентификатором
+// ("debug"), меткой ("ERROR+2") или числом. В отличие от LevelFromString
+// для неизвестного уровня возвращается признак ok=false.
+func lookupLevel(s string) (level slog.Level, ok bool) {
+	levelMx.RLock()
+	level, ok = parseLvl[strings.ToLower(s)]
+	levelMx.RUnlock()
+	if ok {
+		return level, true
+	}
+	if i, err := strconv.Atoi(s); err == nil {
+		return slog.Level(i), true
+	}
+	level = LevelFromLabel(s)
+	return level, level != DefaultLevel || strings.EqualFold(s, LevelToLabel(DefaultLevel))
+}
+
 // logAttrs функция обёртка для реализации метода LogAttr для xlog.Logger
 func logAttrs(
 	ctx context.Context, log *slog.Logger,
@@ -269,6 +244,9 @@ func logAttrs(
 
 	var pcs [1]uintptr
 	runtime.Callers(3, pcs[:]) // skip wrappers
+	if !pcEnabled(ctx, log.Handler(), level, pcs[0]) {
+		return nil // уровень переопределён для пакета или имени логгера
+	}
 
 	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
 	r.AddAttrs(attrs...)
@@ -276,6 +254,21 @@ func logAttrs(
 	return log.Handler().Handle(ctx, r)
 }
 
+// pcEnabled проверяет переопределение уровня журналирования для места
+// вызова pc до формирования записи (см. Levels, WithForcedLevel)
+func pcEnabled(
+	ctx context.Context, handler slog.Handler, level slog.Level, pc uintptr) bool {
+	if forcedEnabled(ctx, level) {
+		return true
+	}
+	if lh, ok := handler.(interface {
+		levelEnabled(level slog.Level, pc uintptr) bool
+	}); ok {
+		return lh.levelEnabled(level, pc)
+	}
+	return true
+}
+
 // logs - функция обёртка для реализации дополнительных уровней логирования
 // с использованием структурированного логирования (Log, Trace, Notice, ...).
 // Данная функция ДОЛЖНА вызываться из функций обёрток (см. "shugar.go").
@@ -289,6 +282,9 @@ func logs(
 
 	var pcs [1]uintptr
 	runtime.Callers(3, pcs[:]) // skip wrappers
+	if !pcEnabled(ctx, log.Handler(), level, pcs[0]) {
+		return nil // уровень переопределён для пакета или имени логгера
+	}
 
 	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
 	r.Add(args...)
@@ -310,6 +306,9 @@ func logf(
 
 	var pcs [1]uintptr
 	runtime.Callers(3, pcs[:]) // skip wrappers
+	if !pcEnabled(ctx, log.Handler(), level, pcs[0]) {
+		return nil // уровень переопределён для пакета или имени логгера
+	}
 
 	r := slog.NewRecord(time.Now(), level, fmt.Sprintf(format, args...), pcs[0])
 
@@ -0,0 +1,207 @@
+// File: "levelreg.go"
+
+package xlog
+
+import (
+	"fmt"
+	"log/slog" // go>=1.21
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Пользовательские уровни журналирования.
+// Кроме встроенных уровней (FLOOD...SILENT) приложение может
+// зарегистрировать собственные уровни, например:
+//
+//	xlog.RegisterLevel("audit", 6, "AUDIT", "cyan")
+//	xlog.RegisterLevel("security", 11, "SECURITY", "white-on-red")
+//
+// Зарегистрированный уровень распознаётся LevelFromString (а значит
+// в LOG_LEVEL, -log-level и спецификациях уровней), выводится своей меткой
+// в форматах JSON/Text/Tinted (с подсветкой), в контрольной сумме записей
+// и разбирается ChecksumVerify/LevelFromLabel. Промежуточные значения
+// выводятся относительно ближайшего меньшего уровня ("AUDIT+1").
+// Регистрировать уровни следует до создания логгеров (например, в init()),
+// т.к. переменные окружения и флаги разбираются при создании логгера.
+
+// Метка уровня журналирования с подсветкой
+type levelLabel struct {
+	level slog.Level // значение уровня
+	label string     // метка ("INFO")
+	ansi  string     // Escape/Ansi последовательность подсветки
+}
+
+// Таблица меток встроенных уровней (упорядочена по возрастанию уровня)
+var builtinLevelLabels = []levelLabel{
+	{LevelFlood, labelFlood, ansiFlood},
+	{LevelTrace, labelTrace, ansiTrace},
+	{LevelDebug, labelDebug, ansiDebug},
+	{LevelInfo, labelInfo, ansiInfo},
+	{LevelNotice, labelNotice, ansiNotice},
+	{LevelWarn, labelWarn, ansiWarn},
+	{LevelError, labelError, ansiError},
+	{LevelCrit, labelCrit, ansiCrit},
+	{LevelAlert, labelAlert, ansiAlert},
+	{LevelEmerg, labelEmerg, ansiEmerg},
+	{LevelFatal, labelFatal, ansiFatal},
+	{LevelPanic, labelPanic, ansiPanic},
+	{LevelSilent, labelSilent, ansiPanic},
+}
+
+// Действующая таблица меток уровней (nil - только встроенные уровни).
+// При регистрации уровня таблица заменяется целиком.
+var levelLabels atomic.Pointer[[]levelLabel]
+
+// getLevelLabels возвращает действующую таблицу меток уровней
+func getLevelLabels() []levelLabel {
+	if p := levelLabels.Load(); p != nil {
+		return *p
+	}
+	return builtinLevelLabels
+}
+
+// findLevelLabel возвращает метку ближайшего уровня, не превышающего
+// level (или самого младшего уровня), и смещение относительно него
+func findLevelLabel(level slog.Level) (levelLabel, slog.Level) {
+	labels := getLevelLabels()
+	i := sort.Search(len(labels), func(i int) bool { return labels[i].level > level })
+	if i > 0 {
+		i--
+	}
+	return labels[i], level - labels[i].level
+}
+
+// Именованные цвета для RegisterLevel
+var levelColors = map[string]string{
+	"":                 "",
+	"red":              ansiRed,
+	"green":            ansiGreen,
+	"yellow":           ansiYellow,
+	"blue":             ansiBlue,
+	"magenta":          ansiMagenta,
+	"cyan":             ansiCyan,
+	"white":            ansiWhile,
+	"bright-red":       ansiBrightRed,
+	"bright-green":     ansiBrightGreen,
+	"bright-yellow":    ansiBrightYellow,
+	"bright-blue":      ansiBrightBlue,
+	"bright-magenta":   ansiBrightMagenta,
+	"bright-cyan":      ansiBrightCyan,
+	"bright-white":     ansiBrightWight,
+	"black-on-white":   ansiBlackOnWhite,
+	"blue-on-white":    ansiBlueOnWhite,
+	"white-on-magenta": ansiWhiteOnMagenta,
+	"white-on-red":     ansiWhiteOnRed,
+}
+
+// RegisterLevel регистрирует пользовательский уровень журналирования:
+//
+//	name  - идентификатор для конфигурации ("audit", без учёта регистра);
+//	value - численное значение уровня;
+//	label - метка для вывода в журнал ("AUDIT");
+//	color - цвет метки в формате Tinted: имя ("cyan", "bright-red",
+//	        "white-on-red", ...), Escape/Ansi последовательность или "".
+//
+// Повторная регистрация того же уровня (с тем же name, value и label)
+// допустима и изменяет только цвет. Конфликт с существующими уровнями
+// (по идентификатору, значению или метке) приводит к ошибке ErrBadLevel.
+func RegisterLevel(name string, value slog.Level, label, color string) error {
+	name, label = strings.ToLower(name), strings.ToUpper(label)
+	if name == "" || label == "" ||
+		strings.ContainsAny(name, " ,=") || strings.ContainsAny(label, " +-") {
+		return fmt.Errorf("%w: name=%q label=%q", ErrBadLevel, name, label)
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("%w: numeric name %q", ErrBadLevel, name)
+	}
+	ansi, ok := levelColors[strings.ToLower(color)]
+	if !ok {
+		if color[0] != ansiEsc {
+			return fmt.Errorf("%w: unknown color %q", ErrBadLevel, color)
+		}
+		ansi = color
+	}
+
+	levelMx.Lock()
+	defer levelMx.Unlock()
+	if v, ok := parseLvl[name]; ok && v != value {
+		return fmt.Errorf("%w: name %q already used by level %d", ErrBadLevel, name, v)
+	}
+	if n, ok := parseLevel[value]; ok && n != name {
+		return fmt.Errorf("%w: level %d already registered as %q", ErrBadLevel, value, n)
+	}
+	if v, ok := levelFromLabel[label]; ok && v != value {
+		return fmt.Errorf("%w: label %q already used by level %d", ErrBadLevel, label, v)
+	}
+	old := getLevelLabels()
+	for _, l := range old {
+		if l.level == value && l.label != label {
+			return fmt.Errorf("%w: level %d already labeled %q", ErrBadLevel, value, l.label)
+		}
+	}
+	parseLvl[name], parseLevel[value], levelFromLabel[label] = value, name, value
+
+	labels := make([]levelLabel, 0, len(old)+1)
+	for _, l := range old {
+		if l.level != value {
+			labels = append(labels, l)
+		}
+	}
+	labels = append(labels, levelLabel{value, label, ansi})
+	sort.Slice(labels, func(i, j int) bool { return labels[i].level < labels[j].level })
+	levelLabels.Store(&labels)
+	return nil
+}
+
+// resetLevels отменяет регистрацию пользовательских уровней журналирования
+// (восстанавливает таблицы встроенных уровней, используется в тестах)
+func resetLevels() {
+	levelMx.Lock()
+	defer levelMx.Unlock()
+	builtin := make(map[slog.Level]bool, len(builtinLevelLabels))
+	for _, l := range builtinLevelLabels {
+		builtin[l.level] = true
+	}
+	for _, l := range getLevelLabels() {
+		if !builtin[l.level] {
+			delete(parseLvl, parseLevel[l.level])
+			delete(parseLevel, l.level)
+			delete(levelFromLabel, l.label)
+		}
+	}
+	levelLabels.Store(nil)
+}
+
+// RegisterLevels регистрирует пользовательские уровни журналирования по
+// спецификации вида "audit=6:AUDIT:cyan,security=11" (метка по умолчанию -
+// идентификатор в верхнем регистре, цвет - без подсветки), см. RegisterLevel
+func RegisterLevels(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("%w: bad level spec item %q", ErrBadLevel, item)
+		}
+		val, label, _ := strings.Cut(val, ":")
+		label, color, _ := strings.Cut(label, ":")
+		value, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("%w: bad level value %q", ErrBadLevel, val)
+		}
+		if label == "" {
+			label = name
+		}
+		if err = RegisterLevel(name, slog.Level(value), label, color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EOF: "levelreg.go"
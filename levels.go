@@ -0,0 +1,211 @@
+// File: "levels.go"
+
+package xlog
+
+import (
+	"fmt"
+	"log/slog" // go>=1.21
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Спецификация уровней журналирования имеет вид:
+//
+//	"info,github.com/acme/db=trace,http=warn"
+//
+// Элемент без "=" задаёт базовый уровень (Logger.Level), остальные
+// элементы - переопределения уровня для шаблонов. Шаблон сопоставляется:
+//
+//   - с пакетом вызывающей функции (по slog.Record.PC): пакет совпадает с
+//     шаблоном или вложен в него ("github.com/acme/db/pool");
+//   - с именем логгера (атрибут "logger"): имя совпадает с шаблоном или
+//     вложено в него ("http.client").
+//
+// При совпадении нескольких шаблонов используется самый длинный.
+
+// Ключ имени логгера в журнале
+const LoggerKey = "logger"
+
+// LevelRule - переопределение уровня журналирования для шаблона
+type LevelRule struct {
+	Pattern string     // пакет или имя логгера
+	Level   slog.Level // уровень журналирования
+}
+
+// ParseLevelSpec разбирает спецификацию уровней журналирования.
+// Признак hasBase сообщает, задан ли в спецификации базовый уровень.
+func ParseLevelSpec(spec string) (
+	base slog.Level, hasBase bool, rules []LevelRule, err error) {
+
+	base = DefaultLevel
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pattern, lvl, ok := strings.Cut(item, "=")
+		if !ok { // базовый уровень
+			base, hasBase = LevelFromString(item), true
+			continue
+		}
+		pattern, lvl = strings.TrimSpace(pattern), strings.TrimSpace(lvl)
+		if pattern == "" || lvl == "" {
+			return base, hasBase, rules, fmt.Errorf("bad level spec item %q", item)
+		}
+		rules = append(rules, LevelRule{Pattern: pattern, Level: LevelFromString(lvl)})
+	}
+	return base, hasBase, rules, nil
+}
+
+// Levels - базовый уровень журналирования с таблицей переопределений.
+// Реализует интерфейс slog.Leveler: метод Level() возвращает минимальный
+// из уровней (для быстрой отсечки в Enabled()), окончательное решение
+// принимается методом Enabled() по PC вызова и имени логгера.
+type Levels struct {
+	base  *slog.LevelVar             // базовый уровень (Logger.Level)
+	rules atomic.Pointer[levelRules] // текущая таблица переопределений
+}
+
+// Таблица переопределений с кешем сопоставлений.
+// При изменении таблица заменяется целиком (вместе с кешем).
+type levelRules struct {
+	rules []LevelRule // отсортированы по убыванию длины шаблона
+	min   slog.Level  // минимальный уровень переопределений
+	pcs   sync.Map    // кеш: PC -> индекс правила (-1 - нет совпадений)
+	names sync.Map    // кеш: имя логгера -> индекс правила
+}
+
+// Убедиться, что *Levels реализует интерфейс slog.Leveler
+var _ slog.Leveler = (*Levels)(nil)
+
+// NewLevels создаёт таблицу уровней с базовым уровнем base
+func NewLevels(base *slog.LevelVar, rules ...LevelRule) *Levels {
+	l := &Levels{base: base}
+	l.SetRules(rules...)
+	return l
+}
+
+// Level реализует интерфейс slog.Leveler
+func (l *Levels) Level() slog.Level {
+	level := l.base.Level()
+	if rs := l.rules.Load(); len(rs.rules) != 0 && rs.min < level {
+		return rs.min
+	}
+	return level
+}
+
+// Base возвращает базовый уровень журналирования
+func (l *Levels) Base() *slog.LevelVar { return l.base }
+
+// Rules возвращает копию таблицы переопределений
+func (l *Levels) Rules() []LevelRule {
+	return append([]LevelRule(nil), l.rules.Load().rules...)
+}
+
+// SetRules заменяет таблицу переопределений (безопасно во время работы)
+func (l *Levels) SetRules(rules ...LevelRule) {
+	rs := &levelRules{rules: append([]LevelRule(nil), rules...)}
+	sort.SliceStable(rs.rules, func(i, j int) bool {
+		return len(rs.rules[i].Pattern) > len(rs.rules[j].Pattern)
+	})
+	for i, r := range rs.rules {
+		if i == 0 || r.Level < rs.min {
+			rs.min = r.Level
+		}
+	}
+	l.rules.Store(rs)
+}
+
+// Set применяет спецификацию уровней. Если базовый уровень в спецификации
+// не задан, то он не изменяется.
+func (l *Levels) Set(spec string) error {
+	base, hasBase, rules, err := ParseLevelSpec(spec)
+	if err != nil {
+		return err
+	}
+	if hasBase {
+		l.base.Set(base)
+	}
+	l.SetRules(rules...)
+	return nil
+}
+
+// String возвращает спецификацию уровней
+func (l *Levels) String() string {
+	items := []string{LevelToString(l.base.Level())}
+	for _, r := range l.rules.Load().rules {
+		items = append(items, r.Pattern+"="+LevelToString(r.Level))
+	}
+	return strings.Join(items, ",")
+}
+
+// Enabled проверяет, выводится ли запись уровня level, сделанная из точки
+// pc (slog.Record.PC) логгером с именем name
+func (l *Levels) Enabled(level slog.Level, pc uintptr, name string) bool {
+	rs := l.rules.Load()
+	if len(rs.rules) == 0 {
+		return level >= l.base.Level()
+	}
+	i := rs.match(pc, name)
+	if i < 0 {
+		return level >= l.base.Level()
+	}
+	return level >= rs.rules[i].Level
+}
+
+// match возвращает индекс самого длинного совпавшего правила или -1
+func (rs *levelRules) match(pc uintptr, name string) int {
+	ip, in := -1, -1
+	if pc != 0 {
+		if v, ok := rs.pcs.Load(pc); ok {
+			ip = v.(int)
+		} else {
+			frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+			ip = rs.find(funcPackage(frame.Function), '/')
+			rs.pcs.Store(pc, ip)
+		}
+	}
+	if name != "" {
+		if v, ok := rs.names.Load(name); ok {
+			in = v.(int)
+		} else {
+			in = rs.find(name, '.')
+			rs.names.Store(name, in)
+		}
+	}
+	if ip < 0 || (in >= 0 && in <= ip) { // правила отсортированы по длине
+		return in
+	}
+	return ip
+}
+
+// find ищет первое (самое длинное) правило, шаблон которого совпадает
+// с s или является его префиксом до разделителя sep
+func (rs *levelRules) find(s string, sep byte) int {
+	if s == "" {
+		return -1
+	}
+	for i, r := range rs.rules {
+		p := r.Pattern
+		if s == p || (strings.HasPrefix(s, p) && s[len(p)] == sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// funcPackage возвращает путь пакета по полному имени функции
+// (например, "github.com/acme/db.(*Pool).Get" -> "github.com/acme/db")
+func funcPackage(fn string) string {
+	slash := strings.LastIndexByte(fn, '/') + 1
+	if dot := strings.IndexByte(fn[slash:], '.'); dot >= 0 {
+		return fn[:slash+dot]
+	}
+	return fn
+}
+
+// EOF: "levels.go"
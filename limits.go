@@ -0,0 +1,418 @@
+// File: "limits.go"
+
+package xlog
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log/slog" // go>=1.21
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Ограничения размера записей журнала.
+// Limits задаёт максимальные размеры элементов записи (0 - без ограничения):
+//
+//	Message - длина текста сообщения (байт)
+//	Value   - длина строкового значения атрибута (байт); значения []byte,
+//	          ошибки, структуры, карты и слайсы, размер которых превышает
+//	          ограничение, заменяются укороченной строкой (см. Sprint)
+//	Attrs   - число атрибутов записи (верхнего уровня)
+//	Depth   - глубина вложенности групп и структур
+//	Size    - приблизительный общий размер записи (сообщение и атрибуты)
+//
+// Укороченные строки завершаются маркером "…(+1234 bytes)", слишком
+// глубокие группы и структуры заменяются строкой "…(depth)", а число
+// отброшенных атрибутов (по Attrs и Size) выводится в атрибуте "logTrunc".
+// Токены псевдонимизации ("pii:...") и зашифрованные значения ("enc:...")
+// не укорачиваются (иначе их нельзя сопоставить или расшифровать):
+// превышающие ограничение атрибуты с такими значениями отбрасываются
+// и также учитываются в "logTrunc".
+// IdHandler (Conf.Limits) применяет ограничения до форматирования и до
+// вычисления контрольной суммы, поэтому результат одинаков для форматов
+// JSON, logfmt и tinted. Атрибуты With не ограничиваются.
+// Стек вызовов ("stack") и дамп стеков горутин ("goroutines") ограничиваются
+// остатком общего размера записи (Size): лишние кадры стека отбрасываются
+// с конца, дамп укорачивается с маркером.
+// Число укороченных записей возвращает метод Truncated().
+
+// Ключ числа отброшенных атрибутов записи (см. Limits)
+const TruncKey = "logTrunc"
+
+// Маркер слишком глубокой вложенности групп и структур
+const TruncDepth = "…(depth)"
+
+// Limits - ограничения размера записей журнала (см. ParseLimits)
+type Limits struct {
+	Message int `json:"message"` // максимальная длина сообщения
+	Value   int `json:"value"`   // максимальная длина значения атрибута
+	Attrs   int `json:"attrs"`   // максимальное число атрибутов записи
+	Depth   int `json:"depth"`   // максимальная глубина вложенности
+	Size    int `json:"size"`    // максимальный общий размер записи
+
+	truncated atomic.Uint64 // число укороченных записей
+}
+
+// ParseLimits разбирает ограничения размера записей, заданные строкой
+// вида "message=1024,value=4096,attrs=64,depth=8,size=65536"
+// (ключ "msg" - синоним "message", значения - целые числа >= 0).
+// Пустая строка означает отсутствие ограничений (nil).
+func ParseLimits(spec string) (*Limits, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	l := &Limits{}
+	for _, item := range strings.Split(spec, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(item), "=")
+		n, err := strconv.Atoi(strings.TrimSpace(val))
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("bad limit %q", item)
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "msg", "message":
+			l.Message = n
+		case "value":
+			l.Value = n
+		case "attrs":
+			l.Attrs = n
+		case "depth":
+			l.Depth = n
+		case "size":
+			l.Size = n
+		default:
+			return nil, fmt.Errorf("unknown limit %q", key)
+		}
+	}
+	return l, nil
+}
+
+// String возвращает ограничения в формате ParseLimits
+func (l *Limits) String() string {
+	return fmt.Sprintf("message=%d,value=%d,attrs=%d,depth=%d,size=%d",
+		l.Message, l.Value, l.Attrs, l.Depth, l.Size)
+}
+
+// Truncated возвращает число укороченных записей
+func (l *Limits) Truncated() uint64 { return l.truncated.Load() }
+
+// truncString укорачивает строку до max байт (по границе символа UTF-8)
+// и добавляет маркер "…(+N bytes)"
+func truncString(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…(+" + strconv.Itoa(len(s)-n) + " bytes)"
+}
+
+// opaqueString проверяет, что строка - токен псевдонимизации или
+// зашифрованное значение (такие строки не укорачиваются)
+func opaqueString(s string) bool {
+	if _, ok := PseudoKeyId(s); ok {
+		return true
+	}
+	return strings.HasPrefix(s, FieldEncPrefix) && fieldEncRe.FindString(s) == s
+}
+
+// Record применяет ограничения к записи (возвращает исходную запись,
+// если ограничения не нарушены)
+func (l *Limits) Record(r slog.Record) slog.Record {
+	msg := truncString(r.Message, l.Message)
+	msg = truncString(msg, l.Size)
+	changed := msg != r.Message
+	size := len(msg)
+
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	dropped := 0
+	limited := false // отброшен атрибут по Attrs или Size
+	r.Attrs(func(a slog.Attr) bool {
+		if limited || (l.Attrs > 0 && len(attrs) >= l.Attrs) {
+			limited = true // после первого отброшенного атрибута отбросить все
+			dropped++
+			return true
+		}
+		a, ch, ok := l.attr(a, 1, &dropped)
+		if !ok {
+			return true
+		}
+		if l.Size > 0 {
+			n := len(a.Key) + 4 + valueSize(a.Value, l.Size)
+			if size+n > l.Size { // попытаться укоротить строку под остаток
+				rest := l.Size - size - len(a.Key) - 4
+				if a.Value.Kind() != slog.KindString || rest <= 0 ||
+					opaqueString(a.Value.String()) {
+					limited = true
+					dropped++
+					return true
+				}
+				a.Value = slog.StringValue(truncString(a.Value.String(), rest))
+				ch = true
+				n = l.Size - size
+			}
+			size += n
+		}
+		changed = changed || ch
+		attrs = append(attrs, a)
+		return true
+	})
+
+	if !changed && dropped == 0 {
+		return r
+	}
+	l.truncated.Add(1)
+	rNew := slog.NewRecord(r.Time, r.Level, msg, r.PC)
+	rNew.AddAttrs(attrs...)
+	if dropped != 0 {
+		rNew.AddAttrs(slog.Int(TruncKey, dropped))
+	}
+	return rNew
+}
+
+// attr применяет ограничения Value и Depth к атрибуту на глубине depth.
+// Признак ok=false означает, что атрибут отброшен (учтён в dropped).
+func (l *Limits) attr(a slog.Attr, depth int, dropped *int) (_ slog.Attr, changed, ok bool) {
+	v := a.Value
+	if v.Kind() == slog.KindLogValuer {
+		v = v.Resolve()
+	}
+
+	switch v.Kind() {
+	case slog.KindString:
+		if s := truncString(v.String(), l.Value); len(s) != len(v.String()) {
+			if opaqueString(v.String()) { // токен не укорачивается
+				*dropped++
+				return a, true, false
+			}
+			return slog.String(a.Key, s), true, true
+		}
+
+	case slog.KindGroup:
+		if l.Depth > 0 && depth > l.Depth {
+			return slog.String(a.Key, TruncDepth), true, true
+		}
+		group := v.Group()
+		var as []slog.Attr // nil - без изменений
+		for i, ga := range group {
+			ga, ch, ok := l.attr(ga, depth+1, dropped)
+			if ch && as == nil {
+				as = append(make([]slog.Attr, 0, len(group)), group[:i]...)
+			}
+			if as != nil && ok {
+				as = append(as, ga)
+			}
+		}
+		if as != nil {
+			return slog.Attr{Key: a.Key, Value: slog.GroupValue(as...)}, true, true
+		}
+
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case []byte: // укороченные данные выводятся строкой с маркером
+			if l.Value > 0 && len(x) > l.Value {
+				return slog.String(a.Key, truncString(string(x), l.Value)), true, true
+			}
+			return a, false, true
+		case error:
+			if s := x.Error(); l.Value > 0 && len(s) > l.Value {
+				return slog.String(a.Key, truncString(s, l.Value)), true, true
+			}
+			return a, false, true
+		case json.Marshaler, encoding.TextMarshaler:
+			return a, false, true // сериализуется собственным методом
+		}
+		rv := reflect.ValueOf(v.Any())
+		if !anyComposite(rv) {
+			return a, false, true
+		}
+		budget := l.Value
+		if budget <= 0 {
+			budget = l.Size
+		}
+		size, deep := anySize(rv, depth, l.Depth, budget)
+		if deep {
+			return slog.String(a.Key, TruncDepth), true, true
+		}
+		if l.Value > 0 && size > l.Value {
+			return slog.String(a.Key, truncString(safeSprint(v.Any()), l.Value)), true, true
+		}
+	}
+
+	if v.Kind() != a.Value.Kind() { // значение slog.LogValuer уже вычислено
+		return slog.Attr{Key: a.Key, Value: v}, false, true
+	}
+	return a, false, true
+}
+
+// safeSprint - Sprint с защитой от паники (например при неэкспортируемых
+// полях вложенных структур)
+func safeSprint(v any) (s string) {
+	defer func() {
+		if p := recover(); p != nil {
+			s = fmt.Sprintf("%+v", v)
+		}
+	}()
+	return Sprint(v)
+}
+
+// anyComposite проверяет, что значение - структура, карта или слайс
+// (возможно по указателю)
+func anyComposite(rv reflect.Value) bool {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// anySize приблизительно оценивает размер значения с помощью рефлексии
+// (оценка прекращается при превышении budget > 0) и проверяет глубину
+// вложенности структур, карт и слайсов (maxDepth > 0)
+func anySize(rv reflect.Value, depth, maxDepth, budget int) (size int, deep bool) {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return 3, false
+		}
+		rv = rv.Elem()
+	}
+	add := func(v reflect.Value) bool { // false - прекратить оценку
+		n, d := anySize(v, depth+1, maxDepth, budget-size)
+		size += n + 2
+		deep = deep || d
+		return !deep && (budget <= 0 || size <= budget)
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return len(rv.String()) + 2, false
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if maxDepth > 0 && depth > maxDepth {
+			return 0, true
+		}
+	default:
+		return 8, false
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < rv.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() {
+				size += len(f.Name)
+				if !add(rv.Field(i)) {
+					break
+				}
+			}
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			size += len(Sprint(iter.Key().Interface()))
+			if !add(iter.Value()) {
+				break
+			}
+		}
+	default: // reflect.Slice, reflect.Array
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Len() * 2, false // []byte выводится в base64/hex
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if !add(rv.Index(i)) {
+				break
+			}
+		}
+	}
+	return size + 2, deep
+}
+
+// valueSize приблизительно оценивает размер значения атрибута
+// (оценка структур прекращается при превышении budget > 0)
+func valueSize(v slog.Value, budget int) int {
+	switch v.Kind() {
+	case slog.KindString:
+		return len(v.String()) + 2
+	case slog.KindTime:
+		return 32
+	case slog.KindGroup:
+		size := 2
+		for _, a := range v.Group() {
+			size += len(a.Key) + 4 + valueSize(a.Value, budget)
+		}
+		return size
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case []byte:
+			return len(x)*4/3 + 2
+		case error:
+			return len(x.Error()) + 2
+		}
+		if rv := reflect.ValueOf(v.Any()); anyComposite(rv) {
+			size, _ := anySize(rv, 0, 0, budget)
+			return size
+		}
+	}
+	return 8
+}
+
+// stack ограничивает стек вызовов и дамп стеков горутин, добавляемые
+// к записи r (после применения ограничений), остатком общего размера
+// записи (Size)
+func (l *Limits) stack(r slog.Record, stack Stack, dump string) (Stack, string) {
+	if l.Size <= 0 {
+		return stack, dump
+	}
+	rest := l.Size - len(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		rest -= len(a.Key) + 4 + valueSize(a.Value, l.Size)
+		return true
+	})
+
+	if len(stack) != 0 {
+		size := len(StackKey) + 4 + 2
+		for i, f := range stack {
+			n := valueSize(slog.AnyValue(f), 0) + 2
+			if size+n > rest {
+				stack = stack[:i]
+				break
+			}
+			size += n
+		}
+		if len(stack) != 0 {
+			rest -= size
+		}
+	}
+
+	if dump != "" {
+		rest -= len(GoroutinesKey) + 4 + 2
+		dump = truncString(dump, max(rest, 1))
+		if rest <= 0 {
+			dump = ""
+		}
+	}
+	return stack, dump
+}
+
+// Middleware возвращает Middleware ограничения размера записей.
+// Middleware видит только атрибуты записи; для согласованного вычисления
+// контрольных сумм следует использовать Conf.Limits.
+func (l *Limits) Middleware() Middleware {
+	mwf := func(ctx context.Context, r slog.Record, next HandleFunc) error {
+		return next(ctx, l.Record(r))
+	}
+	return NewMiddleware(mwf)
+}
+
+// EOF: "limits.go"
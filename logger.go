@@ -3,7 +3,10 @@
 package xlog
 
 import (
+	"fmt"
 	"log/slog" // go>=1.21
+	"os"
+	"strings"
 	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
 )
 
@@ -64,13 +67,75 @@ func (c *Logger) GetLvl() string { return LevelToString(c.GetLevel()) }
 func GetLvl() string { return currentClog.GetLvl() }
 
 // SetLvl обновляет уровень логирования на основе строки идентификатора
-// типа "trace", "error" и т.п.
-func (c *Logger) SetLvl(level string) { c.SetLevel(LevelFromString(level)) }
+// типа "trace", "error" и т.п. Допускается спецификация уровней
+// с переопределениями вида "info,github.com/acme/db=trace,http=warn"
+// (см. SetLevelSpec). Ошибка спецификации выводится в stderr;
+// для проверки спецификации используйте SetLevelSpec.
+func (c *Logger) SetLvl(level string) {
+	if strings.ContainsAny(level, ",=") {
+		if err := c.SetLevelSpec(level); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: bad log level='%s': %v\n", level, err)
+		}
+		return
+	}
+	c.SetLevel(LevelFromString(level))
+}
 
 // SetLvl обновляет уровень логирования глобального логгера на
 // основе строки идентификатора типа "trace", "error" и т.п.
 func SetLvl(level string) { currentClog.SetLvl(level) }
 
+// levelsHandler - интерфейс slog.Handler'а с поддержкой переопределения
+// уровней журналирования по пакетам и именам логгеров (см. Levels)
+type levelsHandler interface {
+	Levels() *Levels
+}
+
+// Levels возвращает уровни журналирования с переопределениями
+// или nil, если хендлер логгера их не поддерживает
+func (c *Logger) Levels() *Levels {
+	if lh, ok := c.Handler().(levelsHandler); ok {
+		return lh.Levels()
+	}
+	return nil
+}
+
+// SetLevelSpec применяет спецификацию уровней журналирования вида
+// "info,github.com/acme/db=trace,http=warn" (см. ParseLevelSpec).
+// Таблица переопределений заменяется целиком.
+func (c *Logger) SetLevelSpec(spec string) error {
+	if lv := c.Levels(); lv != nil {
+		return lv.Set(spec)
+	}
+	base, hasBase, rules, err := ParseLevelSpec(spec)
+	if err != nil {
+		return err
+	}
+	if len(rules) != 0 {
+		return ErrNoLevels
+	}
+	if hasBase {
+		c.SetLevel(base)
+	}
+	return nil
+}
+
+// SetLevelSpec применяет спецификацию уровней журналирования
+// для глобального логгера
+func SetLevelSpec(spec string) error { return currentClog.SetLevelSpec(spec) }
+
+// GetLevelSpec возвращает спецификацию уровней журналирования
+func (c *Logger) GetLevelSpec() string {
+	if lv := c.Levels(); lv != nil {
+		return lv.String()
+	}
+	return c.GetLvl()
+}
+
+// GetLevelSpec возвращает спецификацию уровней журналирования
+// глобального логгера
+func GetLevelSpec() string { return currentClog.GetLevelSpec() }
+
 // Rotate производит ротацию файла журнала (если это возможно) -
 // обёртка для вызова c.Writer.Rotable()/c.Writer.Rotate().
 // К примеру, в реальных приложениях возможна организации ротация
@@ -175,6 +240,33 @@ func WithGroup(name string) *Logger {
 	return currentClog.WithGroup(name)
 }
 
+// chainHandler - интерфейс slog.Handler'а с поддержкой именованных
+// цепочек контрольных сумм (см. IdHandler.WithChain)
+type chainHandler interface {
+	WithChain(name string) slog.Handler
+}
+
+// WithChain создает дочерний логгер, привязанный к именованной цепочке
+// контрольных сумм (см. IdHandler.WithChain). Если хендлер логгера не
+// поддерживает цепочки, то возвращается исходный логгер.
+func (c *Logger) WithChain(name string) *Logger {
+	ch, ok := c.Handler().(chainHandler)
+	if !ok {
+		return c
+	}
+	return &Logger{
+		Logger: slog.New(ch.WithChain(name)),
+		Level:  c.Level,
+		Writer: c.Writer,
+	}
+}
+
+// WithChain создает дочерний логгер, привязанный к именованной цепочке
+// контрольных сумм, на основе глобального логгера
+func WithChain(name string) *Logger {
+	return currentClog.WithChain(name)
+}
+
 // WithMiddleware создает дочерний логгер c добавлением Middleware
 func (c *Logger) WithMiddleware(mws ...Middleware) *Logger {
 	if len(mws) == 0 {
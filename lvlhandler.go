@@ -28,8 +28,8 @@ func newLvlHandler(handler slog.Handler, leveler slog.Leveler) slog.Handler {
 }
 
 // Enabled() требуется для интерфейса slog.Handler
-func (h *lvlHandler) Enabled(_ context.Context, level slog.Level) bool {
-	return level >= h.leveler.Level()
+func (h *lvlHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.leveler.Level() || forcedEnabled(ctx, level)
 }
 
 // Handle() требуется для интерфейса slog.Handler
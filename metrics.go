@@ -0,0 +1,387 @@
+// File: "metrics.go"
+
+package xlog
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"log/slog" // go>=1.21
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Метрики журнала.
+// Metrics подсчитывает записи по уровням, именам логгеров (Named) и местам
+// вызова, а также число записей, байт и ошибок записи по направлениям
+// вывода (stdout/stderr, file, writer). Счётчики атомарные, на "горячем"
+// пути блокировки не используются (карты счётчиков - sync.Map, новые
+// ключи добавляются однократно). Метрики доступны через expvar
+// (Metrics.Publish) и в текстовом формате Prometheus (Metrics.ServeHTTP,
+// WritePrometheus), без сторонних библиотек.
+// Проще всего подключить метрики полем Conf.Metrics: тогда Middleware
+// подсчёта записей (видит имя логгера, записи отброшенные фильтрами
+// и уровнями не считаются) и обёртка писателя по направлениям вывода
+// добавляются автоматически.
+
+// Префикс имён метрик Prometheus
+const MetricsPrefix = "xlog_"
+
+// Максимальное число отслеживаемых мест вызова по умолчанию
+const DefaultMetricsMaxSites = 1000
+
+// Метка места вызова записей сверх лимита MaxSites
+const metricsOtherSite = "other"
+
+// Диапазон уровней с фиксированными счётчиками [-32, 32)
+const metricsLevelOffset = 32
+
+// Metrics - метрики журнала (см. NewMetrics)
+type Metrics struct {
+	// Максимальное число отслеживаемых мест вызова
+	// (по умолчанию DefaultMetricsMaxSites)
+	MaxSites int
+
+	levels   [2 * metricsLevelOffset]atomic.Uint64 // записи по уровням
+	others   sync.Map                              // прочие уровни: slog.Level -> *atomic.Uint64
+	names    sync.Map                              // имя логгера -> *atomic.Uint64
+	sites    sync.Map                              // PC -> *atomic.Uint64
+	nsites   atomic.Int64                          // число мест вызова
+	overflow atomic.Uint64                         // записи сверх лимита MaxSites
+	sinks    sync.Map                              // имя направления -> *SinkStats
+}
+
+// SinkStats - счётчики направления вывода журнала
+type SinkStats struct {
+	Writes atomic.Uint64 // число вызовов Write
+	Bytes  atomic.Uint64 // число записанных байт
+	Errors atomic.Uint64 // число ошибок записи
+}
+
+// NewMetrics создаёт метрики журнала
+func NewMetrics() *Metrics {
+	return &Metrics{MaxSites: DefaultMetricsMaxSites}
+}
+
+// maxSites возвращает максимальное число отслеживаемых мест вызова
+func (m *Metrics) maxSites() int {
+	if m.MaxSites <= 0 {
+		return DefaultMetricsMaxSites
+	}
+	return m.MaxSites
+}
+
+// counter возвращает счётчик из карты m по ключу key (создаёт при
+// необходимости)
+func counter(m *sync.Map, key any) *atomic.Uint64 {
+	if c, ok := m.Load(key); ok {
+		return c.(*atomic.Uint64)
+	}
+	c, _ := m.LoadOrStore(key, new(atomic.Uint64))
+	return c.(*atomic.Uint64)
+}
+
+// Count учитывает запись журнала логгера с именем name
+func (m *Metrics) Count(r slog.Record, name string) {
+	if i := int(r.Level) + metricsLevelOffset; i >= 0 && i < len(m.levels) {
+		m.levels[i].Add(1)
+	} else {
+		counter(&m.others, r.Level).Add(1)
+	}
+
+	if name != "" {
+		counter(&m.names, name).Add(1)
+	}
+
+	if r.PC != 0 {
+		if c, ok := m.sites.Load(r.PC); ok {
+			c.(*atomic.Uint64).Add(1)
+		} else if m.nsites.Load() < int64(m.maxSites()) {
+			c, loaded := m.sites.LoadOrStore(r.PC, new(atomic.Uint64))
+			if !loaded {
+				m.nsites.Add(1)
+			}
+			c.(*atomic.Uint64).Add(1)
+		} else {
+			m.overflow.Add(1)
+		}
+	}
+}
+
+// Middleware возвращает Middleware подсчёта записей. Имя логгера
+// берётся из атрибута "logger", поэтому Middleware следует передавать
+// в New(conf, mws...) (или использовать Conf.Metrics).
+func (m *Metrics) Middleware() Middleware {
+	mwf := func(ctx context.Context, r slog.Record, next HandleFunc) error {
+		m.Count(r, recordLogger(r))
+		return next(ctx, r)
+	}
+	return NewMiddleware(mwf)
+}
+
+// Sink возвращает счётчики направления вывода (создаёт при необходимости)
+func (m *Metrics) Sink(name string) *SinkStats {
+	if s, ok := m.sinks.Load(name); ok {
+		return s.(*SinkStats)
+	}
+	s, _ := m.sinks.LoadOrStore(name, new(SinkStats))
+	return s.(*SinkStats)
+}
+
+// Писатель с подсчётом записанных байт и ошибок
+type metricsWriter struct {
+	w     io.Writer
+	stats *SinkStats
+}
+
+// Write реализует интерфейс io.Writer
+func (w metricsWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.stats.Writes.Add(1)
+	w.stats.Bytes.Add(uint64(n))
+	if err != nil {
+		w.stats.Errors.Add(1)
+	}
+	return n, err
+}
+
+// Writer возвращает обёртку io.Writer с подсчётом записанных байт и ошибок
+// для направления вывода sink
+func (m *Metrics) Writer(sink string, w io.Writer) io.Writer {
+	return metricsWriter{w: w, stats: m.Sink(sink)}
+}
+
+// Писатель логов с подсчётом метрик по направлениям вывода
+// (ротация и закрытие выполняются исходным писателем)
+type metricsSinksWriter struct {
+	Writer                 // исходный писатель
+	sinks  []metricsWriter // направления вывода
+}
+
+// Write пишет во все направления вывода. Как и у исходного писателя,
+// ошибка возвращается только по результату записи в последнее направление.
+func (w metricsSinksWriter) Write(b []byte) (n int, err error) {
+	for _, s := range w.sinks {
+		n, err = s.Write(b)
+	}
+	return n, err
+}
+
+// pipeName возвращает имя канала (stdout/stderr)
+func pipeName(pipe *os.File) string {
+	if pipe == os.Stderr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// Instrument возвращает писатель логов с подсчётом метрик по направлениям
+// вывода ("stdout", "stderr", "file", "writer")
+func (m *Metrics) Instrument(writer Writer) Writer {
+	var ws []io.Writer
+	var names []string
+	add := func(name string, w io.Writer) {
+		names, ws = append(names, name), append(ws, w)
+	}
+	switch w := writer.(type) {
+	case nullWriter, metricsSinksWriter:
+		return writer
+	case pipeWriter:
+		add(pipeName(w.File), w.File)
+	case fileWriter:
+		add("file", w.File)
+	case rotatableWriter:
+		add("file", w.Logger)
+	case customWriter:
+		add("writer", w.Writer)
+	case pipeAndFileWriter:
+		add(pipeName(w.Pipe), w.Pipe)
+		add("file", w.File)
+	case pipeAndRotatableWriter:
+		add(pipeName(w.Pipe), w.Pipe)
+		add("file", w.Logger)
+	case pipeAndCustomWriter:
+		add(pipeName(w.Pipe), w.Pipe)
+		add("writer", w.Writer)
+	case fileAndCustomWriter:
+		add("file", w.File)
+		add("writer", w.Writer)
+	case rotatableAndCustomWriter:
+		add("file", w.Logger)
+		add("writer", w.Writer)
+	case pipeAndFileAndCustomWriter:
+		add(pipeName(w.Pipe), w.Pipe)
+		add("file", w.File)
+		add("writer", w.Writer)
+	case pipeAndRotatableAndCustomWriter:
+		add(pipeName(w.Pipe), w.Pipe)
+		add("file", w.Logger)
+		add("writer", w.Writer)
+	default:
+		add("writer", writer)
+	}
+	mw := metricsSinksWriter{Writer: writer}
+	for i, w := range ws {
+		mw.sinks = append(mw.sinks, metricsWriter{w: w, stats: m.Sink(names[i])})
+	}
+	return mw
+}
+
+// MetricsSnapshot - снимок метрик журнала
+type MetricsSnapshot struct {
+	Levels  map[string]uint64    `json:"levels"`  // записи по уровням
+	Loggers map[string]uint64    `json:"loggers"` // записи по именам логгеров
+	Sites   map[string]uint64    `json:"sites"`   // записи по местам вызова
+	Sinks   map[string]SinkCount `json:"sinks"`   // направления вывода
+}
+
+// SinkCount - значения счётчиков направления вывода
+type SinkCount struct {
+	Writes uint64 `json:"writes"`
+	Bytes  uint64 `json:"bytes"`
+	Errors uint64 `json:"errors"`
+}
+
+// metricsSite возвращает метку места вызова ("pkg/file.go:42 func")
+func metricsSite(pc uintptr) (site, fn string) {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	file := filepath.Base(filepath.Dir(frame.File)) + "/" + filepath.Base(frame.File)
+	return file + ":" + strconv.Itoa(frame.Line), frame.Function
+}
+
+// Snapshot возвращает снимок метрик журнала
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	s := MetricsSnapshot{
+		Levels:  map[string]uint64{},
+		Loggers: map[string]uint64{},
+		Sites:   map[string]uint64{},
+		Sinks:   map[string]SinkCount{},
+	}
+	for i := range m.levels {
+		if n := m.levels[i].Load(); n != 0 {
+			s.Levels[LevelToLabel(slog.Level(i-metricsLevelOffset))] += n
+		}
+	}
+	m.others.Range(func(k, v any) bool {
+		s.Levels[LevelToLabel(k.(slog.Level))] += v.(*atomic.Uint64).Load()
+		return true
+	})
+	m.names.Range(func(k, v any) bool {
+		s.Loggers[k.(string)] = v.(*atomic.Uint64).Load()
+		return true
+	})
+	m.sites.Range(func(k, v any) bool {
+		site, _ := metricsSite(k.(uintptr))
+		s.Sites[site] += v.(*atomic.Uint64).Load()
+		return true
+	})
+	if n := m.overflow.Load(); n != 0 {
+		s.Sites[metricsOtherSite] = n
+	}
+	m.sinks.Range(func(k, v any) bool {
+		st := v.(*SinkStats)
+		s.Sinks[k.(string)] = SinkCount{
+			Writes: st.Writes.Load(), Bytes: st.Bytes.Load(), Errors: st.Errors.Load()}
+		return true
+	})
+	return s
+}
+
+// Publish публикует метрики в expvar под именем name
+// (как и expvar.Publish, паникует при повторной публикации имени)
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return m.Snapshot() }))
+}
+
+// promLabel экранирует значение метки Prometheus
+func promLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// Строка метрики Prometheus
+type promLine struct {
+	labels string
+	value  uint64
+}
+
+// writeProm выводит семейство метрик Prometheus (строки по алфавиту)
+func writeProm(w io.Writer, name, help string, lines []promLine) error {
+	sort.Slice(lines, func(i, j int) bool { return lines[i].labels < lines[j].labels })
+	_, err := fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s counter\n",
+		MetricsPrefix, name, help, MetricsPrefix, name)
+	for _, l := range lines {
+		if err != nil {
+			break
+		}
+		_, err = fmt.Fprintf(w, "%s%s{%s} %d\n", MetricsPrefix, name, l.labels, l.value)
+	}
+	return err
+}
+
+// WritePrometheus выводит метрики в текстовом формате Prometheus
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	s := m.Snapshot()
+	var levels, loggers, sites []promLine
+	for k, v := range s.Levels {
+		levels = append(levels, promLine{`level="` + promLabel(k) + `"`, v})
+	}
+	for k, v := range s.Loggers {
+		loggers = append(loggers, promLine{`logger="` + promLabel(k) + `"`, v})
+	}
+	// Разные PC (например, встроенная функция-обёртка или несколько
+	// вызовов в одной строке) могут иметь одинаковые метки; повторяющиеся
+	// серии Prometheus не допускает, поэтому счётчики суммируются
+	bySite := map[string]uint64{}
+	m.sites.Range(func(k, v any) bool {
+		site, fn := metricsSite(k.(uintptr))
+		bySite[`site="`+promLabel(site)+`",func="`+promLabel(fn)+`"`] += v.(*atomic.Uint64).Load()
+		return true
+	})
+	if n := m.overflow.Load(); n != 0 {
+		bySite[`site="`+metricsOtherSite+`",func=""`] += n
+	}
+	for k, v := range bySite {
+		sites = append(sites, promLine{k, v})
+	}
+	var writes, bytes, errs []promLine
+	for k, v := range s.Sinks {
+		label := `sink="` + promLabel(k) + `"`
+		writes = append(writes, promLine{label, v.Writes})
+		bytes = append(bytes, promLine{label, v.Bytes})
+		errs = append(errs, promLine{label, v.Errors})
+	}
+
+	for _, f := range []struct {
+		name, help string
+		lines      []promLine
+	}{
+		{"records_total", "Log records by level.", levels},
+		{"logger_records_total", "Log records by logger name.", loggers},
+		{"site_records_total", "Log records by call site.", sites},
+		{"sink_writes_total", "Log writes by sink.", writes},
+		{"sink_bytes_total", "Log bytes written by sink.", bytes},
+		{"sink_errors_total", "Log write errors by sink.", errs},
+	} {
+		if err := writeProm(w, f.name, f.help, f.lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP реализует http.Handler (метрики в текстовом формате Prometheus)
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.WritePrometheus(w)
+}
+
+// EOF: "metrics.go"
@@ -85,6 +85,42 @@ func (h *MiddlewareHandler) WithGroup(name string) slog.Handler {
 	return NewMiddlewareHandler(h.handler.WithGroup(name), h.mws...)
 }
 
+// WithChain() требуется для поддержки именованных цепочек контрольных сумм
+// (см. IdHandler.WithChain)
+func (h *MiddlewareHandler) WithChain(name string) slog.Handler {
+	ch, ok := h.handler.(chainHandler)
+	if !ok {
+		return h
+	}
+	return NewMiddlewareHandler(ch.WithChain(name), h.mws...)
+}
+
+// Named() требуется для поддержки именованных логгеров (см. IdHandler.Named)
+func (h *MiddlewareHandler) Named(name string) slog.Handler {
+	nh, ok := h.handler.(namedHandler)
+	if !ok {
+		return h
+	}
+	return NewMiddlewareHandler(nh.Named(name), h.mws...)
+}
+
+// Levels() требуется для поддержки переопределения уровней журналирования
+// (см. Logger.Levels)
+func (h *MiddlewareHandler) Levels() *Levels {
+	if lh, ok := h.handler.(levelsHandler); ok {
+		return lh.Levels()
+	}
+	return nil
+}
+
+// Filters() требуется для поддержки фильтров записей (см. Logger.SetFilter)
+func (h *MiddlewareHandler) Filters() *Filters {
+	if fh, ok := h.handler.(filtersHandler); ok {
+		return fh.Filters()
+	}
+	return nil
+}
+
 // Пример Middleware, который дублирует вывод записей в
 // дополнительный логгер (имитация режима "Multi Handler")
 //
@@ -171,25 +207,12 @@ func NewMiddlewareForError(logErr *Logger) Middleware {
 
 // Пример middleware, который заменяет значения атрибутов
 // passwd, password на ********.
-// Данная функция приведена скорее для примера использования Middleware,
-// чем для практического применения.
+//
+// Deprecated: используйте NewMiddlewareRedact() или Conf.Redact
+// (маскирование с учётом групп, структур и контрольной суммы).
 func NewMiddlewareNoPasswd() Middleware {
-	mwf := func(ctx context.Context, r slog.Record, handle HandleFunc) error {
-		// Создать новую запись
-		rNew := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
-
-		// Скопировтаь атрибуты в новую запись с подменой passwd и password
-		r.Attrs(func(attr slog.Attr) bool {
-			if (attr.Key == "passwd" || attr.Key == "password") &&
-				(attr.Value.Kind() == slog.KindString || attr.Value.Kind() == slog.KindInt64) {
-				attr.Value = slog.StringValue("********")
-			}
-			rNew.AddAttrs(attr)
-			return true
-		})
-		return handle(ctx, rNew)
-	}
-	return NewMiddleware(mwf)
+	rd, _ := NewRedactor(RedactRule{Key: "passwd"}, RedactRule{Key: "password"})
+	return NewMiddlewareRedact(rd)
 }
 
 // EOF: "middleware.go"
@@ -20,6 +20,21 @@ func removeGoExt(file string) string {
 	return file
 }
 
+// trimSrcFile укорачивает имя файла исходного текста:
+// pkg - оставить каталог (пакет/файл), ext - оставить расширение ".go"
+func trimSrcFile(file string, pkg, ext bool) string {
+	if pkg { // directory + file name
+		dir, name := filepath.Split(file)
+		file = filepath.Join(filepath.Base(dir), name)
+	} else { // only file name
+		file = filepath.Base(file)
+	}
+	if !ext { // remove ".go" extension
+		file = removeGoExt(file)
+	}
+	return file
+}
+
 // cropFuncName укорачивает специальным образом имя функции
 func cropFuncName(function string) string {
 	_, f := filepath.Split(function)
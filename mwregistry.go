@@ -0,0 +1,514 @@
+// File: "mwregistry.go"
+
+package xlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog" // go>=1.21
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Реестр именованных middleware.
+// Middleware, зарегистрированные по имени (RegisterMiddleware), можно
+// подключать без изменения кода - через Conf.Middlewares, переменную
+// окружения LOG_MIDDLEWARES или флаг -log-middlewares, например:
+//
+//	LOG_MIDDLEWARES="redact; sampler:first=10,thereafter=100; limits:value=4096"
+//	LOG_MIDDLEWARES='[{"name":"filter","opts":{"exclude":"msg~\"^health\""}}]'
+//
+// Фабрика middleware получает опции в виде map[string]any (из JSON или
+// строки спецификации, значения - строки). Списки задаются JSON массивом
+// или строкой через "|" ("keys=user|email").
+// Цепочка строится в заявленном порядке и подключается снаружи IdHandler
+// (как Logger.WithMiddleware), т.е. до вычисления logId/logSum.
+// Встроенные redact, pseudo, fieldenc и limits в Conf.Middlewares
+// не подключаются middleware, а задают соответствующие опции IdHandler
+// (Conf.Redactor, Conf.Pseudonymizer, Conf.FieldEncryptor, Conf.Limits):
+// так обрабатываются и атрибуты With, а маскирование, псевдонимизация,
+// шифрование и ограничение размера выполняются в этом порядке
+// до вычисления контрольной суммы независимо от места в цепочке.
+// Опция, уже заданная в Conf явно, не заменяется (ошибка).
+// Ошибки создания middleware выводятся в stderr, такие middleware
+// пропускаются.
+//
+// Встроенные middleware:
+//
+//	redact   - маскирование секретов (keys - дополнительные шаблоны ключей)
+//	sampler  - сэмплирование (tick, first, thereafter, pass-level, report)
+//	damper   - демпфер повторов (window, burst, keys, max-entries)
+//	filter   - фильтр записей (include, exclude)
+//	limits   - ограничения размера (message, value, attrs, depth, size)
+//	pseudo   - псевдонимизация (key - "kid:hex", keys)
+//	fieldenc - шифрование полей (key - "kid:type:hex", keys)
+//	fields   - добавление атрибутов (все опции - атрибуты)
+
+// MiddlewareFactory - фабрика именованного middleware
+type MiddlewareFactory func(opts map[string]any) (Middleware, error)
+
+// confFactory - фабрика встроенного middleware, задающая опцию IdHandler
+// в конфигурации conf вместо подключения middleware
+type confFactory func(opts map[string]any, conf *Conf) error
+
+// MiddlewareConf - описание middleware в конфигурации
+type MiddlewareConf struct {
+	Name string         `json:"name"`           // имя в реестре
+	Opts map[string]any `json:"opts,omitempty"` // опции фабрики
+}
+
+// Реестр фабрик middleware
+var (
+	mwRegistry   = map[string]MiddlewareFactory{}
+	mwConfOpts   = map[string]confFactory{} // встроенные опции IdHandler
+	mwRegistryMx sync.RWMutex
+)
+
+// RegisterMiddleware регистрирует фабрику middleware под заданным именем
+// (регистронезависимо). Повторная регистрация заменяет фабрику
+// (в том числе встроенную, тогда она подключается как middleware).
+func RegisterMiddleware(name string, factory MiddlewareFactory) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || strings.ContainsAny(name, " ,;:=") || factory == nil {
+		return fmt.Errorf("%w: name=%q", ErrBadMiddleware, name)
+	}
+	mwRegistryMx.Lock()
+	mwRegistry[name] = factory
+	delete(mwConfOpts, name)
+	mwRegistryMx.Unlock()
+	return nil
+}
+
+// RegisteredMiddlewares возвращает отсортированный список имён
+// зарегистрированных middleware
+func RegisteredMiddlewares() []string {
+	mwRegistryMx.RLock()
+	defer mwRegistryMx.RUnlock()
+	names := make([]string, 0, len(mwRegistry))
+	for name := range mwRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewMiddlewareByName создаёт middleware по имени из реестра.
+// Встроенные redact, pseudo, fieldenc и limits при этом обрабатывают
+// только атрибуты записи (см. Conf.Middlewares).
+func NewMiddlewareByName(name string, opts map[string]any) (Middleware, error) {
+	mwRegistryMx.RLock()
+	factory, ok := mwRegistry[strings.ToLower(strings.TrimSpace(name))]
+	mwRegistryMx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown middleware %q", ErrBadMiddleware, name)
+	}
+	mw, err := factory(opts)
+	if err != nil {
+		return nil, fmt.Errorf("middleware %q: %w", name, err)
+	}
+	return mw, nil
+}
+
+// NewMiddlewares создаёт цепочку middleware в заявленном порядке.
+// Middleware, которые не удалось создать, пропускаются; возвращается
+// первая ошибка.
+func NewMiddlewares(confs []MiddlewareConf) ([]Middleware, error) {
+	var first error
+	mws := make([]Middleware, 0, len(confs))
+	for _, c := range confs {
+		mw, err := NewMiddlewareByName(c.Name, c.Opts)
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		mws = append(mws, mw)
+	}
+	return mws, first
+}
+
+// ParseMiddlewares разбирает описание цепочки middleware: JSON массив
+// MiddlewareConf или строку вида "name[:key=value,...][; name...]"
+func ParseMiddlewares(spec string) ([]MiddlewareConf, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "[") {
+		var confs []MiddlewareConf
+		if err := json.Unmarshal([]byte(spec), &confs); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadMiddleware, err)
+		}
+		return confs, nil
+	}
+
+	var confs []MiddlewareConf
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, args, _ := strings.Cut(item, ":")
+		c := MiddlewareConf{Name: strings.TrimSpace(name)}
+		if args = strings.TrimSpace(args); args != "" {
+			c.Opts = make(map[string]any)
+			for _, arg := range strings.Split(args, ",") {
+				key, val, ok := strings.Cut(arg, "=")
+				key = strings.TrimSpace(key)
+				if !ok || key == "" {
+					return nil, fmt.Errorf("%w: bad option %q of %q",
+						ErrBadMiddleware, arg, c.Name)
+				}
+				c.Opts[key] = strings.TrimSpace(val)
+			}
+		}
+		confs = append(confs, c)
+	}
+	return confs, nil
+}
+
+// confMiddlewares создаёт цепочку middleware по Conf.Middlewares.
+// Встроенные redact, pseudo, fieldenc и limits задают опции IdHandler
+// в возвращаемой копии конфигурации. Ошибки выводятся в stderr.
+func confMiddlewares(conf Conf) (Conf, []Middleware) {
+	if len(conf.Middlewares) == 0 {
+		return conf, nil
+	}
+	confs := make([]MiddlewareConf, 0, len(conf.Middlewares))
+	for _, c := range conf.Middlewares {
+		name := strings.ToLower(strings.TrimSpace(c.Name))
+		mwRegistryMx.RLock()
+		factory, ok := mwConfOpts[name]
+		mwRegistryMx.RUnlock()
+		if !ok {
+			confs = append(confs, c)
+			continue
+		}
+		if err := factory(c.Opts, &conf); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: middleware %q: %v\n", c.Name, err)
+		}
+	}
+	mws, err := NewMiddlewares(confs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+	}
+	return conf, mws
+}
+
+// mwOpts - опции фабрики middleware с проверкой типов
+type mwOpts struct {
+	opts map[string]any
+	err  error // первая ошибка
+}
+
+// check проверяет отсутствие неизвестных опций
+func (o *mwOpts) check(known ...string) {
+	for key := range o.opts {
+		found := false
+		for _, k := range known {
+			found = found || key == k
+		}
+		if !found && o.err == nil {
+			o.err = fmt.Errorf("unknown option %q", key)
+		}
+	}
+}
+
+// fail запоминает ошибку значения опции
+func (o *mwOpts) fail(key string, v any) {
+	if o.err == nil {
+		o.err = fmt.Errorf("bad option %s=%v", key, v)
+	}
+}
+
+// String возвращает строковую опцию
+func (o *mwOpts) String(key string) string {
+	switch v := o.opts[key].(type) {
+	case nil:
+	case string:
+		return v
+	default:
+		o.fail(key, v)
+	}
+	return ""
+}
+
+// Int возвращает целочисленную опцию
+func (o *mwOpts) Int(key string) int {
+	switch v := o.opts[key].(type) {
+	case nil:
+	case int:
+		return v
+	case float64: // JSON
+		if v == float64(int(v)) {
+			return int(v)
+		}
+		o.fail(key, v)
+	case string:
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			o.fail(key, v)
+		}
+		return i
+	default:
+		o.fail(key, v)
+	}
+	return 0
+}
+
+// Duration возвращает опцию длительности ("1s", "500ms")
+func (o *mwOpts) Duration(key string) time.Duration {
+	switch v := o.opts[key].(type) {
+	case nil:
+	case time.Duration:
+		return v
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			o.fail(key, v)
+		}
+		return d
+	default:
+		o.fail(key, v)
+	}
+	return 0
+}
+
+// Level возвращает опцию уровня журналирования (nil - не задана)
+func (o *mwOpts) Level(key string) slog.Leveler {
+	switch v := o.opts[key].(type) {
+	case nil:
+	case slog.Level:
+		return v
+	case string:
+		return LevelFromString(v)
+	case float64: // JSON
+		return slog.Level(int(v))
+	default:
+		o.fail(key, v)
+	}
+	return nil
+}
+
+// Strings возвращает опцию-список (JSON массив или строка через "|")
+func (o *mwOpts) Strings(key string) []string {
+	switch v := o.opts[key].(type) {
+	case nil:
+	case []string:
+		return v
+	case string:
+		return strings.Split(v, "|")
+	case []any: // JSON
+		list := make([]string, 0, len(v))
+		for _, s := range v {
+			str, ok := s.(string)
+			if !ok {
+				o.fail(key, v)
+				return nil
+			}
+			list = append(list, str)
+		}
+		return list
+	default:
+		o.fail(key, v)
+	}
+	return nil
+}
+
+// mwRedactor создаёт Redactor по опциям встроенного "redact"
+func mwRedactor(opts map[string]any) (*Redactor, error) {
+	o := mwOpts{opts: opts}
+	o.check("keys")
+	keys := o.Strings("keys")
+	if o.err != nil {
+		return nil, o.err
+	}
+	rules := DefaultRedactRules()
+	for _, key := range keys {
+		rules = append(rules, RedactRule{Key: key})
+	}
+	return NewRedactor(rules...)
+}
+
+// mwLimits создаёт Limits по опциям встроенного "limits"
+func mwLimits(opts map[string]any) (*Limits, error) {
+	o := mwOpts{opts: opts}
+	o.check("message", "value", "attrs", "depth", "size")
+	l := &Limits{
+		Message: o.Int("message"),
+		Value:   o.Int("value"),
+		Attrs:   o.Int("attrs"),
+		Depth:   o.Int("depth"),
+		Size:    o.Int("size"),
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+	return l, nil
+}
+
+// mwPseudonymizer создаёт Pseudonymizer по опциям встроенного "pseudo"
+func mwPseudonymizer(opts map[string]any) (*Pseudonymizer, error) {
+	o := mwOpts{opts: opts}
+	o.check("key", "keys")
+	spec, keys := o.String("key"), o.Strings("keys")
+	if o.err != nil {
+		return nil, o.err
+	}
+	keyId, key, err := ParsePseudoKey(spec)
+	if err != nil {
+		return nil, err
+	}
+	return NewPseudonymizer(keyId, key, keys...)
+}
+
+// mwFieldEncryptor создаёт FieldEncryptor по опциям встроенного "fieldenc"
+func mwFieldEncryptor(opts map[string]any) (*FieldEncryptor, error) {
+	o := mwOpts{opts: opts}
+	o.check("key", "keys")
+	spec, keys := o.String("key"), o.Strings("keys")
+	if o.err != nil {
+		return nil, o.err
+	}
+	key, err := ParseFieldKey(spec)
+	if err != nil {
+		return nil, err
+	}
+	return NewFieldEncryptor(key, keys...)
+}
+
+// Регистрация встроенных middleware
+func init() {
+	builtin := map[string]MiddlewareFactory{
+		"redact": func(opts map[string]any) (Middleware, error) {
+			rd, err := mwRedactor(opts)
+			if err != nil {
+				return nil, err
+			}
+			return NewMiddlewareRedact(rd), nil
+		},
+
+		"sampler": func(opts map[string]any) (Middleware, error) {
+			o := mwOpts{opts: opts}
+			o.check("tick", "first", "thereafter", "pass-level", "report")
+			so := &SamplerOptions{
+				Tick:       o.Duration("tick"),
+				First:      o.Int("first"),
+				Thereafter: o.Int("thereafter"),
+				PassLevel:  o.Level("pass-level"),
+				Report:     o.Duration("report"),
+			}
+			if o.err != nil {
+				return nil, o.err
+			}
+			return NewMiddlewareSampler(so), nil
+		},
+
+		"damper": func(opts map[string]any) (Middleware, error) {
+			o := mwOpts{opts: opts}
+			o.check("window", "burst", "keys", "max-entries")
+			do := &DamperOptions{
+				Window:     o.Duration("window"),
+				Burst:      o.Int("burst"),
+				Keys:       o.Strings("keys"),
+				MaxEntries: o.Int("max-entries"),
+			}
+			if o.err != nil {
+				return nil, o.err
+			}
+			return NewMiddlewareDamper(do), nil
+		},
+
+		"filter": func(opts map[string]any) (Middleware, error) {
+			o := mwOpts{opts: opts}
+			o.check("include", "exclude")
+			include, exclude := o.String("include"), o.String("exclude")
+			if o.err != nil {
+				return nil, o.err
+			}
+			return NewMiddlewareFilter(include, exclude)
+		},
+
+		"limits": func(opts map[string]any) (Middleware, error) {
+			l, err := mwLimits(opts)
+			if err != nil {
+				return nil, err
+			}
+			return l.Middleware(), nil
+		},
+
+		"pseudo": func(opts map[string]any) (Middleware, error) {
+			p, err := mwPseudonymizer(opts)
+			if err != nil {
+				return nil, err
+			}
+			return p.Middleware(), nil
+		},
+
+		"fieldenc": func(opts map[string]any) (Middleware, error) {
+			e, err := mwFieldEncryptor(opts)
+			if err != nil {
+				return nil, err
+			}
+			return e.Middleware(), nil
+		},
+
+		"fields": func(opts map[string]any) (Middleware, error) {
+			fields := make(Fields, len(opts))
+			for k, v := range opts {
+				fields[k] = v
+			}
+			return NewMiddlewareWithFields(fields), nil
+		},
+	}
+	for name, factory := range builtin {
+		if err := RegisterMiddleware(name, factory); err != nil {
+			panic(err)
+		}
+	}
+
+	// Встроенные middleware, задающие опции IdHandler (см. confMiddlewares)
+	mwConfOpts = map[string]confFactory{
+		"redact": func(opts map[string]any, conf *Conf) (err error) {
+			if conf.Redactor != nil {
+				return errConfSet("Redactor")
+			}
+			conf.Redactor, err = mwRedactor(opts)
+			return err
+		},
+
+		"pseudo": func(opts map[string]any, conf *Conf) (err error) {
+			if conf.Pseudonymizer != nil {
+				return errConfSet("Pseudonymizer")
+			}
+			conf.Pseudonymizer, err = mwPseudonymizer(opts)
+			return err
+		},
+
+		"fieldenc": func(opts map[string]any, conf *Conf) (err error) {
+			if conf.FieldEncryptor != nil {
+				return errConfSet("FieldEncryptor")
+			}
+			conf.FieldEncryptor, err = mwFieldEncryptor(opts)
+			return err
+		},
+
+		"limits": func(opts map[string]any, conf *Conf) (err error) {
+			if conf.Limits != nil {
+				return errConfSet("Limits")
+			}
+			conf.Limits, err = mwLimits(opts)
+			return err
+		},
+	}
+}
+
+// errConfSet возвращает ошибку повторного задания опции конфигурации
+func errConfSet(field string) error {
+	return fmt.Errorf("%w: Conf.%s already set", ErrBadMiddleware, field)
+}
+
+// EOF: "mwregistry.go"
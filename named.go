@@ -0,0 +1,172 @@
+// File: "named.go"
+
+package xlog
+
+import (
+	"log/slog" // go>=1.21
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Иерархические именованные логгеры.
+// Логгер, созданный методом Named(), добавляет в каждую запись атрибут
+// "logger" с полным именем через точку (например, "db.pool"), а формат
+// Tinted выводит имя префиксом перед сообщением ("[db.pool] ...").
+// Каждому имени соответствует узел глобального реестра (см. Loggers()),
+// который может иметь собственный уровень журналирования. Если уровень
+// узла не задан, то он наследуется от родителя ("db.pool" -> "db"),
+// а при отсутствии уровня у всех предков используются уровни логгера
+// (базовый уровень и переопределения LOG_LEVEL, см. Levels).
+// Узлы общие для всех логгеров с одинаковыми именами.
+
+// Разделитель имён в иерархии логгеров
+const LoggerSep = "."
+
+// LoggerNode - узел иерархии именованных логгеров
+type LoggerNode struct {
+	name   string        // полное имя ("db.pool")
+	parent *LoggerNode   // родительский узел (nil для корневых имён)
+	level  slog.LevelVar // собственный уровень (если set=true)
+	set    atomic.Bool   // признак собственного уровня
+}
+
+// Реестр именованных логгеров
+var loggers = struct {
+	nodes map[string]*LoggerNode // узлы по полным именам
+	mx    sync.Mutex             // мьютекс для безопасного доступа к nodes
+}{nodes: map[string]*LoggerNode{}}
+
+// loggerNode возвращает узел реестра по полному имени (создаёт при
+// необходимости вместе с родительскими узлами)
+func loggerNode(name string) *LoggerNode {
+	loggers.mx.Lock()
+	defer loggers.mx.Unlock()
+	var parent *LoggerNode
+	for i := 0; ; {
+		j := strings.Index(name[i:], LoggerSep)
+		full := name
+		if j >= 0 {
+			full = name[:i+j]
+		}
+		node, ok := loggers.nodes[full]
+		if !ok {
+			node = &LoggerNode{name: full, parent: parent}
+			loggers.nodes[full] = node
+		}
+		if j < 0 {
+			return node
+		}
+		parent, i = node, i+j+len(LoggerSep)
+	}
+}
+
+// Loggers возвращает список узлов именованных логгеров (по алфавиту)
+func Loggers() []*LoggerNode {
+	loggers.mx.Lock()
+	defer loggers.mx.Unlock()
+	nodes := make([]*LoggerNode, 0, len(loggers.nodes))
+	for _, node := range loggers.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].name < nodes[j].name })
+	return nodes
+}
+
+// LoggerByName возвращает узел именованного логгера или nil
+func LoggerByName(name string) *LoggerNode {
+	loggers.mx.Lock()
+	defer loggers.mx.Unlock()
+	return loggers.nodes[name]
+}
+
+// Name возвращает полное имя узла
+func (n *LoggerNode) Name() string { return n.name }
+
+// Parent возвращает родительский узел (или nil)
+func (n *LoggerNode) Parent() *LoggerNode { return n.parent }
+
+// Level возвращает действующий уровень узла (собственный или унаследованный).
+// Признак ok=false означает, что уровень не задан ни у узла, ни у предков.
+func (n *LoggerNode) Level() (level slog.Level, ok bool) {
+	for ; n != nil; n = n.parent {
+		if n.set.Load() {
+			return n.level.Level(), true
+		}
+	}
+	return 0, false
+}
+
+// IsSet сообщает, задан ли собственный уровень узла
+func (n *LoggerNode) IsSet() bool { return n.set.Load() }
+
+// SetLevel задаёт собственный уровень узла
+func (n *LoggerNode) SetLevel(level slog.Level) {
+	n.level.Set(level)
+	n.set.Store(true)
+}
+
+// SetLvl задаёт собственный уровень узла строкой ("trace", "error", ...)
+func (n *LoggerNode) SetLvl(level string) { n.SetLevel(LevelFromString(level)) }
+
+// ResetLevel сбрасывает собственный уровень узла (уровень наследуется)
+func (n *LoggerNode) ResetLevel() { n.set.Store(false) }
+
+// GetLvl возвращает действующий уровень узла в виде строки
+// или пустую строку, если уровень не задан
+func (n *LoggerNode) GetLvl() string {
+	if level, ok := n.Level(); ok {
+		return LevelToString(level)
+	}
+	return ""
+}
+
+// namedHandler - интерфейс slog.Handler'а с поддержкой именованных
+// логгеров (см. IdHandler.Named)
+type namedHandler interface {
+	Named(name string) slog.Handler
+}
+
+// nameHandler - интерфейс slog.Handler'а, возвращающего имя логгера
+// (см. IdHandler.Name)
+type nameHandler interface {
+	Name() string
+}
+
+// recordLogger возвращает имя логгера из атрибута "logger" записи
+// (атрибут добавляет IdHandler именованного логгера)
+func recordLogger(r slog.Record) (name string) {
+	r.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == LoggerKey && attr.Value.Kind() == slog.KindString {
+			name = attr.Value.String()
+			return false
+		}
+		return true
+	})
+	return name
+}
+
+// Named создает дочерний именованный логгер. Имя добавляется к имени
+// родителя через точку: log.Named("db").Named("pool") -> "db.pool".
+// Если хендлер логгера не поддерживает имена, то возвращается исходный
+// логгер.
+func (c *Logger) Named(name string) *Logger {
+	nh, ok := c.Handler().(namedHandler)
+	if !ok || name == "" {
+		return c
+	}
+	return &Logger{
+		Logger: slog.New(nh.Named(name)),
+		Level:  c.Level,
+		Writer: c.Writer,
+	}
+}
+
+// Named создает дочерний именованный логгер на основе глобального логгера
+func Named(name string) *Logger {
+	return currentClog.Named(name)
+}
+
+// EOF: "named.go"
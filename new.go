@@ -67,6 +67,11 @@ func NewEx(conf Conf, writer Writer, mws ...Middleware) *Logger {
 		writer = pipeWriter{os.Stdout}
 	}
 
+	if conf.Metrics != nil {
+		// Подсчитывать байты и ошибки по направлениям вывода
+		writer = conf.Metrics.Instrument(writer)
+	}
+
 	// Создать slog.Handler и вернуть *slog.LeverVar
 	handler, level = NewHandler(conf, writer, mws...)
 
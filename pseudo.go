@@ -0,0 +1,172 @@
+// File: "pseudo.go"
+
+package xlog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog" // go>=1.21
+	"strings"
+	"sync/atomic"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Псевдонимизация персональных данных (GDPR).
+// Значения заданных атрибутов (например, "email", "phone", "user.name")
+// заменяются токенами вида "pii:<keyId>:<HMAC-SHA256>", которые при
+// одном и том же ключе стабильны (позволяют сопоставлять записи одного
+// пользователя), но необратимы. Идентификатор ключа keyId входит в токен,
+// что позволяет менять ключ (SetKey) без потери возможности поиска по
+// журналам, записанным со старыми ключами: зная ключ и исходное значение,
+// можно вычислить токен (PseudoToken, команда "xlogscan pseudo").
+// Шаблоны ключей атрибутов задаются как в RedactRule.Key (glob или
+// регулярное выражение, полный путь для шаблонов с точкой).
+// Псевдонимизатор подключается опцией Conf.Pseudonymizer (IdOptions),
+// тогда токены подставляются в атрибуты записей и With до вычисления
+// контрольной суммы. Middleware псевдонимизатора обрабатывает только
+// атрибуты записи (атрибуты With ему недоступны).
+
+// Префикс токена псевдонимизации
+const PseudoPrefix = "pii:"
+
+// Длина HMAC в токене (байт)
+const pseudoMacLen = 12
+
+// Ключ псевдонимизации
+type pseudoKey struct {
+	id  string // идентификатор ключа
+	key []byte // секретный ключ HMAC
+}
+
+// Pseudonymizer - псевдонимизатор атрибутов записей
+// (см. NewPseudonymizer)
+type Pseudonymizer struct {
+	rd  *Redactor                 // правила сопоставления ключей атрибутов
+	key atomic.Pointer[pseudoKey] // текущий ключ
+}
+
+// checkPseudoKey проверяет идентификатор и ключ псевдонимизации
+func checkPseudoKey(keyId string, key []byte) error {
+	if keyId == "" || strings.ContainsAny(keyId, ": ") || len(key) == 0 {
+		return fmt.Errorf("%w: key id %q, key length %d", ErrBadKey, keyId, len(key))
+	}
+	return nil
+}
+
+// PseudoToken вычисляет токен псевдонимизации значения value
+// ключом key с идентификатором keyId
+func PseudoToken(keyId string, key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(keyId))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	sum := mac.Sum(nil)
+	return PseudoPrefix + keyId + ":" +
+		base64.RawURLEncoding.EncodeToString(sum[:pseudoMacLen])
+}
+
+// PseudoKeyId возвращает идентификатор ключа токена псевдонимизации.
+// Признак ok=false означает, что строка не является токеном.
+func PseudoKeyId(token string) (keyId string, ok bool) {
+	rest, ok := strings.CutPrefix(token, PseudoPrefix)
+	if !ok {
+		return "", false
+	}
+	keyId, mac, ok := strings.Cut(rest, ":")
+	if !ok || keyId == "" ||
+		base64.RawURLEncoding.DecodedLen(len(mac)) != pseudoMacLen {
+		return "", false
+	}
+	return keyId, true
+}
+
+// ParsePseudoKey разбирает ключ псевдонимизации в формате "keyId:hex"
+// (например, из переменной окружения или опции командной строки)
+func ParsePseudoKey(spec string) (keyId string, key []byte, err error) {
+	keyId, hexKey, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	key, err = hex.DecodeString(hexKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrBadKey, err)
+	}
+	if err = checkPseudoKey(keyId, key); err != nil {
+		return "", nil, err
+	}
+	return keyId, key, nil
+}
+
+// NewPseudonymizer создаёт псевдонимизатор атрибутов
+//
+//	keyId - идентификатор ключа (входит в токен, без ':')
+//	key - секретный ключ HMAC-SHA256
+//	keys - шаблоны ключей атрибутов ("email", "phone", "user.name", ...)
+func NewPseudonymizer(keyId string, key []byte, keys ...string) (*Pseudonymizer, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("pseudo: no attribute keys")
+	}
+	rules := make([]RedactRule, 0, len(keys))
+	for _, k := range keys {
+		rules = append(rules, RedactRule{Key: k})
+	}
+	rd, err := NewRedactor(rules...)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pseudonymizer{rd: rd}
+	if err = p.SetKey(keyId, key); err != nil {
+		return nil, err
+	}
+	for _, r := range rd.keys {
+		r.fn = p.Token
+	}
+	return p, nil
+}
+
+// NewMiddlewarePseudo создаёт Middleware псевдонимизации атрибутов
+// (см. NewPseudonymizer)
+func NewMiddlewarePseudo(keyId string, key []byte, keys ...string) (Middleware, error) {
+	p, err := NewPseudonymizer(keyId, key, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return p.Middleware(), nil
+}
+
+// SetKey заменяет ключ псевдонимизации (ротация ключей)
+func (p *Pseudonymizer) SetKey(keyId string, key []byte) error {
+	if err := checkPseudoKey(keyId, key); err != nil {
+		return err
+	}
+	p.key.Store(&pseudoKey{id: keyId, key: append([]byte(nil), key...)})
+	return nil
+}
+
+// KeyId возвращает идентификатор текущего ключа псевдонимизации
+func (p *Pseudonymizer) KeyId() string { return p.key.Load().id }
+
+// Token вычисляет токен псевдонимизации значения текущим ключом
+func (p *Pseudonymizer) Token(value string) string {
+	k := p.key.Load()
+	return PseudoToken(k.id, k.key, value)
+}
+
+// Attrs псевдонимизирует список атрибутов (исходный слайс не изменяется)
+func (p *Pseudonymizer) Attrs(attrs []slog.Attr) []slog.Attr {
+	return p.rd.Attrs(attrs)
+}
+
+// Record псевдонимизирует атрибуты записи. Если изменений нет,
+// то возвращается исходная запись.
+func (p *Pseudonymizer) Record(r slog.Record) slog.Record {
+	return p.rd.Record(r)
+}
+
+// Middleware возвращает Middleware псевдонимизатора
+// (только атрибуты записи, см. Conf.Pseudonymizer)
+func (p *Pseudonymizer) Middleware() Middleware {
+	return NewMiddlewareRedact(p.rd)
+}
+
+// EOF: "pseudo.go"
@@ -0,0 +1,501 @@
+// File: "redact.go"
+
+package xlog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog" // go>=1.21
+	"net"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Маскирование (редактирование) секретов в записях журнала.
+// Правило RedactRule задаёт шаблон ключа атрибута и/или детектор значения
+// и способ маскирования (RedactStrategy):
+//
+//   - правило только с шаблоном ключа маскирует значение атрибута целиком
+//     (включая группы и структуры);
+//   - правило с детектором маскирует найденные фрагменты строковых
+//     значений (и текста сообщения) у атрибутов с подходящими ключами
+//     (или у любых атрибутов, если шаблон ключа не задан).
+//
+// Шаблон ключа - glob ("*token*") или регулярное выражение в косых чертах
+// ("/^x-api-/"), регистр не учитывается. Glob шаблон с точкой и регулярное
+// выражение сопоставляются с полным путём атрибута ("user.password"),
+// glob шаблон без точки - с ключом.
+// Маскирование выполняется рекурсивно: в группах (slog.KindGroup),
+// значениях slog.LogValuer, FieldsProvider, структурах, картах и слайсах
+// (с помощью рефлексии; изменённые структуры и карты выводятся группами).
+// IdHandler (Conf.Redact, Conf.Redactor) маскирует запись, атрибуты With
+// и сообщение до вычисления контрольной суммы, поэтому "logSum"
+// вычисляется по замаскированным значениям.
+
+// Способ маскирования
+type RedactStrategy int
+
+const (
+	RedactMask    RedactStrategy = iota // заменить на "********"
+	RedactHash                          // заменить на "sha256:<16 hex>"
+	RedactPartial                       // оставить 4 последних символа
+	RedactDrop                          // удалить атрибут
+)
+
+// Детекторы значений
+const (
+	DetectBearer = "bearer" // "Bearer <token>" (маскируется токен)
+	DetectJWT    = "jwt"    // JSON Web Token (eyJ...)
+	DetectCard   = "card"   // номер банковской карты (с проверкой Луна)
+	DetectEmail  = "email"  // адрес электронной почты
+	DetectIP     = "ip"     // IPv4/IPv6 адрес
+)
+
+// Строка-маска (RedactMask)
+const RedactMaskString = "********"
+
+// Максимальная глубина рекурсии при маскировании
+const redactMaxDepth = 8
+
+// RedactRule - правило маскирования
+type RedactRule struct {
+	Key      string         // шаблон ключа ("" - любой ключ)
+	Detect   string         // детектор значения ("" - значение целиком)
+	Strategy RedactStrategy // способ маскирования
+}
+
+// DefaultRedactRules возвращает правила маскирования по умолчанию:
+// пароли, секреты, токены, заголовки авторизации, Bearer/JWT токены
+// и номера банковских карт (последние 4 цифры остаются видны)
+func DefaultRedactRules() []RedactRule {
+	return []RedactRule{
+		{Key: "*passw*"},
+		{Key: "passwd"},
+		{Key: "*secret*"},
+		{Key: "*token*"},
+		{Key: "api?key"},
+		{Key: "authorization"},
+		{Key: "cookie"},
+		{Key: "set-cookie"},
+		{Detect: DetectBearer},
+		{Detect: DetectJWT},
+		{Detect: DetectCard, Strategy: RedactPartial},
+	}
+}
+
+// Скомпилированное правило маскирования
+type redactRule struct {
+	RedactRule
+	re     *regexp.Regexp      // регулярное выражение ключа (или nil)
+	full   bool                // сопоставлять с полным путём
+	detect *redactDetector     // детектор значения (или nil)
+	fn     func(string) string // замена значения (вместо Strategy)
+}
+
+// Детектор значений
+type redactDetector struct {
+	re    *regexp.Regexp      // кандидаты (группа 1 - маскируемая часть)
+	check func(s string) bool // дополнительная проверка кандидата
+}
+
+// Таблица детекторов значений
+var redactDetectors = map[string]*redactDetector{
+	DetectBearer: {re: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`)},
+	DetectJWT:    {re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)},
+	DetectCard:   {re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), check: luhnValid},
+	DetectEmail:  {re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	DetectIP: {
+		re:    regexp.MustCompile(`\b(?:\d{1,3}(?:\.\d{1,3}){3}|[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7})\b`),
+		check: func(s string) bool { return net.ParseIP(s) != nil },
+	},
+}
+
+// luhnValid проверяет номер карты по алгоритму Луна
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// Redactor - набор скомпилированных правил маскирования
+type Redactor struct {
+	keys    []*redactRule // правила маскирования значений целиком
+	detects []*redactRule // правила с детекторами
+}
+
+// NewRedactor компилирует правила маскирования
+// (без правил используются DefaultRedactRules)
+func NewRedactor(rules ...RedactRule) (*Redactor, error) {
+	if len(rules) == 0 {
+		rules = DefaultRedactRules()
+	}
+	rd := &Redactor{}
+	for _, rule := range rules {
+		r := &redactRule{RedactRule: rule}
+		r.Key = strings.ToLower(rule.Key)
+		if n := len(r.Key); n > 1 && r.Key[0] == '/' && r.Key[n-1] == '/' {
+			re, err := regexp.Compile("(?i)" + rule.Key[1:n-1])
+			if err != nil {
+				return nil, fmt.Errorf("redact: bad key regexp %q: %w", rule.Key, err)
+			}
+			r.re = re
+		} else if _, err := path.Match(r.Key, ""); err != nil {
+			return nil, fmt.Errorf("redact: bad key pattern %q: %w", rule.Key, err)
+		}
+		r.full = r.re != nil || strings.Contains(r.Key, ".")
+
+		switch {
+		case rule.Detect != "":
+			d, ok := redactDetectors[rule.Detect]
+			if !ok {
+				return nil, fmt.Errorf("redact: unknown detector %q", rule.Detect)
+			}
+			r.detect = d
+			rd.detects = append(rd.detects, r)
+		case rule.Key != "":
+			rd.keys = append(rd.keys, r)
+		default:
+			return nil, fmt.Errorf("redact: empty rule")
+		}
+	}
+	return rd, nil
+}
+
+// DefaultRedactor возвращает Redactor с правилами по умолчанию
+func DefaultRedactor() *Redactor {
+	rd, _ := NewRedactor()
+	return rd
+}
+
+// match проверяет соответствие ключа (пути) шаблону правила
+func (r *redactRule) match(key, full string) bool {
+	if r.Key == "" {
+		return true
+	}
+	if r.full {
+		key = full
+	}
+	key = strings.ToLower(key)
+	if r.re != nil {
+		return r.re.MatchString(key)
+	}
+	ok, _ := path.Match(r.Key, key)
+	return ok
+}
+
+// apply применяет способ маскирования к строке
+func (s RedactStrategy) apply(str string) string {
+	switch s {
+	case RedactHash:
+		sum := sha256.Sum256([]byte(str))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	case RedactPartial:
+		rs := []rune(str)
+		if len(rs) <= 4 {
+			return strings.Repeat("*", len(rs))
+		}
+		return strings.Repeat("*", len(rs)-4) + string(rs[len(rs)-4:])
+	}
+	return RedactMaskString
+}
+
+// apply применяет правило маскирования к строке
+func (r *redactRule) apply(str string) string {
+	if r.fn != nil {
+		return r.fn(str)
+	}
+	return r.Strategy.apply(str)
+}
+
+// String маскирует фрагменты строки детекторами с подходящими ключами
+// (для текста сообщения используются правила без шаблона ключа)
+func (rd *Redactor) String(s string) string {
+	s, _ = rd.redactString("", "", s, true)
+	return s
+}
+
+// redactString маскирует фрагменты строки. Признак drop сообщает,
+// что атрибут следует удалить (RedactDrop).
+func (rd *Redactor) redactString(key, full, s string, msg bool) (_ string, drop bool) {
+	for _, r := range rd.detects {
+		if msg && r.Key != "" || !msg && !r.match(key, full) {
+			continue
+		}
+		d := r.detect
+		locs := d.re.FindAllStringSubmatchIndex(s, -1)
+		if len(locs) == 0 {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, loc := range locs {
+			i, j := loc[0], loc[1]
+			if len(loc) > 2 && loc[2] >= 0 { // маскируемая часть
+				i, j = loc[2], loc[3]
+			}
+			if d.check != nil && !d.check(s[i:j]) {
+				continue
+			}
+			if r.Strategy == RedactDrop && !msg {
+				return "", true
+			}
+			b.WriteString(s[last:i])
+			b.WriteString(r.apply(s[i:j]))
+			last = j
+		}
+		if last != 0 {
+			b.WriteString(s[last:])
+			s = b.String()
+		}
+	}
+	return s, false
+}
+
+// Attr маскирует атрибут. Признак ok=false означает, что атрибут
+// следует удалить.
+func (rd *Redactor) Attr(a slog.Attr) (_ slog.Attr, ok bool) {
+	a, _, drop := rd.redactAttr("", a, 0)
+	return a, !drop
+}
+
+// Attrs маскирует список атрибутов (исходный слайс не изменяется)
+func (rd *Redactor) Attrs(attrs []slog.Attr) []slog.Attr {
+	as, _ := rd.redactAttrs("", attrs, 0)
+	return as
+}
+
+// redactAttrs маскирует список атрибутов с префиксом пути prefix.
+// Если изменений нет, то возвращается исходный слайс.
+func (rd *Redactor) redactAttrs(prefix string, attrs []slog.Attr, depth int) (
+	[]slog.Attr, bool) {
+	var out []slog.Attr
+	for i, a := range attrs {
+		b, changed, drop := rd.redactAttr(prefix, a, depth)
+		if (changed || drop) && out == nil {
+			out = make([]slog.Attr, i, len(attrs))
+			copy(out, attrs[:i])
+		}
+		if out != nil && !drop {
+			out = append(out, b)
+		}
+	}
+	if out == nil {
+		return attrs, false
+	}
+	return out, true
+}
+
+// redactAttr маскирует атрибут с префиксом пути prefix
+func (rd *Redactor) redactAttr(prefix string, a slog.Attr, depth int) (
+	_ slog.Attr, changed, drop bool) {
+	full := prefix + a.Key
+	for _, r := range rd.keys {
+		if r.match(a.Key, full) {
+			if r.Strategy == RedactDrop {
+				return a, false, true
+			}
+			str := ""
+			if r.Strategy != RedactMask || r.fn != nil {
+				str = a.Value.Resolve().String()
+			}
+			return slog.String(a.Key, r.apply(str)), true, false
+		}
+	}
+	if len(rd.detects) == 0 && depth == 0 && a.Value.Kind() != slog.KindGroup &&
+		a.Value.Kind() != slog.KindLogValuer && a.Value.Kind() != slog.KindAny {
+		return a, false, false // только правила ключей - вложенных нет
+	}
+	v, changed, drop := rd.redactValue(a.Key, full, a.Value, depth)
+	if changed {
+		a.Value = v
+	}
+	return a, changed, drop
+}
+
+// redactValue маскирует значение атрибута key (с полным путём full)
+func (rd *Redactor) redactValue(key, full string, v slog.Value, depth int) (
+	_ slog.Value, changed, drop bool) {
+	if depth > redactMaxDepth {
+		return v, false, false
+	}
+	switch v.Kind() {
+	case slog.KindString:
+		s, drop := rd.redactString(key, full, v.String(), false)
+		if drop || s == v.String() {
+			return v, false, drop
+		}
+		return slog.StringValue(s), true, false
+
+	case slog.KindGroup:
+		prefix := full + "."
+		if key == "" { // встроенная группа
+			prefix = strings.TrimSuffix(full, key)
+		}
+		as, changed := rd.redactAttrs(prefix, v.Group(), depth+1)
+		if !changed {
+			return v, false, false
+		}
+		return slog.GroupValue(as...), true, false
+
+	case slog.KindLogValuer:
+		v, _, drop = rd.redactValue(key, full, v.Resolve(), depth)
+		return v, true, drop // значение зафиксировано
+
+	case slog.KindAny:
+		if fp, ok := v.Any().(FieldsProvider); ok {
+			v, _, drop = rd.redactValue(key, full, fp.Fields().Value(), depth)
+			return v, true, drop
+		}
+		return rd.redactReflect(key, full, reflect.ValueOf(v.Any()), depth)
+	}
+	return v, false, false
+}
+
+// redactReflect маскирует значения структур, карт и слайсов
+func (rd *Redactor) redactReflect(key, full string, rv reflect.Value, depth int) (
+	_ slog.Value, changed, drop bool) {
+	orig := slog.AnyValue(nil)
+	if rv.IsValid() && rv.CanInterface() {
+		orig = slog.AnyValue(rv.Interface())
+	}
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return orig, false, false
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		s, drop := rd.redactString(key, full, rv.String(), false)
+		return slog.StringValue(s), s != rv.String(), drop
+
+	case reflect.Struct:
+		t := rv.Type()
+		attrs := make([]slog.Attr, 0, rv.NumField())
+		for i := 0; i < rv.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Name
+			if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			attrs = append(attrs, slog.Any(name, rv.Field(i).Interface()))
+		}
+		if len(attrs) == 0 { // time.Time и т.п.
+			return orig, false, false
+		}
+		return rd.redactGroup(full, attrs, orig, depth)
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return orig, false, false
+		}
+		attrs := make([]slog.Attr, 0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			attrs = append(attrs, slog.Any(iter.Key().String(), iter.Value().Interface()))
+		}
+		return rd.redactGroup(full, attrs, orig, depth)
+
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 { // []byte
+			return orig, false, false
+		}
+		items := make([]any, rv.Len())
+		changed := false
+		for i := range items {
+			item := rv.Index(i).Interface()
+			v, ch, _ := rd.redactValue(key, full, slog.AnyValue(item), depth+1)
+			if ch {
+				changed, item = true, redactAny(v)
+			}
+			items[i] = item
+		}
+		if !changed {
+			return orig, false, false
+		}
+		return slog.AnyValue(items), true, false
+	}
+	return orig, false, false
+}
+
+// redactGroup маскирует атрибуты структуры или карты; при изменениях
+// значение выводится группой
+func (rd *Redactor) redactGroup(full string, attrs []slog.Attr, orig slog.Value,
+	depth int) (_ slog.Value, changed, drop bool) {
+	as, changed := rd.redactAttrs(full+".", attrs, depth+1)
+	if !changed {
+		return orig, false, false
+	}
+	return slog.GroupValue(as...), true, false
+}
+
+// redactAny преобразует slog.Value в значение для вывода в слайсе
+// (группы - в карты)
+func redactAny(v slog.Value) any {
+	if v.Kind() != slog.KindGroup {
+		return v.Any()
+	}
+	m := make(map[string]any, len(v.Group()))
+	for _, a := range v.Group() {
+		m[a.Key] = redactAny(a.Value)
+	}
+	return m
+}
+
+// Record маскирует сообщение и атрибуты записи. Если изменений нет,
+// то возвращается исходная запись.
+func (rd *Redactor) Record(r slog.Record) slog.Record {
+	msg := rd.String(r.Message)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	as, changed := rd.redactAttrs("", attrs, 0)
+	if !changed && msg == r.Message {
+		return r
+	}
+	rNew := slog.NewRecord(r.Time, r.Level, msg, r.PC)
+	rNew.AddAttrs(as...)
+	return rNew
+}
+
+// NewMiddlewareRedact создаёт Middleware маскирования секретов
+// (nil - правила по умолчанию). Middleware видит только атрибуты записи;
+// для маскирования атрибутов With и согласованного вычисления
+// контрольных сумм следует использовать Conf.Redact/Conf.Redactor.
+func NewMiddlewareRedact(rd *Redactor) Middleware {
+	if rd == nil {
+		rd = DefaultRedactor()
+	}
+	mwf := func(ctx context.Context, r slog.Record, next HandleFunc) error {
+		return next(ctx, rd.Record(r))
+	}
+	return NewMiddleware(mwf)
+}
+
+// EOF: "redact.go"
@@ -0,0 +1,221 @@
+// File: "richerr.go"
+
+package xlog
+
+import (
+	"errors"
+	"fmt"
+	"log/slog" // go>=1.21
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Развёрнутый вывод ошибок.
+// Если ошибка, переданная в Err(), содержит цепочку обёрток (Unwrap),
+// ветви errors.Join, реализует slog.LogValuer или несёт стек вызовов
+// (см. Errf, WrapErr), то атрибут "err" выводится в журнал как группа:
+//
+//	msg   - текст ошибки (err.Error())
+//	type  - Go тип ошибки
+//	value - значение slog.LogValuer (если ошибка его реализует)
+//	stack - стек вызовов на момент создания ошибки (Errf, WrapErr)
+//	cause - вложенная группа для ошибки, возвращаемой Unwrap() error
+//	join  - вложенные группы "0", "1", ... для ветвей Unwrap() []error
+//
+// Простые ошибки (например errors.New) выводятся как прежде строкой.
+// Группа вычисляется до расчёта контрольной суммы и входит в ChecksumFull.
+
+// Ключ для стека вызовов в журнале
+const StackKey = "stack"
+
+// Параметры развёрнутого вывода ошибок
+const (
+	errMaxDepth   = 8  // максимальная глубина вложенности cause/join
+	stackMaxDepth = 32 // максимальное число кадров стека вызовов
+)
+
+// StackFrame - кадр стека вызовов
+type StackFrame struct {
+	Function string `json:"function"` // полное имя функции
+	File     string `json:"file"`     // имя файла исходного текста
+	Line     int    `json:"line"`     // номер строки
+}
+
+// Stack - стек вызовов (первый кадр - место вызова)
+type Stack []StackFrame
+
+// NewStack формирует стек вызовов по программным счётчикам (runtime.Callers)
+func NewStack(pcs []uintptr) Stack {
+	if len(pcs) == 0 {
+		return nil
+	}
+	stack := make(Stack, 0, len(pcs))
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" {
+			stack = append(stack, StackFrame{
+				Function: frame.Function,
+				File:     frame.File,
+				Line:     frame.Line,
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
+// callers возвращает программные счётчики стека вызовов
+// (skip - число пропускаемых кадров, 0 - сама функция callers)
+func callers(skip int) []uintptr {
+	var pcs [stackMaxDepth]uintptr
+	n := runtime.Callers(skip+1, pcs[:])
+	return append([]uintptr(nil), pcs[:n]...)
+}
+
+// String возвращает компактное представление стека вызовов
+// ("pkg.Func file.go:12 < pkg.Caller file.go:34")
+func (s Stack) String() string { return s.string(false, true) }
+
+// string возвращает компактное представление стека вызовов
+// с укорачиванием имён файлов (см. trimSrcFile)
+func (s Stack) string(pkg, ext bool) string {
+	var sb strings.Builder
+	for i, f := range s {
+		if i != 0 {
+			sb.WriteString(" < ")
+		}
+		sb.WriteString(filepath.Base(f.Function))
+		sb.WriteByte(' ')
+		sb.WriteString(trimSrcFile(f.File, pkg, ext))
+		sb.WriteByte(':')
+		sb.WriteString(strconv.Itoa(f.Line))
+	}
+	return sb.String()
+}
+
+// stackError - ошибка со стеком вызовов (см. Errf, WrapErr)
+type stackError struct {
+	err error     // исходная ошибка
+	pcs []uintptr // программные счётчики стека вызовов
+}
+
+// Error реализует интерфейс error
+func (e *stackError) Error() string { return e.err.Error() }
+
+// Unwrap возвращает исходную ошибку
+func (e *stackError) Unwrap() error { return e.err }
+
+// hasStack проверяет, что в цепочке ошибки уже есть стек вызовов
+func hasStack(err error) bool {
+	var se *stackError
+	return errors.As(err, &se)
+}
+
+// Errf создаёт ошибку как fmt.Errorf() и сохраняет стек вызовов
+// (если ни одна из обёрнутых через %w ошибок его ещё не содержит).
+// Имя Errorf занято функцией журналирования с уровнем ERROR.
+func Errf(format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	if hasStack(err) {
+		return err
+	}
+	return &stackError{err: err, pcs: callers(2)}
+}
+
+// WrapErr оборачивает ошибку сообщением ("msg: err") и сохраняет стек
+// вызовов (если ошибка его ещё не содержит). Для err == nil возвращает nil.
+func WrapErr(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("%s: %w", msg, err)
+	if hasStack(err) {
+		return err
+	}
+	return &stackError{err: err, pcs: callers(2)}
+}
+
+// ErrStack возвращает стек вызовов, сохранённый в цепочке ошибки
+// (или nil, если стека нет)
+func ErrStack(err error) Stack {
+	var se *stackError
+	if errors.As(err, &se) {
+		return NewStack(se.pcs)
+	}
+	return nil
+}
+
+// errRich проверяет, что ошибку имеет смысл выводить развёрнуто
+func errRich(err error) bool {
+	switch err.(type) {
+	case interface{ Unwrap() error }, interface{ Unwrap() []error }, slog.LogValuer:
+		return true
+	}
+	return false
+}
+
+// errValuer - обёртка ошибки для развёрнутого вывода в журнал (см. Err)
+type errValuer struct{ err error }
+
+// Error реализует интерфейс error
+func (e errValuer) Error() string { return e.err.Error() }
+
+// Unwrap возвращает исходную ошибку
+func (e errValuer) Unwrap() error { return e.err }
+
+// LogValue реализует интерфейс slog.LogValuer
+func (e errValuer) LogValue() slog.Value { return ErrValue(e.err) }
+
+// ErrValue возвращает развёрнутое представление ошибки в виде группы
+// (msg, type, value, stack, cause, join)
+func ErrValue(err error) slog.Value {
+	return errValue(err, 0)
+}
+
+// errValue - рекурсивная реализация ErrValue
+func errValue(err error, depth int) slog.Value {
+	var stack Stack
+	if se, ok := err.(*stackError); ok { // стек - свойство исходной ошибки
+		stack = NewStack(se.pcs)
+		err = se.err
+	}
+
+	attrs := []slog.Attr{
+		slog.String("msg", err.Error()),
+		slog.String("type", fmt.Sprintf("%T", err)),
+	}
+	if lv, ok := err.(slog.LogValuer); ok {
+		attrs = append(attrs, slog.Attr{Key: "value", Value: lv.LogValue().Resolve()})
+	}
+	if len(stack) != 0 {
+		attrs = append(attrs, slog.Any(StackKey, stack))
+	}
+
+	if depth < errMaxDepth {
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			if cause := e.Unwrap(); cause != nil {
+				attrs = append(attrs, slog.Attr{Key: "cause", Value: errValue(cause, depth+1)})
+			}
+		case interface{ Unwrap() []error }:
+			join := make([]slog.Attr, 0, len(e.Unwrap()))
+			for i, branch := range e.Unwrap() {
+				if branch != nil {
+					join = append(join, slog.Attr{
+						Key: strconv.Itoa(i), Value: errValue(branch, depth+1)})
+				}
+			}
+			attrs = append(attrs, slog.Attr{Key: "join", Value: slog.GroupValue(join...)})
+		}
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// EOF: "richerr.go"
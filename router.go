@@ -0,0 +1,399 @@
+// File: "router.go"
+
+package xlog
+
+import (
+	"context"
+	"fmt"
+	"log/slog" // go>=1.21
+	"strings"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Маршрутизация записей по правилам.
+// Router содержит именованные маршруты (дополнительные логгеры *Logger)
+// и упорядоченный список правил RouteRule. Правило выбирает записи по
+// диапазону уровней, имени логгера (Named), пакету места вызова,
+// наличию атрибутов и выражению фильтра (см. CompileFilter) и направляет
+// их в заданные маршруты. После совпавшего правила проверка прекращается,
+// если у правила не установлен признак Continue. Записи, не совпавшие
+// ни с одним правилом, направляются в маршруты по умолчанию.
+// Специальный маршрут RouteNext ("") - собственный вывод логгера.
+//
+// Логгер с маршрутизацией создаётся методом Logger.WithRouter().
+// Атрибуты With, группы WithGroup и имена Named дочерних логгеров
+// применяются как к собственному выводу, так и к каждому маршруту,
+// поэтому во всех журналах записи имеют одинаковый вид (logId и logSum
+// каждый маршрут вычисляет сам). Middleware маршрутизатора
+// (Router.Middleware) видит только атрибуты записи.
+
+// Собственный вывод логгера (следующий обработчик) в списках маршрутов
+const RouteNext = ""
+
+// RouteRule - правило маршрутизации записей
+type RouteRule struct {
+	// Диапазон уровней записей (nil - без ограничения), границы включаются
+	MinLevel slog.Leveler
+	MaxLevel slog.Leveler
+
+	// Имя логгера или префикс иерархии имён ("db" для "db" и "db.pool"),
+	// "" - любой логгер
+	Logger string
+
+	// Путь пакета места вызова или его префикс ("github.com/acme/db"),
+	// "" - любой пакет
+	Package string
+
+	// Ключи атрибутов, которые должны присутствовать в записи
+	// ("user", "req.id"), с учётом атрибутов With и ContextWith
+	Has []string
+
+	// Выражение фильтра (например, `status>=500 && user=="42"`),
+	// "" - любая запись
+	Match string
+
+	// Имена маршрутов (RouteNext - собственный вывод логгера)
+	To []string
+
+	// Продолжить проверку следующих правил после совпадения
+	Continue bool
+}
+
+// Скомпилированное правило маршрутизации
+type routeRule struct {
+	RouteRule
+	match *Filter // скомпилированное выражение Match (или nil)
+	to    []int   // индексы маршрутов (-1 - RouteNext)
+}
+
+// Router - маршрутизатор записей (см. NewRouter)
+type Router struct {
+	names []string     // имена маршрутов
+	dests []*Logger    // логгеры маршрутов
+	rules []*routeRule // правила
+	def   []int        // маршруты по умолчанию
+}
+
+// NewRouter создаёт маршрутизатор записей
+//
+//	routes - именованные маршруты (логгеры)
+//	rules - упорядоченные правила маршрутизации
+//	def - маршруты по умолчанию (nil - RouteNext)
+func NewRouter(routes map[string]*Logger, rules []RouteRule, def ...string) (*Router, error) {
+	rt := &Router{}
+	for name, log := range routes {
+		if name == RouteNext || log == nil {
+			return nil, fmt.Errorf("router: bad route %q", name)
+		}
+		rt.names = append(rt.names, name)
+		rt.dests = append(rt.dests, log)
+	}
+	if def == nil {
+		def = []string{RouteNext}
+	}
+	var err error
+	if rt.def, err = rt.index(def); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		r := &routeRule{RouteRule: rule}
+		if rule.Match != "" {
+			if r.match, err = CompileFilter(rule.Match); err != nil {
+				return nil, fmt.Errorf("router: %w", err)
+			}
+		}
+		if r.to, err = rt.index(rule.To); err != nil {
+			return nil, err
+		}
+		rt.rules = append(rt.rules, r)
+	}
+	return rt, nil
+}
+
+// index возвращает индексы маршрутов по именам
+func (rt *Router) index(names []string) ([]int, error) {
+	idx := make([]int, 0, len(names))
+next:
+	for _, name := range names {
+		if name == RouteNext {
+			idx = append(idx, -1)
+			continue
+		}
+		for i, n := range rt.names {
+			if n == name {
+				idx = append(idx, i)
+				continue next
+			}
+		}
+		return nil, fmt.Errorf("router: unknown route %q", name)
+	}
+	return idx, nil
+}
+
+// matchPrefix проверяет, что s совпадает с шаблоном p или p является
+// префиксом s до разделителя sep
+func matchPrefix(s, p string, sep byte) bool {
+	return s == p || (strings.HasPrefix(s, p) && len(s) > len(p) && s[len(p)] == sep)
+}
+
+// route возвращает список индексов маршрутов записи (без повторов)
+func (rt *Router) route(fr *filterRec) []int {
+	var dests []int
+	add := func(idx []int) {
+	next:
+		for _, i := range idx {
+			for _, j := range dests {
+				if i == j {
+					continue next
+				}
+			}
+			dests = append(dests, i)
+		}
+	}
+
+	matched := false
+	for _, r := range rt.rules {
+		if !r.matchRec(fr) {
+			continue
+		}
+		matched = true
+		add(r.to)
+		if !r.Continue {
+			break
+		}
+	}
+	if !matched {
+		add(rt.def)
+	}
+	return dests
+}
+
+// matchRec проверяет соответствие записи правилу
+func (r *routeRule) matchRec(fr *filterRec) bool {
+	level := fr.r.Level
+	if r.MinLevel != nil && level < r.MinLevel.Level() ||
+		r.MaxLevel != nil && level > r.MaxLevel.Level() {
+		return false
+	}
+	if r.Logger != "" && !matchPrefix(fr.name, r.Logger, LoggerSep[0]) {
+		return false
+	}
+	if r.Package != "" {
+		if fr.r.PC == 0 || !matchPrefix(funcPackage(fr.source().Function), r.Package, '/') {
+			return false
+		}
+	}
+	for _, key := range r.Has {
+		if _, ok := fr.attr(key); !ok {
+			return false
+		}
+	}
+	return r.match == nil || r.match.match(fr)
+}
+
+// Route возвращает имена маршрутов записи (RouteNext - собственный вывод).
+// Имя логгера берётся из атрибута "logger" записи.
+func (rt *Router) Route(r slog.Record) []string {
+	var names []string
+	for _, i := range rt.route(&filterRec{r: &r, name: recordLogger(r)}) {
+		if i < 0 {
+			names = append(names, RouteNext)
+		} else {
+			names = append(names, rt.names[i])
+		}
+	}
+	return names
+}
+
+// Middleware возвращает Middleware маршрутизатора. В отличие от
+// Logger.WithRouter, маршрутам передаются только атрибуты записи.
+// Имя логгера (для RouteRule.Logger) берётся из атрибута "logger",
+// поэтому Middleware следует передавать в New(conf, mws...).
+func (rt *Router) Middleware() Middleware {
+	handlers := make([]slog.Handler, len(rt.dests))
+	for i, log := range rt.dests {
+		handlers[i] = log.Handler()
+	}
+	mwf := func(ctx context.Context, r slog.Record, next HandleFunc) error {
+		fr := &filterRec{r: &r, name: recordLogger(r), with: ContextAttrs(ctx)}
+		return rt.handle(ctx, r, fr,
+			handlers, func(_ context.Context, _ slog.Level) bool { return true }, next)
+	}
+	return NewMiddleware(mwf)
+}
+
+// handle направляет запись в маршруты
+func (rt *Router) handle(ctx context.Context, r slog.Record, fr *filterRec,
+	handlers []slog.Handler, enabled func(context.Context, slog.Level) bool,
+	next HandleFunc) error {
+	dests := rt.route(fr)
+	var err error
+	for n, i := range dests {
+		rec := r
+		if n < len(dests)-1 {
+			rec = r.Clone() // хендлеры могут добавлять атрибуты
+		}
+		var e error
+		if i < 0 {
+			if enabled(ctx, r.Level) {
+				e = next(ctx, rec)
+			}
+		} else if h := handlers[i]; h.Enabled(ctx, r.Level) {
+			e = h.Handle(ctx, rec)
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Хендлер логгера с маршрутизацией (см. Logger.WithRouter)
+type routerHandler struct {
+	rt     *Router
+	next   slog.Handler   // собственный вывод логгера
+	dests  []slog.Handler // хендлеры маршрутов (с учётом With/WithGroup)
+	name   string         // имя логгера
+	with   []slog.Attr    // корневые атрибуты (With)
+	groups []string       // открытые группы
+}
+
+// Убедиться, что *routerHandler соответствует интерфейсу slog.Handler
+var _ slog.Handler = (*routerHandler)(nil)
+
+// Enabled() требуется для интерфейса slog.Handler.
+// Запись выводится, если её принимает собственный вывод или любой маршрут.
+func (h *routerHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.next.Enabled(ctx, level) {
+		return true
+	}
+	for _, d := range h.dests {
+		if d.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle() требуется для интерфейса slog.Handler
+func (h *routerHandler) Handle(ctx context.Context, r slog.Record) error {
+	with := h.with
+	if attrs := ContextAttrs(ctx); len(attrs) != 0 {
+		with = append(with[:len(with):len(with)], attrs...)
+	}
+	fr := &filterRec{r: &r, name: h.name, with: with, groups: h.groups}
+	return h.rt.handle(ctx, r, fr, h.dests, h.next.Enabled, h.next.Handle)
+}
+
+// clone возвращает копию хендлера с преобразованными хендлерами
+func (h *routerHandler) clone(fn func(slog.Handler) slog.Handler) *routerHandler {
+	hNew := *h
+	hNew.next = fn(h.next)
+	hNew.dests = make([]slog.Handler, len(h.dests))
+	for i, d := range h.dests {
+		hNew.dests[i] = fn(d)
+	}
+	return &hNew
+}
+
+// WithAttrs() требуется для интерфейса slog.Handler
+func (h *routerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	hNew := h.clone(func(d slog.Handler) slog.Handler { return d.WithAttrs(attrs) })
+	if len(h.groups) == 0 {
+		hNew.with = append(h.with[:len(h.with):len(h.with)], attrs...) // всегда копия
+		for _, attr := range attrs {
+			if attr.Key == LoggerKey && attr.Value.Kind() == slog.KindString {
+				hNew.name = attr.Value.String() // имя логгера
+			}
+		}
+	}
+	return hNew
+}
+
+// WithGroup() требуется для интерфейса slog.Handler
+func (h *routerHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	hNew := h.clone(func(d slog.Handler) slog.Handler { return d.WithGroup(name) })
+	hNew.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return hNew
+}
+
+// Named() требуется для поддержки именованных логгеров (см. IdHandler.Named)
+func (h *routerHandler) Named(name string) slog.Handler {
+	hNew := h.clone(func(d slog.Handler) slog.Handler {
+		if nh, ok := d.(namedHandler); ok {
+			return nh.Named(name)
+		}
+		return d
+	})
+	if h.name != "" {
+		name = h.name + LoggerSep + name
+	}
+	hNew.name = name
+	return hNew
+}
+
+// Name возвращает имя логгера
+func (h *routerHandler) Name() string { return h.name }
+
+// WithChain() требуется для поддержки именованных цепочек контрольных сумм
+// (только собственный вывод логгера)
+func (h *routerHandler) WithChain(name string) slog.Handler {
+	ch, ok := h.next.(chainHandler)
+	if !ok {
+		return h
+	}
+	hNew := *h
+	hNew.next = ch.WithChain(name)
+	return &hNew
+}
+
+// Levels() требуется для поддержки переопределения уровней журналирования
+// (уровни собственного вывода логгера)
+func (h *routerHandler) Levels() *Levels {
+	if lh, ok := h.next.(levelsHandler); ok {
+		return lh.Levels()
+	}
+	return nil
+}
+
+// Filters() требуется для поддержки фильтров записей (фильтры собственного
+// вывода логгера)
+func (h *routerHandler) Filters() *Filters {
+	if fh, ok := h.next.(filtersHandler); ok {
+		return fh.Filters()
+	}
+	return nil
+}
+
+// WithRouter создает дочерний логгер с маршрутизацией записей
+func (c *Logger) WithRouter(rt *Router) *Logger {
+	if rt == nil {
+		return c
+	}
+	h := &routerHandler{rt: rt, next: c.Handler(), dests: make([]slog.Handler, len(rt.dests))}
+	for i, log := range rt.dests {
+		h.dests[i] = log.Handler()
+	}
+	if nh, ok := h.next.(nameHandler); ok {
+		h.name = nh.Name() // имя родительского логгера
+	}
+	return &Logger{
+		Logger: slog.New(h),
+		Level:  c.Level,
+		Writer: c.Writer,
+	}
+}
+
+// WithRouter создает дочерний логгер с маршрутизацией записей
+// на основе глобального логгера
+func WithRouter(rt *Router) *Logger {
+	return currentClog.WithRouter(rt)
+}
+
+// EOF: "router.go"
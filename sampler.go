@@ -0,0 +1,194 @@
+// File: "sampler.go"
+
+package xlog
+
+import (
+	"context"
+	"hash/maphash"
+	"log/slog" // go>=1.21
+	"sync"
+	"sync/atomic"
+	"time"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Сэмплирование записей (по аналогии с zap.Sampler).
+// В пределах каждого интервала Tick для каждого ключа (по умолчанию
+// уровень + сообщение) выводятся первые First записей, затем каждая
+// Thereafter-я, остальные отбрасываются. Записи с уровнем не ниже
+// PassLevel (по умолчанию ERROR) не сэмплируются.
+// Число отброшенных записей доступно методом Counters() и периодически
+// (не чаще Report) выводится в журнал записью с атрибутом "sampled".
+// Как и демпфер (см. Damper), сэмплер следует подключать методом
+// Logger.WithMiddleware(), тогда отброшенные записи не нарушают цепочку
+// контрольных сумм.
+
+// Ключ атрибута числа отброшенных сэмплером записей
+const SampledKey = "sampled"
+
+// Сообщение записи о числе отброшенных сэмплером записей
+const SampledMessage = "log records sampled out"
+
+// Параметры сэмплера по умолчанию
+const (
+	DefaultSamplerTick   = time.Second // интервал подсчёта записей
+	DefaultSamplerFirst  = 100         // число выводимых первых записей
+	DefaultSamplerReport = time.Minute // период вывода отчёта
+)
+
+// Параметры сэмплера записей
+type SamplerOptions struct {
+	// Интервал подсчёта записей (по умолчанию DefaultSamplerTick)
+	Tick time.Duration
+
+	// Число первых записей с одинаковым ключом, выводимых в интервале
+	// (по умолчанию DefaultSamplerFirst)
+	First int
+
+	// После First записей выводить каждую Thereafter-ю запись
+	// (0 - не выводить)
+	Thereafter int
+
+	// Записи с уровнем не ниже PassLevel не сэмплируются
+	// (по умолчанию LevelError)
+	PassLevel slog.Leveler
+
+	// Функция ключа записи (по умолчанию уровень + сообщение)
+	Key func(r slog.Record) string
+
+	// Период вывода записи о числе отброшенных записей
+	// (по умолчанию DefaultSamplerReport, отрицательное значение - не выводить)
+	Report time.Duration
+}
+
+// Sampler - сэмплер записей (см. NewSampler)
+type Sampler struct {
+	opts    SamplerOptions
+	seed    maphash.Seed      // затравка хеша ключей
+	counts  map[uint64]uint64 // счётчики записей интервала по ключам
+	tickEnd time.Time         // окончание интервала
+	report  bool              // признак ожидания отчёта
+	pending uint64            // число отброшенных записей для отчёта
+	since   time.Time         // начало периода отчёта
+	next    HandleFunc        // следующий обработчик (для отчёта)
+	mx      sync.Mutex        // мьютекс для безопасного доступа к полям
+
+	passed  atomic.Uint64 // всего выведено записей
+	sampled atomic.Uint64 // всего отброшено записей
+}
+
+// NewSampler создаёт сэмплер записей
+//
+//	opts - параметры сэмплера или nil (параметры по умолчанию)
+func NewSampler(opts *SamplerOptions) *Sampler {
+	s := &Sampler{seed: maphash.MakeSeed(), counts: map[uint64]uint64{}}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Tick <= 0 {
+		s.opts.Tick = DefaultSamplerTick
+	}
+	if s.opts.First <= 0 {
+		s.opts.First = DefaultSamplerFirst
+	}
+	if s.opts.PassLevel == nil {
+		s.opts.PassLevel = LevelError
+	}
+	if s.opts.Report == 0 {
+		s.opts.Report = DefaultSamplerReport
+	}
+	return s
+}
+
+// NewMiddlewareSampler создаёт Middleware сэмплера записей
+//
+//	opts - параметры сэмплера или nil (параметры по умолчанию)
+func NewMiddlewareSampler(opts *SamplerOptions) Middleware {
+	return NewSampler(opts).Middleware()
+}
+
+// Middleware возвращает Middleware сэмплера
+func (s *Sampler) Middleware() Middleware {
+	return NewMiddleware(s.handle)
+}
+
+// Counters возвращает общее число выведенных и отброшенных записей
+func (s *Sampler) Counters() (passed, sampled uint64) {
+	return s.passed.Load(), s.sampled.Load()
+}
+
+// key вычисляет хеш ключа записи
+func (s *Sampler) key(r slog.Record) uint64 {
+	if s.opts.Key != nil {
+		return maphash.String(s.seed, s.opts.Key(r))
+	}
+	var h maphash.Hash
+	h.SetSeed(s.seed)
+	h.WriteString(LevelToLabel(r.Level))
+	h.WriteByte(0)
+	h.WriteString(r.Message)
+	return h.Sum64()
+}
+
+// handle реализует MiddlewareFunc сэмплера
+func (s *Sampler) handle(ctx context.Context, r slog.Record, next HandleFunc) error {
+	if r.Level >= s.opts.PassLevel.Level() {
+		s.passed.Add(1)
+		return next(ctx, r)
+	}
+
+	key := s.key(r)
+	now := time.Now()
+
+	s.mx.Lock()
+	if now.After(s.tickEnd) { // новый интервал
+		clear(s.counts)
+		s.tickEnd = now.Add(s.opts.Tick)
+	}
+	s.counts[key]++
+	n := s.counts[key]
+	first := uint64(s.opts.First)
+	pass := n <= first ||
+		(s.opts.Thereafter > 0 && (n-first)%uint64(s.opts.Thereafter) == 0)
+	if pass {
+		s.mx.Unlock()
+		s.passed.Add(1)
+		return next(ctx, r)
+	}
+
+	s.sampled.Add(1)
+	if s.pending == 0 {
+		s.since = now
+	}
+	s.pending++
+	s.next = next
+	if !s.report && s.opts.Report > 0 { // запланировать отчёт
+		s.report = true
+		time.AfterFunc(s.opts.Report, s.flush)
+	}
+	s.mx.Unlock()
+	return nil
+}
+
+// flush выводит запись о числе отброшенных записей
+func (s *Sampler) flush() {
+	s.mx.Lock()
+	pending, since, next := s.pending, s.since, s.next
+	s.pending, s.report = 0, false
+	s.mx.Unlock()
+	if pending == 0 || next == nil {
+		return
+	}
+
+	r := slog.NewRecord(time.Now(), LevelNotice, SampledMessage, 0)
+	r.AddAttrs(
+		slog.Uint64(SampledKey, pending),
+		slog.Duration(IntervalKey, time.Since(since)))
+	_ = next(context.Background(), r)
+}
+
+// Flush досрочно выводит запись о числе отброшенных записей
+// (например, перед завершением приложения)
+func (s *Sampler) Flush() { s.flush() }
+
+// EOF: "sampler.go"
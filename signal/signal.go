@@ -12,6 +12,8 @@ var (
 	CtrlBS  chan None // Ctrl+\ -> SIGQUIT
 	SIGTERM chan None
 	SIGHUP  chan None
+	SIGUSR1 chan None // only unix, see LevelControl
+	SIGUSR2 chan None // only unix, see LevelControl
 )
 
 func send(ch chan<- None) bool {
@@ -0,0 +1,40 @@
+// File: "signal_level.go"
+
+package signal
+
+import (
+	"time"
+
+	"github.com/azorg/xlog"
+)
+
+// Temporary log level escalation by signals:
+// SIGUSR1 sets level for duration d (see xlog.Logger.SetLvlFor),
+// SIGUSR2 restores level (see xlog.Logger.RestoreLevel).
+// If log is nil, then current (global) logger is used.
+// SIGUSR1 and SIGUSR2 are subscribed only by this function (only unix).
+// Function returns immediately (serve signals in goroutine).
+func LevelControl(log *xlog.Logger, level string, d time.Duration) {
+	setupUser()
+
+	logger := func() *xlog.Logger {
+		if log == nil {
+			return xlog.Current()
+		}
+		return log
+	}
+
+	go func() {
+		for {
+			select {
+			case <-SIGUSR1:
+				logger().SetLvlFor(level, d)
+
+			case <-SIGUSR2:
+				logger().RestoreLevel()
+			}
+		}
+	}()
+}
+
+// EOF: "signal_level.go"
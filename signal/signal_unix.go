@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/azorg/xlog"
@@ -20,6 +21,8 @@ func init() {
 	CtrlBS = make(chan None, CHAN_SIZE)
 	SIGTERM = make(chan None, CHAN_SIZE)
 	SIGHUP = make(chan None, CHAN_SIZE)
+	SIGUSR1 = make(chan None, CHAN_SIZE)
+	SIGUSR2 = make(chan None, CHAN_SIZE)
 
 	ch := make(chan os.Signal, CHAN_SIZE)
 
@@ -68,4 +71,30 @@ func init() {
 	}()
 }
 
+var userOnce sync.Once
+
+// Setup SIGUSR1 | SIGUSR2 channels on demand (see LevelControl):
+// by default these signals terminate the process, so an application
+// that does not handle them must keep the default behaviour
+func setupUser() {
+	userOnce.Do(func() {
+		ch := make(chan os.Signal, CHAN_SIZE)
+		signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+
+		go func() {
+			for sig := range ch {
+				switch sig {
+				case syscall.SIGUSR1:
+					xlog.Trace("SIGUSR1 received")
+					send(SIGUSR1)
+
+				case syscall.SIGUSR2:
+					xlog.Trace("SIGUSR2 received")
+					send(SIGUSR2)
+				} // switch
+			} // for
+		}()
+	})
+}
+
 // EOF: "signal_unix.go"
@@ -12,13 +12,15 @@ import (
 	"github.com/azorg/xlog"
 )
 
-// Setup Ctrl+C | Ctrl+Z | Ctrl+\ | SIGTERM | SIGHUP channels
+// Setup Ctrl+C | Ctrl+Z | Ctrl+\ | SIGTERM | SIGHUP | SIGUSR1 | SIGUSR2 channels
 func init() {
 	CtrlC = make(chan None, CHAN_SIZE)
 	CtrlZ = make(chan None, CHAN_SIZE)
 	CtrlBS = make(chan None, CHAN_SIZE)
 	SIGTERM = make(chan None, CHAN_SIZE)
 	SIGHUP = make(chan None, CHAN_SIZE)
+	SIGUSR1 = make(chan None, CHAN_SIZE)
+	SIGUSR2 = make(chan None, CHAN_SIZE)
 
 	ch := make(chan os.Signal, 1)
 
@@ -36,4 +38,7 @@ func init() {
 	}()
 }
 
+// SIGUSR1 | SIGUSR2 are not supported under Windows
+func setupUser() {}
+
 // EOF: "signal_windows.go"
@@ -0,0 +1,66 @@
+// File: "stack.go"
+
+package xlog
+
+import "runtime"
+
+// Стек вызовов для записей журнала.
+// Для записей с уровнем не ниже IdOptions.StackLevel (Conf.StackLevel,
+// LOG_STACK_LEVEL) IdHandler добавляет атрибут "stack" со стеком вызовов
+// горутины, начиная с места вызова функции журналирования (кадры
+// function, file, line). Имена файлов укорачиваются так же, как в блоке
+// "source" (SrcPkg, SrcExt). Для записей уровня EMERG и выше при
+// StackAll=true дополнительно добавляется атрибут "goroutines" с текстовым
+// дампом стеков всех горутин (runtime.Stack).
+// Стек добавляется до вычисления контрольной суммы и входит в ChecksumFull.
+// При заданном Limits.Size стек и дамп ограничиваются остатком общего
+// размера записи.
+
+// Ключ для дампа стеков всех горутин в журнале (если StackAll=true)
+const GoroutinesKey = "goroutines"
+
+// Максимальный размер дампа стеков всех горутин
+const goroutinesMaxSize = 1 << 20 // 1 MiB
+
+// recordStack возвращает стек вызовов от места вызова функции
+// журналирования (pc - slog.Record.PC).
+// Если место вызова не найдено в стеке текущей горутины (например запись
+// обрабатывается асинхронно), то стек содержит только кадр pc.
+func recordStack(pc uintptr, pkg, ext bool) Stack {
+	if pc == 0 {
+		return nil
+	}
+	var pcs [4 * stackMaxDepth]uintptr
+	n := runtime.Callers(2, pcs[:])
+	stack := []uintptr{pc}
+	for i := 0; i < n; i++ {
+		if pcs[i] == pc {
+			stack = pcs[i:min(n, i+stackMaxDepth)]
+			break
+		}
+	}
+	return NewStack(stack).Trim(pkg, ext)
+}
+
+// Trim укорачивает имена файлов в кадрах стека вызовов как в блоке "source"
+// (pkg - оставить каталог, ext - оставить расширение ".go")
+func (s Stack) Trim(pkg, ext bool) Stack {
+	for i := range s {
+		s[i].File = trimSrcFile(s[i].File, pkg, ext)
+	}
+	return s
+}
+
+// allGoroutines возвращает текстовый дамп стеков всех горутин
+func allGoroutines() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= goroutinesMaxSize {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// EOF: "stack.go"
@@ -184,6 +184,32 @@ func Logf(level slog.Level, format string, args ...any) {
 	logf(context.Background(), currentClog.Logger, level, format, args...)
 }
 
+// Lvl записывает сообщение в структурированный журнал с уровнем,
+// заданным идентификатором ("audit", "notice", ...), в т.ч. уровнем,
+// зарегистрированным RegisterLevel(). Неизвестный идентификатор
+// соответствует DefaultLevel (см. LevelFromString).
+func (c *Logger) Lvl(level string, msg string, args ...any) {
+	logs(context.Background(), c.Logger, LevelFromString(level), msg, args...)
+}
+
+// Lvl записывает сообщение в структурированный журнал по умолчанию
+// с уровнем, заданным идентификатором ("audit", "notice", ...)
+func Lvl(level string, msg string, args ...any) {
+	logs(context.Background(), currentClog.Logger, LevelFromString(level), msg, args...)
+}
+
+// Lvlf записывает сообщение в традиционный журнал с уровнем,
+// заданным идентификатором ("audit", "notice", ...)
+func (c *Logger) Lvlf(level string, format string, args ...any) {
+	logf(context.Background(), c.Logger, LevelFromString(level), format, args...)
+}
+
+// Lvlf записывает сообщение в традиционный журнал по умолчанию
+// с уровнем, заданным идентификатором ("audit", "notice", ...)
+func Lvlf(level string, format string, args ...any) {
+	logf(context.Background(), currentClog.Logger, LevelFromString(level), format, args...)
+}
+
 // Floodf записывает сообщение в традиционный журнал (LevelFlood)
 func (c *Logger) Floodf(format string, args ...any) {
 	logf(context.Background(), c.Logger, LevelFlood, format, args...)
@@ -302,10 +328,15 @@ func Fatalf(format string, args ...any) {
 // или возвращает "пустой" атрибут, если err == nil.
 // Таким образом можно логировать сообщения и исключать
 // не информативные записи типа "err=nil".
+// Ошибка с цепочкой обёрток, ветвями errors.Join, стеком вызовов
+// или реализующая slog.LogValuer выводится развёрнуто (см. ErrValue).
 func Err(err error) slog.Attr {
 	if err == nil {
 		return slog.Any("", nil)
 	}
+	if errRich(err) {
+		return slog.Any(ErrKey, errValuer{err})
+	}
 	return slog.Any(ErrKey, err)
 }
 
@@ -0,0 +1,329 @@
+// File: "sugarctx.go"
+
+package xlog
+
+import (
+	"context"
+	"log/slog" // go>=1.21
+	"os"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Функции данного файла аналогичны функциям из "sugar.go", но принимают
+// контекст, который передаётся хендлеру (например, для извлечения
+// W3C traceparent, см. "traceparent.go").
+
+// FloodContext записывает сообщение в журнал (LevelFlood) с заданным контекстом
+func (c *Logger) FloodContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelFlood, msg, args...)
+}
+
+// FloodContext записывает сообщение в журнал по умолчанию (LevelFlood)
+// с заданным контекстом
+func FloodContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelFlood, msg, args...)
+}
+
+// TraceContext записывает сообщение в журнал (LevelTrace) с заданным контекстом
+func (c *Logger) TraceContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelTrace, msg, args...)
+}
+
+// TraceContext записывает сообщение в журнал по умолчанию (LevelTrace)
+// с заданным контекстом
+func TraceContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelTrace, msg, args...)
+}
+
+// DebugContext записывает сообщение в журнал (LevelDebug) с заданным контекстом
+func (c *Logger) DebugContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelDebug, msg, args...)
+}
+
+// DebugContext записывает сообщение в журнал по умолчанию (LevelDebug)
+// с заданным контекстом
+func DebugContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelDebug, msg, args...)
+}
+
+// InfoContext записывает сообщение в журнал (LevelInfo) с заданным контекстом
+func (c *Logger) InfoContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelInfo, msg, args...)
+}
+
+// InfoContext записывает сообщение в журнал по умолчанию (LevelInfo)
+// с заданным контекстом
+func InfoContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelInfo, msg, args...)
+}
+
+// NoticeContext записывает сообщение в журнал (LevelNotice) с заданным контекстом
+func (c *Logger) NoticeContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelNotice, msg, args...)
+}
+
+// NoticeContext записывает сообщение в журнал по умолчанию (LevelNotice)
+// с заданным контекстом
+func NoticeContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelNotice, msg, args...)
+}
+
+// WarnContext записывает сообщение в журнал (LevelWarn) с заданным контекстом
+func (c *Logger) WarnContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelWarn, msg, args...)
+}
+
+// WarnContext записывает сообщение в журнал по умолчанию (LevelWarn)
+// с заданным контекстом
+func WarnContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelWarn, msg, args...)
+}
+
+// ErrorContext записывает сообщение в журнал (LevelError) с заданным контекстом
+func (c *Logger) ErrorContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelError, msg, args...)
+}
+
+// ErrorContext записывает сообщение в журнал по умолчанию (LevelError)
+// с заданным контекстом
+func ErrorContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelError, msg, args...)
+}
+
+// CritContext записывает сообщение в журнал (LevelCrit) с заданным контекстом
+func (c *Logger) CritContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelCrit, msg, args...)
+}
+
+// CritContext записывает сообщение в журнал по умолчанию (LevelCrit)
+// с заданным контекстом
+func CritContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelCrit, msg, args...)
+}
+
+// AlertContext записывает сообщение в журнал (LevelAlert) с заданным контекстом
+func (c *Logger) AlertContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelAlert, msg, args...)
+}
+
+// AlertContext записывает сообщение в журнал по умолчанию (LevelAlert)
+// с заданным контекстом
+func AlertContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelAlert, msg, args...)
+}
+
+// EmergContext записывает сообщение в журнал (LevelEmerg) с заданным контекстом
+func (c *Logger) EmergContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelEmerg, msg, args...)
+}
+
+// EmergContext записывает сообщение в журнал по умолчанию (LevelEmerg)
+// с заданным контекстом
+func EmergContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelEmerg, msg, args...)
+}
+
+// FatalContext записывает сообщение в журнал (LevelFatal) с заданным
+// контекстом и завершает приложение путем вызова os.Exit(1)
+func (c *Logger) FatalContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelFatal, msg, args...)
+	os.Exit(1)
+}
+
+// FatalContext записывает сообщение в журнал по умолчанию (LevelFatal)
+// с заданным контекстом и завершает приложение путем вызова os.Exit(1)
+func FatalContext(ctx context.Context, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelFatal, msg, args...)
+	os.Exit(1)
+}
+
+// PanicContext записывает сообщение в журнал (LevelPanic) с заданным
+// контекстом и завершает приложение путем вызова panic()
+func (c *Logger) PanicContext(ctx context.Context, msg string) {
+	logs(ctx, c.Logger, LevelPanic, msg)
+	panic(msg)
+}
+
+// PanicContext записывает сообщение в журнал по умолчанию (LevelPanic)
+// с заданным контекстом и завершает приложение путем вызова panic()
+func PanicContext(ctx context.Context, msg string) {
+	logs(ctx, currentClog.Logger, LevelPanic, msg)
+	panic(msg)
+}
+
+// LogfContext записывает сообщение в традиционный журнал с заданным
+// уровнем журналирования и заданным контекстом
+func (c *Logger) LogfContext(
+	ctx context.Context, level slog.Level, format string, args ...any) {
+	logf(ctx, c.Logger, level, format, args...)
+}
+
+// LogfContext записывает сообщение в традиционный журнал по умолчанию
+// с заданным уровнем журналирования и заданным контекстом
+func LogfContext(
+	ctx context.Context, level slog.Level, format string, args ...any) {
+	logf(ctx, currentClog.Logger, level, format, args...)
+}
+
+// LvlContext записывает сообщение в структурированный журнал с уровнем,
+// заданным идентификатором ("audit", ...), и заданным контекстом
+func (c *Logger) LvlContext(
+	ctx context.Context, level string, msg string, args ...any) {
+	logs(ctx, c.Logger, LevelFromString(level), msg, args...)
+}
+
+// LvlContext записывает сообщение в структурированный журнал по умолчанию
+// с уровнем, заданным идентификатором ("audit", ...), и заданным контекстом
+func LvlContext(ctx context.Context, level string, msg string, args ...any) {
+	logs(ctx, currentClog.Logger, LevelFromString(level), msg, args...)
+}
+
+// LvlfContext записывает сообщение в традиционный журнал с уровнем,
+// заданным идентификатором ("audit", ...), и заданным контекстом
+func (c *Logger) LvlfContext(
+	ctx context.Context, level string, format string, args ...any) {
+	logf(ctx, c.Logger, LevelFromString(level), format, args...)
+}
+
+// LvlfContext записывает сообщение в традиционный журнал по умолчанию
+// с уровнем, заданным идентификатором ("audit", ...), и заданным контекстом
+func LvlfContext(ctx context.Context, level string, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelFromString(level), format, args...)
+}
+
+// FloodfContext записывает сообщение в традиционный журнал (LevelFlood)
+// с заданным контекстом
+func (c *Logger) FloodfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelFlood, format, args...)
+}
+
+// FloodfContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelFlood) с заданным контекстом
+func FloodfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelFlood, format, args...)
+}
+
+// TracefContext записывает сообщение в традиционный журнал (LevelTrace)
+// с заданным контекстом
+func (c *Logger) TracefContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelTrace, format, args...)
+}
+
+// TracefContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelTrace) с заданным контекстом
+func TracefContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelTrace, format, args...)
+}
+
+// DebugfContext записывает сообщение в традиционный журнал (LevelDebug)
+// с заданным контекстом
+func (c *Logger) DebugfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelDebug, format, args...)
+}
+
+// DebugfContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelDebug) с заданным контекстом
+func DebugfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelDebug, format, args...)
+}
+
+// InfofContext записывает сообщение в традиционный журнал (LevelInfo)
+// с заданным контекстом
+func (c *Logger) InfofContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelInfo, format, args...)
+}
+
+// InfofContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelInfo) с заданным контекстом
+func InfofContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelInfo, format, args...)
+}
+
+// NoticefContext записывает сообщение в традиционный журнал (LevelNotice)
+// с заданным контекстом
+func (c *Logger) NoticefContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelNotice, format, args...)
+}
+
+// NoticefContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelNotice) с заданным контекстом
+func NoticefContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelNotice, format, args...)
+}
+
+// WarnfContext записывает сообщение в традиционный журнал (LevelWarn)
+// с заданным контекстом
+func (c *Logger) WarnfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelWarn, format, args...)
+}
+
+// WarnfContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelWarn) с заданным контекстом
+func WarnfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelWarn, format, args...)
+}
+
+// ErrorfContext записывает сообщение в традиционный журнал (LevelError)
+// с заданным контекстом
+func (c *Logger) ErrorfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelError, format, args...)
+}
+
+// ErrorfContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelError) с заданным контекстом
+func ErrorfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelError, format, args...)
+}
+
+// CritfContext записывает сообщение в традиционный журнал (LevelCrit)
+// с заданным контекстом
+func (c *Logger) CritfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelCrit, format, args...)
+}
+
+// CritfContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelCrit) с заданным контекстом
+func CritfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelCrit, format, args...)
+}
+
+// AlertfContext записывает сообщение в традиционный журнал (LevelAlert)
+// с заданным контекстом
+func (c *Logger) AlertfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelAlert, format, args...)
+}
+
+// AlertfContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelAlert) с заданным контекстом
+func AlertfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelAlert, format, args...)
+}
+
+// EmergfContext записывает сообщение в традиционный журнал (LevelEmerg)
+// с заданным контекстом
+func (c *Logger) EmergfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelEmerg, format, args...)
+}
+
+// EmergfContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelEmerg) с заданным контекстом
+func EmergfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelEmerg, format, args...)
+}
+
+// FatalfContext записывает сообщение в традиционный журнал (LevelFatal)
+// с заданным контекстом и завершает приложение путем вызова os.Exit(1)
+func (c *Logger) FatalfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, c.Logger, LevelFatal, format, args...)
+	os.Exit(1)
+}
+
+// FatalfContext записывает сообщение в традиционный журнал по умолчанию
+// (LevelFatal) с заданным контекстом и завершает приложение путем
+// вызова os.Exit(1)
+func FatalfContext(ctx context.Context, format string, args ...any) {
+	logf(ctx, currentClog.Logger, LevelFatal, format, args...)
+	os.Exit(1)
+}
+
+// EOF: "sugarctx.go"
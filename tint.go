@@ -162,8 +162,8 @@ func (h *TintHandler) clone() *TintHandler {
 }
 
 // Метод Enabled() реализует интерфейс slog.Handler
-func (h *TintHandler) Enabled(_ context.Context, level slog.Level) bool {
-	return level >= h.level.Level()
+func (h *TintHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() || forcedEnabled(ctx, level)
 }
 
 // Подготовить текстовый буфер для записи в журнал
@@ -233,6 +233,22 @@ func (h *TintHandler) format(r slog.Record) []byte {
 		}
 	}
 
+	// Добавить имя логгера (атрибут "logger") префиксом сообщения
+	name := ""
+	if len(h.groups) == 0 {
+		r.Attrs(func(attr slog.Attr) bool {
+			if attr.Key == LoggerKey && attr.Value.Kind() == slog.KindString {
+				name = attr.Value.String()
+				return false
+			}
+			return true
+		})
+	}
+	if name != "" {
+		h.appendName(buf, name)
+		buf.WriteByte(' ')
+	}
+
 	// Записать текст сообщения
 	if rep == nil {
 		buf.WriteString(r.Message)
@@ -249,7 +265,9 @@ func (h *TintHandler) format(r slog.Record) []byte {
 
 	// Записать атрибуты сообщения
 	r.Attrs(func(attr slog.Attr) bool {
-		h.appendAttr(buf, attr, h.groupPrefix, h.groups)
+		if name == "" || attr.Key != LoggerKey { // имя логгера уже выведено
+			h.appendAttr(buf, attr, h.groupPrefix, h.groups)
+		}
 		return true
 	})
 
@@ -372,10 +390,30 @@ func (h *TintHandler) appendSource(buf *buffer, src *slog.Source) {
 	buf.WriteString(strconv.Itoa(src.Line))
 }
 
+// appendName добавляет имя логгера в буфер ("[db.pool]")
+func (h *TintHandler) appendName(buf *buffer, name string) {
+	if !h.noColor {
+		buf.WriteString(ansiName)
+		defer buf.WriteString(ansiReset)
+	}
+
+	buf.WriteByte('[')
+	buf.WriteString(name)
+	buf.WriteByte(']')
+}
+
 // appendAttr добавляет запись ключ/значение в буфер
 func (h *TintHandler) appendAttr(buf *buffer, attr slog.Attr,
 	groupsPrefix string, groups []string) {
 
+	if attr.Value.Kind() == slog.KindLogValuer {
+		if ev, ok := attr.Value.LogValuer().(errValuer); ok {
+			// Append rich error (see Err)
+			h.appendRichError(buf, attr.Key, ev, groupsPrefix, groups)
+			return
+		}
+	}
+
 	attr.Value = attr.Value.Resolve()
 	if rep := h.replaceAttr; rep != nil && attr.Value.Kind() != slog.KindGroup {
 		attr = rep(groups, attr)
@@ -398,11 +436,13 @@ func (h *TintHandler) appendAttr(buf *buffer, attr slog.Attr,
 		return
 	}
 
-	if err, ok := attr.Value.Any().(error); err != nil && ok {
-		// Append error
-		h.appendError(buf, attr.Key, err, groupsPrefix)
-		buf.WriteByte(' ')
-		return
+	if attr.Value.Kind() == slog.KindAny { // Any() для чисел выделяет память
+		if err, ok := attr.Value.Any().(error); err != nil && ok {
+			// Append error
+			h.appendError(buf, attr.Key, err, groupsPrefix)
+			buf.WriteByte(' ')
+			return
+		}
 	}
 
 	h.appendKey(buf, attr.Key, groupsPrefix)
@@ -469,6 +509,8 @@ func (h *TintHandler) appendValue(buf *buffer, v slog.Value, quote bool) {
 			appendString(buf, string(data), quote, !h.noColor)
 		case *slog.Source:
 			h.appendSource(buf, cv)
+		case Stack:
+			appendString(buf, cv.string(h.sourcePkg, !h.noExt), quote, !h.noColor)
 		default:
 			// Оригинальный код:
 			//appendString(buf, fmt.Sprintf("%+v", cv), quote, !h.noColor)
@@ -489,6 +531,22 @@ func (h *TintHandler) appendError(buf *buffer, key string, err error, groupsPref
 	buf.WriteStringIf(!h.noColor, ansiReset)
 }
 
+// appendRichError добавляет развёрнутую ошибку в буфер:
+// "err=... err.type=... err.cause.msg=..." (см. ErrValue)
+func (h *TintHandler) appendRichError(buf *buffer, key string, ev errValuer,
+	groupsPrefix string, groups []string) {
+
+	h.appendError(buf, key, ev.err, groupsPrefix)
+	buf.WriteByte(' ')
+	groupsPrefix += key + "."
+	groups = append(groups, key)
+	for _, attr := range ev.LogValue().Group() {
+		if attr.Key != "msg" { // текст ошибки уже выведен
+			h.appendAttr(buf, attr, groupsPrefix, groups)
+		}
+	}
+}
+
 // appendString добавляет строку, при необходимости в кавычках в буфер
 func appendString(buf *buffer, s string, quote, color bool) {
 	if quote && !color {
@@ -0,0 +1,193 @@
+// File: "traceparent.go"
+
+package xlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog" // go>=1.21
+	"net/http"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Поддержка W3C Trace Context [https://www.w3.org/TR/trace-context/].
+// Если в контексте записи журнала есть traceparent (см.
+// ContextWithTraceParent), то IdHandler (при IdOptions.TraceCtx=true)
+// добавляет в запись атрибуты "trace_id", "span_id" и "trace_flags",
+// что позволяет связать журнал с трассировками (OpenTelemetry и т.п.).
+// Атрибуты добавляются до вычисления контрольной суммы, поэтому при
+// SumFull=true они входят в "logSum".
+
+// Ключи атрибутов трассировки в журнале
+const (
+	TraceIdKey    = "trace_id"    // идентификатор трассировки (32 hex)
+	SpanIdKey     = "span_id"     // идентификатор span'а (16 hex)
+	TraceFlagsKey = "trace_flags" // флаги трассировки (2 hex)
+)
+
+// HTTP заголовки W3C Trace Context
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// Флаг "sampled" в TraceParent.Flags
+const TraceFlagSampled = 0x01
+
+// Ошибка разбора traceparent
+var ErrBadTraceParent = errors.New("bad traceparent")
+
+// TraceParent - содержимое заголовка W3C traceparent (версия "00")
+type TraceParent struct {
+	TraceId [16]byte // идентификатор трассировки
+	SpanId  [8]byte  // идентификатор родительского span'а
+	Flags   byte     // флаги трассировки (TraceFlagSampled)
+}
+
+// NewTraceParent создаёт новую трассировку со случайными
+// идентификаторами трассировки и span'а
+func NewTraceParent(sampled bool) TraceParent {
+	tp := TraceParent{}
+	for !tp.IsValid() {
+		_, _ = rand.Read(tp.TraceId[:])
+		_, _ = rand.Read(tp.SpanId[:])
+	}
+	if sampled {
+		tp.Flags = TraceFlagSampled
+	}
+	return tp
+}
+
+// ParseTraceParent разбирает значение заголовка traceparent вида
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+// Для будущих версий (не "00") разбираются только известные поля.
+func ParseTraceParent(s string) (TraceParent, error) {
+	tp := TraceParent{}
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return tp, ErrBadTraceParent
+	}
+	var ver [1]byte
+	if !hexDecode(ver[:], s[0:2]) || ver[0] == 0xff ||
+		(ver[0] == 0 && len(s) != 55) || (len(s) > 55 && s[55] != '-') {
+		return tp, ErrBadTraceParent
+	}
+	var flags [1]byte
+	if !hexDecode(tp.TraceId[:], s[3:35]) ||
+		!hexDecode(tp.SpanId[:], s[36:52]) ||
+		!hexDecode(flags[:], s[53:55]) {
+		return TraceParent{}, ErrBadTraceParent
+	}
+	tp.Flags = flags[0]
+	if !tp.IsValid() {
+		return TraceParent{}, ErrBadTraceParent
+	}
+	return tp, nil
+}
+
+// hexDecode декодирует строку из шестнадцатеричных цифр в нижнем
+// регистре (как требует W3C) в dst
+func hexDecode(dst []byte, s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= 'A' && c <= 'F' {
+			return false
+		}
+	}
+	n, err := hex.Decode(dst, []byte(s))
+	return err == nil && n == len(dst)
+}
+
+// IsValid проверяет, что идентификаторы трассировки и span'а не нулевые
+func (tp TraceParent) IsValid() bool {
+	return tp.TraceId != [16]byte{} && tp.SpanId != [8]byte{}
+}
+
+// Sampled возвращает значение флага "sampled"
+func (tp TraceParent) Sampled() bool { return tp.Flags&TraceFlagSampled != 0 }
+
+// TraceIdString возвращает идентификатор трассировки (32 hex)
+func (tp TraceParent) TraceIdString() string { return hex.EncodeToString(tp.TraceId[:]) }
+
+// SpanIdString возвращает идентификатор span'а (16 hex)
+func (tp TraceParent) SpanIdString() string { return hex.EncodeToString(tp.SpanId[:]) }
+
+// FlagsString возвращает флаги трассировки (2 hex)
+func (tp TraceParent) FlagsString() string { return hex.EncodeToString([]byte{tp.Flags}) }
+
+// String возвращает значение заголовка traceparent (версия "00")
+func (tp TraceParent) String() string {
+	return "00-" + tp.TraceIdString() + "-" + tp.SpanIdString() + "-" + tp.FlagsString()
+}
+
+// NewSpan возвращает дочерний span той же трассировки (новый SpanId)
+func (tp TraceParent) NewSpan() TraceParent {
+	child := tp
+	for child.SpanId == tp.SpanId || child.SpanId == [8]byte{} {
+		_, _ = rand.Read(child.SpanId[:])
+	}
+	return child
+}
+
+// Attrs возвращает атрибуты журнала "trace_id", "span_id", "trace_flags"
+func (tp TraceParent) Attrs() []slog.Attr {
+	return []slog.Attr{
+		slog.String(TraceIdKey, tp.TraceIdString()),
+		slog.String(SpanIdKey, tp.SpanIdString()),
+		slog.String(TraceFlagsKey, tp.FlagsString()),
+	}
+}
+
+// Ключ для хранения TraceParent в контексте
+type traceParentKey struct{}
+
+// ContextWithTraceParent возвращает контекст с заданным traceparent
+func ContextWithTraceParent(ctx context.Context, tp TraceParent) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, tp)
+}
+
+// TraceParentFromContext извлекает traceparent из контекста
+func TraceParentFromContext(ctx context.Context) (TraceParent, bool) {
+	tp, ok := ctx.Value(traceParentKey{}).(TraceParent)
+	return tp, ok && tp.IsValid()
+}
+
+// TraceFromContext - функция извлечения traceparent из контекста,
+// используемая IdHandler'ом. Может быть заменена приложением (до создания
+// логгеров) для интеграции с OpenTelemetry, например:
+//
+//	xlog.TraceFromContext = func(ctx context.Context) (xlog.TraceParent, bool) {
+//		sc := trace.SpanContextFromContext(ctx)
+//		return xlog.TraceParent{
+//			TraceId: sc.TraceID(), SpanId: sc.SpanID(), Flags: byte(sc.TraceFlags()),
+//		}, sc.IsValid()
+//	}
+var TraceFromContext = TraceParentFromContext
+
+// TraceParentFromHeader извлекает traceparent из HTTP заголовков
+func TraceParentFromHeader(h http.Header) (TraceParent, error) {
+	v := h.Get(TraceParentHeader)
+	if v == "" {
+		return TraceParent{}, ErrBadTraceParent
+	}
+	return ParseTraceParent(v)
+}
+
+// InjectTraceParent записывает traceparent в HTTP заголовки
+// (например, исходящего запроса)
+func InjectTraceParent(h http.Header, tp TraceParent) {
+	h.Set(TraceParentHeader, tp.String())
+}
+
+// ContextFromHeader возвращает контекст с traceparent из HTTP заголовков
+// входящего запроса. Если заголовок отсутствует или некорректен,
+// то начинается новая трассировка (sampled).
+func ContextFromHeader(ctx context.Context, h http.Header) context.Context {
+	tp, err := TraceParentFromHeader(h)
+	if err != nil {
+		tp = NewTraceParent(true)
+	}
+	return ContextWithTraceParent(ctx, tp)
+}
+
+// EOF: "traceparent.go"
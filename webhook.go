@@ -0,0 +1,285 @@
+// File: "webhook.go"
+
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog" // go>=1.21
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
+)
+
+// Уведомления через webhook.
+// Webhook отправляет записи POST запросами с JSON телом вида
+//
+//	{"records":[{"time":"...","level":"ALERT","msg":"...","attrs":{...}}]}
+//
+// Записи накапливаются в очереди и отправляются пакетами (не более
+// BatchSize записей) не чаще одного запроса в Interval (первая запись
+// после паузы отправляется сразу). При сетевой ошибке или ответе 429/5xx
+// запрос повторяется Retries раз с экспоненциальной задержкой.
+// Отправка выполняется в отдельной горутине, переполнение очереди
+// приводит к отбрасыванию самых старых записей (см. Stats).
+// Webhook подключается как хук: NewHooks(LevelAlert, 0, wh.Hook()).
+
+// Параметры webhook по умолчанию
+const (
+	DefaultWebhookInterval   = time.Second            // интервал между запросами
+	DefaultWebhookBatchSize  = 20                     // записей в запросе
+	DefaultWebhookRetries    = 3                      // число повторов
+	DefaultWebhookRetryDelay = 500 * time.Millisecond // начальная задержка повтора
+	DefaultWebhookQueue      = 1000                   // размер очереди
+	DefaultWebhookTimeout    = 5 * time.Second        // таймаут запроса
+)
+
+// Параметры webhook
+type WebhookOptions struct {
+	URL        string        // адрес webhook
+	Header     http.Header   // дополнительные заголовки запроса
+	Client     *http.Client  // HTTP клиент (nil - с таймаутом DefaultWebhookTimeout)
+	Interval   time.Duration // минимальный интервал между запросами
+	BatchSize  int           // максимальное число записей в запросе
+	Retries    int           // число повторов запроса (отрицательное - без повторов)
+	RetryDelay time.Duration // начальная задержка повтора (удваивается)
+	Queue      int           // размер очереди записей
+}
+
+// WebhookRecord - запись в теле запроса webhook
+type WebhookRecord struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"msg"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// WebhookPayload - тело запроса webhook
+type WebhookPayload struct {
+	Records []WebhookRecord `json:"records"`
+}
+
+// Webhook - отправитель уведомлений (см. NewWebhook)
+type Webhook struct {
+	opts    WebhookOptions
+	ch      chan WebhookRecord // очередь записей
+	done    chan struct{}      // признак завершения горутины
+	once    sync.Once          // однократное закрытие очереди
+	mx      sync.RWMutex       // защита ch от записи после Close
+	closed  bool               // признак закрытия
+	sent    atomic.Uint64      // отправлено записей
+	failed  atomic.Uint64      // не отправлено записей (ошибки)
+	dropped atomic.Uint64      // отброшено записей (переполнение)
+}
+
+// NewWebhook создаёт отправитель уведомлений и запускает его горутину
+func NewWebhook(opts WebhookOptions) (*Webhook, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("webhook: no URL")
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWebhookInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultWebhookBatchSize
+	}
+	if opts.Retries == 0 {
+		opts.Retries = DefaultWebhookRetries
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultWebhookRetryDelay
+	}
+	if opts.Queue <= 0 {
+		opts.Queue = DefaultWebhookQueue
+	}
+	w := &Webhook{
+		opts: opts,
+		ch:   make(chan WebhookRecord, opts.Queue),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// webhookValue преобразует значение атрибута для JSON. Значения, которые
+// нельзя сериализовать в JSON (NaN, ±Inf, каналы, функции, ...),
+// заменяются строками, чтобы не потерять весь пакет записей.
+func webhookValue(v slog.Value) any {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		m := make(map[string]any, len(v.Group()))
+		for _, a := range v.Group() {
+			m[a.Key] = webhookValue(a.Value)
+		}
+		return m
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindFloat64:
+		if f := v.Float64(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
+		}
+		if _, err := json.Marshal(v.Any()); err != nil {
+			return safeSprint(v.Any())
+		}
+	}
+	return v.Any()
+}
+
+// NewWebhookRecord преобразует запись журнала в запись webhook
+func NewWebhookRecord(r slog.Record) WebhookRecord {
+	wr := WebhookRecord{Time: r.Time, Level: LevelToLabel(r.Level), Message: r.Message}
+	if r.NumAttrs() != 0 {
+		wr.Attrs = make(map[string]any, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			wr.Attrs[a.Key] = webhookValue(a.Value)
+			return true
+		})
+	}
+	return wr
+}
+
+// Notify ставит запись в очередь отправки (без блокировки)
+func (w *Webhook) Notify(r slog.Record) {
+	w.mx.RLock()
+	defer w.mx.RUnlock()
+	if w.closed {
+		w.dropped.Add(1)
+		return
+	}
+	select {
+	case w.ch <- NewWebhookRecord(r):
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// Hook возвращает хук отправки уведомлений (см. NewHooks)
+func (w *Webhook) Hook() HookFunc { return w.Notify }
+
+// Stats возвращает число отправленных, не отправленных (ошибки)
+// и отброшенных (переполнение очереди) записей
+func (w *Webhook) Stats() (sent, failed, dropped uint64) {
+	return w.sent.Load(), w.failed.Load(), w.dropped.Load()
+}
+
+// run накапливает записи и отправляет их пакетами
+func (w *Webhook) run() {
+	defer close(w.done)
+	var pending []WebhookRecord
+	var last time.Time // время последнего запроса
+	timer := time.NewTimer(0)
+	timer.Stop()
+	armed := false // признак запущенного таймера
+
+	for {
+		select {
+		case rec, ok := <-w.ch:
+			if !ok { // Close: отправить оставшиеся записи
+				for len(pending) != 0 {
+					pending = w.sendBatch(pending)
+				}
+				return
+			}
+			if len(pending) >= w.opts.Queue { // отбросить самую старую запись
+				pending = pending[1:]
+				w.dropped.Add(1)
+			}
+			pending = append(pending, rec)
+			if !armed {
+				timer.Reset(max(0, w.opts.Interval-time.Since(last)))
+				armed = true
+			}
+
+		case <-timer.C:
+			armed = false
+			last = time.Now()
+			pending = w.sendBatch(pending)
+			if len(pending) != 0 {
+				timer.Reset(w.opts.Interval)
+				armed = true
+			}
+		}
+	}
+}
+
+// sendBatch отправляет пакет записей и возвращает оставшиеся записи
+func (w *Webhook) sendBatch(pending []WebhookRecord) []WebhookRecord {
+	n := min(len(pending), w.opts.BatchSize)
+	if err := w.post(pending[:n]); err != nil {
+		w.failed.Add(uint64(n))
+	} else {
+		w.sent.Add(uint64(n))
+	}
+	clear(pending[:n])
+	return pending[n:]
+}
+
+// post отправляет запрос с повторами
+func (w *Webhook) post(records []WebhookRecord) error {
+	body, err := json.Marshal(WebhookPayload{Records: records})
+	if err != nil {
+		return err
+	}
+	delay := w.opts.RetryDelay
+	for i := 0; ; i++ {
+		var retry bool
+		retry, err = w.postOnce(body)
+		if err == nil || !retry || i >= w.opts.Retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// postOnce выполняет один запрос. Признак retry сообщает, что запрос
+// имеет смысл повторить.
+func (w *Webhook) postOnce(body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(context.Background(),
+		http.MethodPost, w.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, vs := range w.opts.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook: %s", resp.Status)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// Close отправляет оставшиеся записи и останавливает горутину
+// (записи после Close отбрасываются)
+func (w *Webhook) Close() {
+	w.once.Do(func() {
+		w.mx.Lock()
+		w.closed = true
+		close(w.ch)
+		w.mx.Unlock()
+	})
+	<-w.done
+}
+
+// EOF: "webhook.go"
@@ -214,7 +214,7 @@ func NewWriter(
 	} else if pipe == nil && logger != nil && writer == nil {
 		return rotatableWriter{logger}
 	} else if pipe == nil && file == nil && logger == nil && writer != nil {
-		return customWriter{logger}
+		return customWriter{writer}
 	} else if pipe != nil && file != nil && writer == nil {
 		return pipeAndFileWriter{Pipe: pipe, File: file}
 	} else if pipe != nil && logger != nil && writer == nil {
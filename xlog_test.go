@@ -3,11 +3,26 @@
 package xlog
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
+	"io"
 	"log"
 	"log/slog" // go>=1.21
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 	// FIXME: "golang.org/x/exp/slog" // экспериментальный пакет для go=1.20 только
@@ -531,4 +546,1599 @@ func TestMultiHandler(t *testing.T) {
 	log.Flood("Hello, Multi Handler!", "cnt", 3) // будет пропущено
 }
 
+// Сформировать JSON журнал в буфер и разобрать его по записям
+func jsonRecords(t *testing.T, conf Conf, fn func(log *Logger)) []map[string]any {
+	var buf bytes.Buffer
+	conf.Pipe = "null"
+	conf.Format = "json"
+	fn(NewWithWriter(conf, &buf))
+
+	recs := make([]map[string]any, 0)
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		rec := map[string]any{}
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("can't decode JSON: %v", err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// Проверка генераторов идентификаторов записей (logId)
+func TestIdGenerators(t *testing.T) {
+	formats := []string{
+		IdFormatUUID, IdFormatULID, IdFormatKSUID,
+		IdFormatSnowflake, IdFormatCounter,
+	}
+	for _, format := range formats {
+		gen := NewIdGenerator(format, 42)
+		id := gen.NewId()
+		str := gen.Format(id)
+		kind, id2, err := ParseLogId(str)
+		if err != nil || !bytes.Equal(id, id2) {
+			t.Fatalf("format=%s: bad parse logId=%s err=%v", format, str, err)
+		}
+		fmt.Printf("%-9s %-9s %s\n", format, kind.Kind(), str)
+
+		for _, full := range []bool{false, true} {
+			conf := Conf{
+				Level: "trace", IdOn: true, IdFormat: format, IdNode: 42,
+				SumOn: true, SumFull: full, SumChain: true,
+			}
+			recs := jsonRecords(t, conf, func(log *Logger) {
+				log.Info("hello", "format", format)
+				log.With("app", "test").Debug("with", "pi", 3.14)
+				log.WithGroup("grp").Notice("group", "x", 1)
+			})
+
+			sum := uint16(0)
+			for _, rec := range recs {
+				res, err := ChecksumVerify(full, rec)
+				if err != nil {
+					t.Fatalf("format=%s full=%v: %v", format, full, err)
+				}
+				if res.Sum^sum != res.LogSum {
+					t.Errorf("format=%s full=%v: bad logSum=%04x sum=%04x",
+						format, full, res.LogSum, res.Sum^sum)
+				}
+				sum = res.LogSum
+			}
+		}
+	}
+}
+
+// Проверка строгой монотонности UUIDv7 идентификаторов
+func TestUUIDMonotonic(t *testing.T) {
+	gen := UUIDGen{}
+	now := time.Now()
+	prev := gen.NewId()
+	for i := 0; i < 10000; i++ { // заведомо больше 4096 в одной миллисекунде
+		id := gen.NewId()
+		if bytes.Compare(prev[:14], id[:14]) >= 0 {
+			t.Fatalf("non-monotonic UUIDv7: %s >= %s", gen.Format(prev), gen.Format(id))
+		}
+		prev = id
+	}
+	if drift := gen.Time(prev).Sub(now); drift < -time.Millisecond || drift > time.Second {
+		t.Errorf("bad UUIDv7 time drift=%v", drift)
+	}
+
+	conf := Conf{Level: "info", IdOn: true, SumOn: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		for i := 0; i < 100; i++ {
+			log.Info("monotonic", "i", i)
+		}
+	})
+	var res0 ChecksumRes
+	for i, rec := range recs {
+		res, err := ChecksumVerify(false, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i != 0 && !res0.IdLess(res) {
+			t.Errorf("non-monotonic logId: %s >= %s", res0.Id, res.Id)
+		}
+		// Генератор может опережать часы (после 4096 идентификаторов
+		// в одной миллисекунде), а вызов NewId - задерживаться планировщиком
+		if drift := res.IdDrift(); drift < -50*time.Millisecond || drift > 50*time.Millisecond {
+			t.Errorf("bad logId time drift=%v", drift)
+		}
+		res0 = res
+	}
+}
+
+func TestChains(t *testing.T) {
+	for _, full := range []bool{false, true} {
+		conf := Conf{Level: "info", IdOn: true, SumOn: true, SumFull: full, SumChain: true}
+		recs := jsonRecords(t, conf, func(log *Logger) {
+			db, http := log.WithChain("db"), log.WithChain("http")
+			for i := 0; i < 5; i++ { // цепочки перемежаются в одном журнале
+				log.Info("main", "i", i)
+				db.Info("query", "i", i)
+				http.With("path", "/").Info("request", "i", i)
+			}
+		})
+		sums := map[string]uint16{}
+		cnt := map[string]int{}
+		for _, rec := range recs {
+			res, err := ChecksumVerify(full, rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Sum^sums[res.Chain] != res.LogSum {
+				t.Errorf("bad checksum of chain %q (full=%v)", res.Chain, full)
+			}
+			sums[res.Chain] = res.LogSum
+			cnt[res.Chain]++
+		}
+		if cnt[""] != 5 || cnt["db"] != 5 || cnt["http"] != 5 {
+			t.Errorf("bad chains: %v", cnt)
+		}
+	}
+}
+
+func TestIdHandlerConcurrent(t *testing.T) {
+	conf := Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		a := log.WithGroup("a").With("x", 1)
+		b, c := a.WithGroup("b"), a.WithGroup("c") // общий родитель
+		var wg sync.WaitGroup
+		for _, l := range []*Logger{b, c} {
+			wg.Add(1)
+			go func(l *Logger) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					l.Info("concurrent", "i", i)
+				}
+			}(l)
+		}
+		wg.Wait()
+	})
+	if len(recs) != 200 {
+		t.Fatalf("bad records number: %d", len(recs))
+	}
+	cnt := map[string]int{}
+	for _, rec := range recs {
+		if _, err := ChecksumVerify(true, rec); err != nil {
+			t.Fatal(err)
+		}
+		a, _ := rec["a"].(map[string]any)
+		for _, g := range []string{"b", "c"} {
+			if _, ok := a[g]; ok {
+				cnt[g]++
+			}
+		}
+	}
+	if cnt["b"] != 100 || cnt["c"] != 100 {
+		t.Errorf("bad groups: %v", cnt)
+	}
+}
+
+func TestSumChainConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	conf := Conf{Level: "info", Pipe: "null", Format: "json",
+		IdOn: true, SumOn: true, SumFull: true, SumChain: true}
+	yield := NewMiddleware(func(ctx context.Context, r slog.Record, next HandleFunc) error {
+		runtime.Gosched() // дать другим горутинам обогнать запись
+		return next(ctx, r)
+	})
+	log := NewWithWriter(conf, &buf, yield)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(l *Logger) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				l.Info("concurrent", "i", i)
+			}
+		}(log.WithChain([]string{"", "db"}[g%2]))
+	}
+	wg.Wait()
+
+	// Порядок вывода совпадает с порядком КС и logId в каждой цепочке
+	prevs := map[string]ChecksumRes{}
+	cnt := 0
+	for dec := json.NewDecoder(&buf); dec.More(); cnt++ {
+		rec := map[string]any{}
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("can't decode JSON: %v", err)
+		}
+		res, err := ChecksumVerify(true, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev, ok := prevs[res.Chain]
+		if res.Sum^prev.LogSum != res.LogSum {
+			t.Fatalf("bad checksum of chain %q: %v", res.Chain, rec)
+		}
+		if ok && !prev.IdLess(res) {
+			t.Fatalf("non-monotonic logId: %s >= %s", prev.Id, res.Id)
+		}
+		prevs[res.Chain] = res
+	}
+	if cnt != 800 {
+		t.Fatalf("bad records number: %d", cnt)
+	}
+}
+
+func TestGoId(t *testing.T) {
+	parent := GoId()
+	if parent == 0 || parent != goIdSlow() {
+		t.Fatalf("bad goroutine id: %d != %d", parent, goIdSlow())
+	}
+	done := make(chan [3]uint64)
+	go func() { done <- [3]uint64{GoId(), goIdSlow(), GoParentId()} }()
+	ids := <-done
+	if ids[0] != ids[1] || ids[0] == parent {
+		t.Errorf("bad goroutine id: %d != %d", ids[0], ids[1])
+	}
+	if ids[2] != 0 && ids[2] != parent { // 0 - не поддерживается
+		t.Errorf("bad parent goroutine id: %d != %d", ids[2], parent)
+	}
+
+	conf := Conf{Level: "info", GoId: true, GoParent: true, GoLabels: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		labels := pprof.Labels("worker", "db")
+		pprof.Do(context.Background(), labels, func(ctx context.Context) {
+			log.InfoContext(ctx, "labeled")
+		})
+	})
+	if len(recs) != 1 || recs[0][GoKey] != float64(parent) {
+		t.Fatalf("bad goroutine: %v", recs)
+	}
+	if labels, _ := recs[0][GoLabelsKey].(map[string]any); labels["worker"] != "db" {
+		t.Errorf("bad pprof labels: %v", recs[0])
+	}
+}
+
+func TestGoIdAllocs(t *testing.T) {
+	if n := testing.AllocsPerRun(100, func() { GoId() }); n != 0 {
+		t.Errorf("GoId allocates: %v", n)
+	}
+
+	// Числа > 255 при преобразовании в any размещаются в куче,
+	// поэтому проверка выполняется в горутине с большим идентификатором
+	ids := make(chan uint64)
+	for id := uint64(0); id < 1000; id = <-ids {
+		go func() { ids <- GoId() }()
+	}
+	// AllocsPerRun учитывает выделения памяти всего процесса (таймеры и
+	// горутины других тестов), поэтому берётся медиана нескольких замеров
+	// по большому числу записей
+	median := func(log *Logger) float64 {
+		var n [5]float64
+		for i := range n {
+			n[i] = testing.AllocsPerRun(1000, func() { log.Info("allocs", "i", 1000) })
+		}
+		sort.Float64s(n[:])
+		return n[len(n)/2]
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, format := range []string{"json", "text", "tint"} {
+			allocs := [2]float64{}
+			for i, goId := range []bool{false, true} {
+				log := NewWithWriter(Conf{Level: "info", Pipe: "null", Format: format,
+					GoId: goId, GoParent: goId}, io.Discard)
+				allocs[i] = median(log)
+			}
+			if allocs[1] > allocs[0] {
+				t.Errorf("format=%s: goroutine id allocates: %v", format, allocs)
+			}
+		}
+	}()
+	<-done
+}
+
+func TestTraceParent(t *testing.T) {
+	const hdr = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tp, err := ParseTraceParent(hdr)
+	if err != nil || tp.String() != hdr || !tp.Sampled() {
+		t.Fatalf("can't parse traceparent: %v (%s)", err, tp)
+	}
+	for _, bad := range []string{
+		"", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xx",
+	} {
+		if _, err := ParseTraceParent(bad); err == nil {
+			t.Errorf("bad traceparent accepted: %q", bad)
+		}
+	}
+
+	h := http.Header{}
+	InjectTraceParent(h, tp.NewSpan())
+	ctx := ContextFromHeader(context.Background(), h)
+	span, _ := TraceParentFromContext(ctx)
+	if span.TraceId != tp.TraceId || span.SpanId == tp.SpanId {
+		t.Fatalf("bad child span: %s", span)
+	}
+
+	for _, full := range []bool{false, true} {
+		conf := Conf{Level: "trace", TraceCtx: true, IdOn: true, SumOn: true, SumFull: full}
+		recs := jsonRecords(t, conf, func(log *Logger) {
+			log.TraceContext(ctx, "with trace")
+			log.WithGroup("grp").InfofContext(ctx, "with %s", "group")
+			log.Info("without trace")
+		})
+		for i, rec := range recs {
+			res, err := ChecksumVerify(full, rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Sum != res.LogSum {
+				t.Errorf("bad checksum (full=%v): %v", full, rec)
+			}
+			if i < 2 && (res.TraceId != span.TraceIdString() || res.SpanId != span.SpanIdString()) {
+				t.Errorf("bad trace attributes: %v", rec)
+			}
+			if i == 2 && res.TraceId != "" {
+				t.Errorf("unexpected trace attributes: %v", rec)
+			}
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if FromContext(context.Background()) != Current() {
+		t.Fatal("FromContext() must fall back to Current()")
+	}
+
+	conf := Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		ctx := NewContext(context.Background(), log.WithGroup("req"))
+		ctx = ContextWith(ctx, "user", "alice")
+		ctx = ContextWith(ctx, slog.Int("attempt", 2))
+		FromContext(ctx).InfoContext(ctx, "in group", "path", "/")
+		log.InfoContext(ctx, "no group")
+	})
+	if len(recs) != 2 {
+		t.Fatalf("bad records number: %d", len(recs))
+	}
+	for _, rec := range recs {
+		res, err := ChecksumVerify(true, rec)
+		if err != nil || res.Sum != res.LogSum {
+			t.Errorf("bad checksum: %v (%v)", rec, err)
+		}
+	}
+	req, _ := recs[0]["req"].(map[string]any)
+	if req["user"] != "alice" || req["attempt"] != float64(2) || req["path"] != "/" {
+		t.Errorf("bad context attributes in group: %v", recs[0])
+	}
+	if recs[1]["user"] != "alice" || recs[1]["attempt"] != float64(2) {
+		t.Errorf("bad context attributes: %v", recs[1])
+	}
+}
+
+func TestLevelSpec(t *testing.T) {
+	base, hasBase, rules, err := ParseLevelSpec("info, github.com/acme/db=trace ,http=warn")
+	if err != nil || !hasBase || base != LevelInfo || len(rules) != 2 {
+		t.Fatalf("bad level spec: %v %v %v %v", base, hasBase, rules, err)
+	}
+	if _, _, _, err = ParseLevelSpec("info,=trace"); err == nil {
+		t.Error("bad level spec accepted")
+	}
+
+	msgs := func(recs []map[string]any) []string {
+		ms := []string{}
+		for _, rec := range recs {
+			ms = append(ms, rec[MsgKey].(string))
+		}
+		return ms
+	}
+
+	// Переопределение по пакету вызывающей функции (github.com/azorg/xlog)
+	conf := Conf{Level: "warn,github.com/azorg/xlog=debug,github.com/azorg=error"}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		log.Trace("trace")
+		log.Debug("debug")
+		if log.GetLvl() != "warn" {
+			t.Errorf("bad base level: %s", log.GetLvl())
+		}
+		log.SetLvl("trace,github.com/azorg/xlog/cmd=debug") // во время работы
+		log.Trace("trace2")
+		if spec := log.GetLevelSpec(); spec != "trace,github.com/azorg/xlog/cmd=debug" {
+			t.Errorf("bad level spec: %s", spec)
+		}
+	})
+	if ms := msgs(recs); fmt.Sprint(ms) != "[debug trace2]" {
+		t.Errorf("bad records for package override: %v", ms)
+	}
+
+	// Переопределение по имени логгера (атрибут "logger")
+	conf = Conf{Level: "info,db=debug,db.pool=warn"}
+	recs = jsonRecords(t, conf, func(log *Logger) {
+		db := log.With(LoggerKey, "db")
+		pool := log.With(LoggerKey, "db.pool")
+		log.Debug("root")
+		db.Debug("db")
+		db.WithMiddleware(NewMiddlewareWithFields(nil)).Debug("db mw")
+		log.With(LoggerKey, "db.conn").Debug("db.conn")
+		pool.Info("pool")
+		pool.Warn("pool warn")
+	})
+	if ms := msgs(recs); fmt.Sprint(ms) != "[db db mw db.conn pool warn]" {
+		t.Errorf("bad records for logger name override: %v", ms)
+	}
+}
+
+func TestNamed(t *testing.T) {
+	for _, node := range Loggers() { // реестр глобальный (go test -count)
+		if strings.HasPrefix(node.Name(), "tnamed") {
+			node.ResetLevel()
+		}
+	}
+
+	conf := Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		db := log.Named("tnamed").Named("db")
+		pool := db.Named("pool")
+		pool.Debug("skip") // уровень не задан - используется базовый
+		LoggerByName("tnamed").SetLvl("debug")
+		pool.Debug("inherited")
+		log.Debug("skip root")
+		LoggerByName("tnamed.db.pool").SetLvl("error")
+		pool.Info("skip pool")
+		db.WithGroup("grp").Debug("db", "k", 1)
+		LoggerByName("tnamed.db.pool").ResetLevel()
+		pool.Debug("reset")
+	})
+	ms := []string{}
+	for _, rec := range recs {
+		res, err := ChecksumVerify(true, rec)
+		if err != nil || res.Sum != res.LogSum {
+			t.Errorf("bad checksum: %v (%v)", rec, err)
+		}
+		ms = append(ms, fmt.Sprint(rec[LoggerKey], ":", rec[MsgKey]))
+	}
+	if fmt.Sprint(ms) != "[tnamed.db.pool:inherited tnamed.db:db tnamed.db.pool:reset]" {
+		t.Errorf("bad named records: %v", ms)
+	}
+
+	names := []string{}
+	for _, node := range Loggers() {
+		if strings.HasPrefix(node.Name(), "tnamed") && node.Name() != "tnamed.tint" {
+			names = append(names, node.Name()+"="+node.GetLvl())
+		}
+	}
+	if fmt.Sprint(names) != "[tnamed=debug tnamed.db=debug tnamed.db.pool=debug]" {
+		t.Errorf("bad loggers registry: %v", names)
+	}
+
+	var buf bytes.Buffer
+	log := NewWithWriter(Conf{Level: "info", Pipe: "null", Format: "tint", ColorOff: true}, &buf)
+	log.Named("tnamed").Named("tint").Info("hello", "k", 1)
+	if out := buf.String(); !strings.Contains(out, "[tnamed.tint] hello k=1") ||
+		strings.Contains(out, LoggerKey) {
+		t.Errorf("bad tinted named record: %q", out)
+	}
+}
+
+func TestSetLevelFor(t *testing.T) {
+	conf := Conf{Level: "info"}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		log.SetLevelFor(LevelDebug, 30*time.Millisecond)
+		log.Debug("debug")
+		log.SetLvlFor("trace", 200*time.Millisecond) // последнее побеждает
+		if lvl, _, ok := log.Escalation(); !ok || lvl != LevelTrace {
+			t.Errorf("bad escalation: %v %v", lvl, ok)
+		}
+		time.Sleep(80 * time.Millisecond) // первый таймер не восстанавливает уровень
+		log.Trace("trace")
+		time.Sleep(200 * time.Millisecond)
+		log.Debug("skip")
+		if log.GetLvl() != "info" {
+			t.Errorf("level not restored: %s", log.GetLvl())
+		}
+
+		// Управление через HTTP
+		srv := httptest.NewServer(LevelHandler(log))
+		defer srv.Close()
+		resp, err := http.PostForm(srv.URL, url.Values{"level": {"debug"}, "for": {"1h"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := map[string]any{}
+		_ = json.NewDecoder(resp.Body).Decode(&state)
+		resp.Body.Close()
+		if state["escalation"] != "debug" || state["level"] != "debug" {
+			t.Errorf("bad admin state: %v", state)
+		}
+		req, _ := http.NewRequest(http.MethodDelete, srv.URL, nil)
+		if resp, err = http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+		if log.GetLvl() != "info" {
+			t.Errorf("level not restored by admin: %s", log.GetLvl())
+		}
+
+		// Неизвестные уровни и имена логгеров отклоняются
+		log.Named("admin")
+		for _, c := range []struct {
+			form url.Values
+			code int
+		}{
+			{url.Values{"level": {"verbose"}}, http.StatusBadRequest},
+			{url.Values{"level": {"info,db=verbose"}}, http.StatusBadRequest},
+			{url.Values{"level": {"dbug"}, "for": {"1m"}}, http.StatusBadRequest},
+			{url.Values{"name": {"admin"}, "level": {"verbose"}}, http.StatusBadRequest},
+			{url.Values{"name": {"admin.nosuch"}, "level": {"trace"}}, http.StatusNotFound},
+			{url.Values{"name": {"admin"}, "level": {"trace"}}, http.StatusOK},
+		} {
+			resp, err := http.PostForm(srv.URL, c.form)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != c.code {
+				t.Errorf("bad admin status for %v: %d", c.form, resp.StatusCode)
+			}
+		}
+		if LoggerByName("admin.nosuch") != nil || LoggerByName("admin").GetLvl() != "trace" ||
+			log.GetLvl() != "info" {
+			t.Error("bad admin levels")
+		}
+		LoggerByName("admin").ResetLevel()
+	})
+	ms := []string{}
+	for _, rec := range recs {
+		ms = append(ms, rec[MsgKey].(string))
+	}
+	if fmt.Sprint(ms) != "[log level temporarily changed debug log level temporarily changed "+
+		"trace log level restored log level temporarily changed log level restored]" {
+		t.Errorf("bad records: %q", ms)
+	}
+}
+
+func TestSetLevelForNotice(t *testing.T) {
+	// Переходы выводятся и при уровне выше NOTICE
+	conf := Conf{Level: "warn", IdOn: true, SumOn: true, SumChain: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		log.SetLvlFor("error", time.Hour)
+		log.Warn("skip")
+		log.RestoreLevel()
+		log.Notice("skip")
+	})
+	if len(recs) != 2 || recs[0][MsgKey] != "log level temporarily changed" ||
+		recs[1][MsgKey] != "log level restored" || recs[1]["logLevel"] != "warn" {
+		t.Fatalf("bad records: %v", recs)
+	}
+	var sum uint16
+	for _, rec := range recs {
+		res, err := ChecksumVerify(false, rec)
+		if err != nil || res.Level != LevelNotice || res.Sum^sum != res.LogSum {
+			t.Errorf("bad record: %v (%v)", rec, err)
+		}
+		sum = res.LogSum
+	}
+}
+
+func TestRegisterLevel(t *testing.T) {
+	t.Cleanup(resetLevels) // уровни регистрируются глобально
+	if err := RegisterLevel("audit", 6, "AUDIT", "cyan"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterLevel("Audit", 6, "audit", "bright-cyan"); err != nil {
+		t.Errorf("repeated registration failed: %v", err)
+	}
+	for _, bad := range [][3]string{
+		{"warn2", "4", "WARN2"}, {"audit", "7", "AUDIT"}, {"x", "7", "INFO"},
+		{"7", "7", "SEVEN"}, {"x", "7", "X+1"}, {"silent", "20", "QUIET"},
+	} {
+		value, _ := strconv.Atoi(bad[1])
+		if err := RegisterLevel(bad[0], slog.Level(value), bad[2], ""); !errors.Is(err, ErrBadLevel) {
+			t.Errorf("bad level %v registered: %v", bad, err)
+		}
+	}
+
+	if LevelFromString("AUDIT") != 6 || LevelToString(6) != "audit" ||
+		LevelToLabel(7) != "AUDIT+1" || LevelToLabel(5) != "WARN+1" ||
+		LevelFromLabel("AUDIT+1") != 7 || LevelFromLabel("WARN+3") != DefaultLevel ||
+		LevelToColorLabel(6) != ansiBrightCyan+"AUDIT"+ansiReset {
+		t.Errorf("bad custom level conversion")
+	}
+	if err := RegisterLevels("security=11:Security:white-on-red, audit=6"); err != nil ||
+		LevelToLabel(11) != "SECURITY" || LevelFromString("security") != 11 {
+		t.Errorf("bad custom levels spec: %v", err)
+	}
+	if err := RegisterLevels("bad=x"); !errors.Is(err, ErrBadLevel) {
+		t.Errorf("bad custom levels spec accepted: %v", err)
+	}
+
+	for _, full := range []bool{false, true} {
+		conf := Conf{Level: "audit", IdOn: true, SumOn: true, SumFull: full}
+		recs := jsonRecords(t, conf, func(log *Logger) {
+			log.Warn("skip")
+			log.Lvl("audit", "audit", "user", "root")
+			log.Lvlf("audit", "audit %d", 2)
+			log.Log(context.Background(), 7, "audit+1")
+		})
+		if len(recs) != 3 {
+			t.Fatalf("bad records: %v", recs)
+		}
+		for i, rec := range recs {
+			if want := []string{"AUDIT", "AUDIT", "AUDIT+1"}[i]; rec[slog.LevelKey] != want {
+				t.Errorf("bad level label: %v", rec)
+			}
+			res, err := ChecksumVerify(full, rec)
+			if err != nil || res.Sum != res.LogSum || res.Level != slog.Level(6+i/2) {
+				t.Errorf("bad checksum: %v (%v)", rec, err)
+			}
+		}
+	}
+
+	resetLevels()
+	if LevelFromString("audit") != DefaultLevel || LevelToLabel(11) != "CRIT+1" ||
+		LevelFromLabel("SECURITY") != DefaultLevel {
+		t.Errorf("custom levels not reset")
+	}
+}
+
+func TestForcedLevel(t *testing.T) {
+	ctx := WithForcedLevel(context.Background(), LevelTrace)
+	conf := Conf{Level: "info,github.com/azorg/xlog=warn", IdOn: true, SumOn: true, SumFull: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		log.Debug("skip")
+		log.DebugContext(ctx, "debug")
+		log.Logger.DebugContext(ctx, "slog debug")
+		log.WithGroup("grp").TracefContext(ctx, "trace %d", 1)
+		log.FloodContext(ctx, "skip flood")
+		log.ErrorContext(ctx, "error")
+	})
+	ms := []string{}
+	for _, rec := range recs {
+		res, err := ChecksumVerify(true, rec)
+		if err != nil || res.Sum != res.LogSum {
+			t.Errorf("bad checksum: %v (%v)", rec, err)
+		}
+		ms = append(ms, fmt.Sprint(rec[MsgKey], ":", rec[ForcedKey]))
+	}
+	if fmt.Sprint(ms) != "[debug:true slog debug:true trace 1:true error:<nil>]" {
+		t.Errorf("bad forced records: %v", ms)
+	}
+
+	var buf bytes.Buffer
+	log := NewWithWriter(Conf{Level: "info", Pipe: "null", Format: "tint", ColorOff: true}, &buf)
+	log.DebugContext(ctx, "tinted")
+	if out := buf.String(); !strings.Contains(out, "tinted forced=true") {
+		t.Errorf("bad tinted forced record: %q", out)
+	}
+
+	// Включение принудительного уровня подписанным HTTP заголовком
+	key := []byte("secret")
+	buf.Reset()
+	srv := httptest.NewServer(ForcedLevelMiddleware(key,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log.DebugContext(r.Context(), "request", "path", r.URL.Path)
+		})))
+	defer srv.Close()
+	for _, hdr := range []string{
+		SignForcedLevel(key, LevelDebug, time.Now().Add(time.Minute)),
+		SignForcedLevel([]byte("bad"), LevelDebug, time.Now().Add(time.Minute)),
+		SignForcedLevel(key, LevelDebug, time.Now().Add(-time.Minute)),
+		"debug:9999999999:00",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/"+hdr[:5], nil)
+		req.Header.Set(ForcedLevelHeader, hdr)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}
+	if out := buf.String(); strings.Count(out, "request") != 1 {
+		t.Errorf("bad forced HTTP records: %q", out)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	for _, bad := range []string{"level>=", "(a", "a ==", "msg~\"(\"", "a &&", "a @ b", "\"x",
+		"level>=dbug", `level<"verbose"`, "level==ERROR+x"} {
+		if _, err := CompileFilter(bad); err == nil {
+			t.Errorf("bad filter %q compiled", bad)
+		}
+	}
+	for _, good := range []string{"level>=Debug", "level>=ERROR+1", "level>=-8", "level==INFO", `level~"^ERR"`} {
+		if _, err := CompileFilter(good); err != nil {
+			t.Errorf("good filter %q not compiled: %v", good, err)
+		}
+	}
+
+	conf := Conf{
+		Level:     "trace",
+		Filter:    `level>=debug && (user=="42" || source.file~"xlog_test" && n>=10) || level>=ERROR`,
+		FilterOut: `msg~"^health" || grp.k==1`,
+		IdOn:      true, SumOn: true, SumChain: true,
+	}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		log.Trace("trace", "user", "42")
+		log.Debug("debug", "user", "42")
+		log.With("user", "42").Info("with")
+		log.Info("n", "n", 5)
+		log.Info("n", "n", 10)
+		log.Info("healthcheck", "user", "42")
+		log.WithGroup("grp").Info("grp", "user", "42", "k", 1)
+		log.Error("error")
+		log.InfoContext(ContextWith(context.Background(), "user", 42), "ctx")
+
+		if err := log.SetFilter(`logger=="db"`, ""); err != nil {
+			t.Error(err)
+		}
+		if err := log.SetFilter("(", ""); err == nil {
+			t.Error("bad runtime filter accepted")
+		}
+		if in, ex := log.GetFilter(); in != `logger=="db"` || ex != "" {
+			t.Errorf("bad runtime filter: %q %q", in, ex)
+		}
+		log.Error("skip")
+		log.Named("db").Info("db")
+	})
+	ms := []string{}
+	var sum uint16
+	for _, rec := range recs {
+		res, err := ChecksumVerify(false, rec)
+		if err != nil || res.LogSum != res.Sum^sum {
+			t.Errorf("bad checksum chain: %v (%v)", rec, err)
+		}
+		sum = res.LogSum
+		ms = append(ms, rec[MsgKey].(string))
+	}
+	if fmt.Sprint(ms) != "[debug with n error ctx db]" {
+		t.Errorf("bad filtered records: %v", ms)
+	}
+
+	mw, err := NewMiddlewareFilter("", `level<info`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs = jsonRecords(t, Conf{Level: "trace"}, func(log *Logger) {
+		log = log.WithMiddleware(mw)
+		log.Debug("skip")
+		log.Info("info")
+	})
+	if len(recs) != 1 || recs[0][MsgKey] != "info" {
+		t.Errorf("bad middleware filter records: %v", recs)
+	}
+}
+
+func TestDamper(t *testing.T) {
+	conf := Conf{Level: "info", IdOn: true, SumOn: true, SumChain: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		d := NewDamper(&DamperOptions{Window: 30 * time.Millisecond, Burst: 2, Keys: []string{"peer"}})
+		log = log.WithMiddleware(d.Middleware())
+		for i := 0; i < 10; i++ {
+			log.Error("connection lost", "peer", "a", "i", i)
+			if i < 3 {
+				log.Error("connection lost", "peer", "b", "i", i)
+			}
+		}
+		log.Info("other")
+		time.Sleep(150 * time.Millisecond) // итоговые записи по таймеру
+
+		// Новое окно
+		for i := 10; i < 13; i++ {
+			log.Error("connection lost", "peer", "a", "i", i)
+		}
+		d.Flush()
+	})
+	ms := []string{}
+	var sum uint16
+	for _, rec := range recs {
+		res, err := ChecksumVerify(false, rec)
+		if err != nil || res.LogSum != res.Sum^sum {
+			t.Errorf("bad checksum chain: %v (%v)", rec, err)
+		}
+		sum = res.LogSum
+		m := fmt.Sprint(rec["peer"], rec["i"])
+		if n, ok := rec[RepeatedKey]; ok {
+			m += fmt.Sprint("x", n)
+			if _, ok = rec[IntervalKey]; !ok {
+				t.Errorf("no interval in summary: %v", rec)
+			}
+		}
+		ms = append(ms, m)
+	}
+	if len(ms) > 6 && ms[5] > ms[6] { // порядок срабатывания таймеров
+		ms[5], ms[6] = ms[6], ms[5]
+	}
+	if fmt.Sprint(ms) != "[a0 b0 a1 b1 <nil> <nil> a0x8 b0x1 a10 a11 a10x1]" {
+		t.Errorf("bad damper records: %v", ms)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	conf := Conf{Level: "trace", IdOn: true, SumOn: true, SumChain: true}
+	sampler := NewSampler(&SamplerOptions{Tick: time.Hour, First: 2, Thereafter: 3, Report: -1})
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		log = log.WithMiddleware(sampler.Middleware())
+		for i := 1; i <= 10; i++ {
+			log.Debug("hot", "i", i)
+			if i <= 3 {
+				log.Error("error", "i", i) // не сэмплируется
+			}
+		}
+		sampler.Flush()
+	})
+	ms := []string{}
+	var sum uint16
+	for _, rec := range recs {
+		res, err := ChecksumVerify(false, rec)
+		if err != nil || res.LogSum != res.Sum^sum {
+			t.Errorf("bad checksum chain: %v (%v)", rec, err)
+		}
+		sum = res.LogSum
+		ms = append(ms, fmt.Sprintf("%v/%v/%v", rec[MsgKey], rec["i"], rec[SampledKey]))
+	}
+	if fmt.Sprint(ms) != "[hot/1/<nil> error/1/<nil> hot/2/<nil> error/2/<nil> error/3/<nil> "+
+		"hot/5/<nil> hot/8/<nil> "+SampledMessage+"/<nil>/6]" {
+		t.Errorf("bad sampled records: %v", ms)
+	}
+	if passed, sampled := sampler.Counters(); passed != 7 || sampled != 6 {
+		t.Errorf("bad sampler counters: %d %d", passed, sampled)
+	}
+}
+
+// Значение с отложенным вычислением для проверки маскирования
+type redactValuer struct{ token string }
+
+func (v redactValuer) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("id", "42"), slog.String("token", v.token))
+}
+
+func TestRedact(t *testing.T) {
+	for _, bad := range []RedactRule{{Key: "/(/"}, {Key: "["}, {Detect: "foo"}, {}} {
+		if _, err := NewRedactor(bad); err == nil {
+			t.Errorf("bad redact rule %+v compiled", bad)
+		}
+	}
+
+	rd, err := NewRedactor(append(DefaultRedactRules(),
+		RedactRule{Key: "ssn", Strategy: RedactDrop},
+		RedactRule{Key: "/^user\\.e?mail$/", Strategy: RedactHash},
+		RedactRule{Key: "note", Detect: DetectEmail, Strategy: RedactPartial})...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt := "eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiI0MiJ9.c2lnbg"
+	if s := rd.String("auth " + jwt + " ok"); s != "auth "+RedactMaskString+" ok" {
+		t.Errorf("bad redacted message: %q", s)
+	}
+
+	type user struct {
+		Name     string
+		Password string `json:"password"`
+		Email    string `json:"email"`
+		Cards    []string
+	}
+	conf := Conf{Level: "info", Redactor: rd, IdOn: true, SumOn: true, SumFull: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		log.With("api_key", "k1", "app", "x").Info("login Bearer abc.def-42",
+			"PassWord", "p",
+			"ssn", "123-45-6789",
+			"note", "mail bob@example.com",
+			"card", "4111 1111 1111 1111",
+			"num", "4111 1111 1111 1112",
+			"user", &user{Name: "bob", Password: "p", Email: "bob@example.com",
+				Cards: []string{"4111111111111111"}},
+			slog.Group("db", "Secret", "s", "dsn", "ok"),
+			"session", redactValuer{token: "t"},
+			"ok", 1)
+		log.Info("clean", "ok", 1)
+	})
+	if len(recs) != 2 {
+		t.Fatalf("bad records number: %d", len(recs))
+	}
+	for _, rec := range recs {
+		res, err := ChecksumVerify(true, rec)
+		if err != nil || res.Sum != res.LogSum {
+			t.Errorf("bad checksum: %v (%v)", rec, err)
+		}
+	}
+
+	rec := recs[0]
+	usr, _ := rec["user"].(map[string]any)
+	db, _ := rec["db"].(map[string]any)
+	session, _ := rec["session"].(map[string]any)
+	mask := RedactMaskString
+	email := RedactHash.apply("bob@example.com")
+	if rec[MsgKey] != "login Bearer "+mask || rec["api_key"] != mask || rec["app"] != "x" ||
+		rec["PassWord"] != mask || rec["ssn"] != nil ||
+		rec["note"] != "mail ***********.com" ||
+		rec["card"] != "***************1111" || rec["num"] != "4111 1111 1111 1112" ||
+		usr["Name"] != "bob" || usr["password"] != mask || usr["email"] != email ||
+		fmt.Sprint(usr["Cards"]) != "[************1111]" ||
+		db["Secret"] != mask || db["dsn"] != "ok" ||
+		session["id"] != "42" || session["token"] != mask {
+		t.Errorf("bad redacted record: %v", rec)
+	}
+
+	// Middleware (только атрибуты записи)
+	recs = jsonRecords(t, Conf{Level: "info"}, func(log *Logger) {
+		log = log.WithMiddleware(NewMiddlewareNoPasswd())
+		log.Info("mw", "passwd", "x", "token", "y")
+	})
+	if len(recs) != 1 || recs[0]["passwd"] != mask || recs[0]["token"] != "y" {
+		t.Errorf("bad middleware redacted records: %v", recs)
+	}
+}
+
+func TestPseudo(t *testing.T) {
+	for _, bad := range []string{"", "k1", "k1:zz", ":00", "k 1:00"} {
+		if _, _, err := ParsePseudoKey(bad); !errors.Is(err, ErrBadKey) {
+			t.Errorf("bad pseudo key %q parsed (%v)", bad, err)
+		}
+	}
+	keyId, key, err := ParsePseudoKey("k1:00112233445566778899aabbccddeeff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPseudonymizer(keyId, key, "email", "phone", "user.name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true, SumChain: true,
+		Pseudonymizer: p}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		for i := 0; i < 2; i++ {
+			log.Info("login", "email", "bob@example.com", "phone", 79001234567,
+				slog.Group("user", "name", "Bob", "id", 42), "name", "app")
+		}
+		log.With("phone", "79001234567", "app", "x").Info("with")
+		if err := p.SetKey("k2", []byte("new secret key")); err != nil {
+			t.Error(err)
+		}
+		log.Info("rotated", "email", "bob@example.com")
+	})
+	if len(recs) != 4 {
+		t.Fatalf("bad records number: %d", len(recs))
+	}
+	var sum uint16
+	for _, rec := range recs {
+		res, err := ChecksumVerify(true, rec)
+		if err != nil || res.LogSum != res.Sum^sum {
+			t.Errorf("bad checksum chain: %v (%v)", rec, err)
+		}
+		sum = res.LogSum
+	}
+
+	email := PseudoToken("k1", key, "bob@example.com")
+	user, _ := recs[0]["user"].(map[string]any)
+	if recs[0]["email"] != email || recs[1]["email"] != email ||
+		recs[0]["phone"] != PseudoToken("k1", key, "79001234567") ||
+		user["name"] != PseudoToken("k1", key, "Bob") || user["id"] != float64(42) ||
+		recs[0]["name"] != "app" {
+		t.Errorf("bad pseudonymized record: %v", recs[0])
+	}
+	if recs[2]["phone"] != PseudoToken("k1", key, "79001234567") || recs[2]["app"] != "x" {
+		t.Errorf("bad pseudonymized With attributes: %v", recs[2])
+	}
+	rotated, _ := recs[3]["email"].(string)
+	if id, ok := PseudoKeyId(rotated); !ok || id != "k2" || p.KeyId() != "k2" ||
+		rotated != PseudoToken("k2", []byte("new secret key"), "bob@example.com") {
+		t.Errorf("bad rotated token: %q", rotated)
+	}
+	if _, ok := PseudoKeyId("bob@example.com"); ok {
+		t.Error("plain value detected as token")
+	}
+}
+
+func TestFieldEnc(t *testing.T) {
+	for _, bad := range []string{"", "k1:aes:00", "k1:rsa:00", "k:1:aes:00", "k1:x25519-pub:zz"} {
+		if _, err := ParseFieldKey(bad); !errors.Is(err, ErrBadKey) {
+			t.Errorf("bad field key %q parsed (%v)", bad, err)
+		}
+	}
+
+	for _, keyType := range []string{FieldKeyAES, FieldKeyX25519} {
+		key, err := GenerateFieldKey("k1", keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k, err := ParseFieldKey(key.String()); err != nil || k.String() != key.String() {
+			t.Fatalf("bad field key spec %q (%v)", key, err)
+		}
+		encKey := key
+		if keyType == FieldKeyX25519 { // приложению достаточно открытого ключа
+			encKey, _ = ParseFieldKey("k1:x25519-pub:" + hex.EncodeToString(key.Public.Bytes()))
+		}
+		enc, err := NewFieldEncryptor(encKey, "passport", "user.inn")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conf := Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true,
+			FieldEncryptor: enc}
+		recs := jsonRecords(t, conf, func(log *Logger) {
+			log.Info("visa", "passport", "4510 123456", "name", "Bob",
+				slog.Group("user", "inn", 7701234567, "city", `"Москва"`))
+			log.With("passport", "4510 654321").Info("with", "name", "Ann")
+		})
+		if len(recs) != 2 {
+			t.Fatalf("bad records number: %d", len(recs))
+		}
+		for _, rec := range recs {
+			if res, err := ChecksumVerify(true, rec); err != nil || res.Sum != res.LogSum {
+				t.Errorf("bad checksum of encrypted record: %v (%v)", rec, err)
+			}
+		}
+		rec := recs[0]
+
+		passport, _ := rec["passport"].(string)
+		user, _ := rec["user"].(map[string]any)
+		inn, _ := user["inn"].(string)
+		if !strings.HasPrefix(passport, FieldEncPrefix+"k1:") || rec["name"] != "Bob" ||
+			user["city"] != `"Москва"` {
+			t.Errorf("bad encrypted record: %v", rec)
+		}
+
+		dec := NewFieldDecryptor(key)
+		if _, err := NewFieldDecryptor(encKey).Decrypt(passport); err == nil &&
+			keyType == FieldKeyX25519 {
+			t.Error("decrypted without private key")
+		}
+		if s, err := dec.Decrypt(passport); err != nil || s != "4510 123456" {
+			t.Errorf("bad decrypted passport: %q (%v)", s, err)
+		}
+		passport, _ = recs[1]["passport"].(string)
+		if s, err := dec.Decrypt(passport); err != nil || s != "4510 654321" {
+			t.Errorf("bad decrypted With passport: %q (%v)", s, err)
+		}
+		text, n := dec.DecryptText(`{"inn":"` + inn + `","x":"enc:k2:AAAA"}`)
+		if n != 1 || text != `{"inn":"7701234567","x":"enc:k2:AAAA"}` {
+			t.Errorf("bad decrypted text: %q (%d)", text, n)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var bufs [3]bytes.Buffer // собственный вывод, audit, alerts
+	logs := make([]*Logger, len(bufs))
+	for i := range bufs {
+		conf := Conf{Level: "debug", Format: "json", Pipe: "null", IdOn: true, SumOn: true}
+		logs[i] = NewWithWriter(conf, &bufs[i])
+	}
+	routes := map[string]*Logger{"audit": logs[1], "alerts": logs[2]}
+
+	if _, err := NewRouter(routes, []RouteRule{{To: []string{"nowhere"}}}); err == nil {
+		t.Error("unknown route accepted")
+	}
+	if _, err := NewRouter(routes, []RouteRule{{Match: "(", To: []string{"audit"}}}); err == nil {
+		t.Error("bad match expression accepted")
+	}
+	rt, err := NewRouter(routes, []RouteRule{
+		{MinLevel: LevelError, To: []string{"alerts", RouteNext}, Continue: true},
+		{Logger: "db", To: []string{"audit"}},
+		{Has: []string{"user"}, Match: `user=="42"`, To: []string{"audit", RouteNext}},
+		{Package: "github.com/azorg/xlog", MaxLevel: LevelDebug, To: []string{"audit"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := logs[0].WithRouter(rt).With("app", "x")
+	grp := log.WithGroup("g")
+	grp.Info("plain", "k", 1)
+	grp.Error("boom")
+	grp.Named("db").Info("query", "k", 2)
+	log.With("user", "42").Info("user")
+	log.Debug("debug")
+	log.Named("http").Error("http")
+
+	for i, want := range []string{
+		"[plain boom user http]", "[query user debug]", "[boom http]"} {
+		ms := []string{}
+		dec := json.NewDecoder(&bufs[i])
+		for dec.More() {
+			rec := map[string]any{}
+			if err := dec.Decode(&rec); err != nil {
+				t.Fatal(err)
+			}
+			if res, err := ChecksumVerify(false, rec); err != nil || res.Sum != res.LogSum {
+				t.Errorf("bad checksum: %v (%v)", rec, err)
+			}
+			if rec["app"] != "x" {
+				t.Errorf("lost With attributes: %v", rec)
+			}
+			if g, _ := rec["g"].(map[string]any); rec[MsgKey] == "query" &&
+				(g["k"] != float64(2) || rec[LoggerKey] != "db") {
+				t.Errorf("lost group or logger name: %v", rec)
+			}
+			ms = append(ms, rec[MsgKey].(string))
+		}
+		if fmt.Sprint(ms) != want {
+			t.Errorf("bad routed records #%d: %v (want %v)", i, ms, want)
+		}
+	}
+
+	r := slog.NewRecord(time.Now(), LevelCrit, "crit", 0)
+	if names := rt.Route(r); fmt.Sprint(names) != "[alerts ]" {
+		t.Errorf("bad route: %q", names)
+	}
+	r = slog.NewRecord(time.Now(), LevelInfo, "db", 0)
+	r.AddAttrs(slog.String(LoggerKey, "db.pool"))
+	if names := rt.Route(r); fmt.Sprint(names) != "[audit]" {
+		t.Errorf("bad logger route: %q", names)
+	}
+
+	// Имя логгера в Middleware и во вложенном WithRouter
+	var own bytes.Buffer
+	conf := Conf{Level: "debug", Format: "json", Pipe: "null"}
+	NewWithWriter(conf, &own, rt.Middleware()).Named("db").Info("mw")
+	if own.Len() != 0 || !strings.Contains(bufs[1].String(), `"msg":"mw"`) {
+		t.Errorf("bad middleware logger route: %q %q", own.String(), bufs[1].String())
+	}
+	nested := logs[0].Named("db").WithRouter(rt).WithRouter(rt)
+	if nh, ok := nested.Handler().(nameHandler); !ok || nh.Name() != "db" {
+		t.Error("lost logger name in nested router")
+	}
+}
+
+// Писатель с ошибкой записи (для проверки метрик)
+type failWriter struct{}
+
+func (failWriter) Write(b []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	conf := Conf{Level: "info", Format: "json", Pipe: "null", IdOn: true, Metrics: m}
+	log := NewWithWriter(conf, failWriter{})
+	for i := 0; i < 2; i++ {
+		log.Info("info", "i", i)
+	}
+	log.Debug("skip")
+	log.Error("error")
+	log.Named("db").Warn("warn")
+	log.Lvl("11", "crit+1")
+
+	s := m.Snapshot()
+	if fmt.Sprint(s.Levels) != "map[CRIT+1:1 ERROR:1 INFO:2 WARN:1]" ||
+		fmt.Sprint(s.Loggers) != "map[db:1]" || len(s.Sites) != 4 ||
+		s.Sinks["writer"] != (SinkCount{Writes: 5, Bytes: 0, Errors: 5}) {
+		t.Errorf("bad metrics snapshot: %+v", s)
+	}
+	notice := func() { log.Notice("a"); log.Notice("b") } // два PC в одной строке
+	notice()
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	series := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		name, _, _ := strings.Cut(line, "} ")
+		if series[name] {
+			t.Errorf("duplicate Prometheus series: %s", line)
+		}
+		series[name] = true
+	}
+	for _, line := range []string{
+		`func="github.com/azorg/xlog.TestMetrics.func1"} 2`,
+		"# TYPE xlog_records_total counter",
+		`xlog_records_total{level="INFO"} 2`,
+		`xlog_logger_records_total{logger="db"} 1`,
+		`xlog_sink_errors_total{sink="writer"} 7`,
+		`func="github.com/azorg/xlog.TestMetrics"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("no %q in Prometheus metrics:\n%s", line, body)
+		}
+	}
+
+	m.Publish("xlog_test_metrics")
+	if v := expvar.Get("xlog_test_metrics"); v == nil || !strings.Contains(v.String(), `"INFO":2`) {
+		t.Errorf("bad expvar metrics: %v", v)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var mx sync.Mutex
+	var posts int
+	var got []WebhookRecord
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+		posts++
+		if posts == 1 { // первый запрос - ошибка, проверка повтора
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var p WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("bad webhook payload: %v", err)
+		}
+		got = append(got, p.Records...)
+	}))
+	defer srv.Close()
+
+	wh, err := NewWebhook(WebhookOptions{
+		URL: srv.URL, Interval: 20 * time.Millisecond,
+		BatchSize: 2, RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewWebhook(): %v", err)
+	}
+	hooks := NewHooks(LevelAlert, 0, wh.Hook())
+	hooks.Add(func(r slog.Record) { panic("bad hook") })
+
+	log := NewWithWriter(Conf{Level: "info", Pipe: "null"}, io.Discard, hooks.Middleware())
+	log.Info("skip")
+	log.Alert("alert", "n", 1, "g", slog.GroupValue(slog.Any("err", errors.New("oops"))))
+	log.Alert("alert", "n", 2, "nan", math.Inf(1), "ch", make(chan int)) // не JSON
+	log.Emerg("emerg", "n", 3)
+	hooks.Close()
+	wh.Close()
+
+	mx.Lock()
+	defer mx.Unlock()
+	if len(got) != 3 || got[0].Message != "alert" || got[2].Level != "EMERG" ||
+		fmt.Sprint(got[0].Attrs["g"]) != "map[err:oops]" || got[1].Attrs["nan"] != "+Inf" {
+		t.Errorf("bad webhook records: %+v", got)
+	}
+	if posts < 3 || posts > 4 { // 500 + повтор + 1..2 пакета
+		t.Errorf("bad webhook posts: %d", posts)
+	}
+	if sent, failed, dropped := wh.Stats(); sent != 3 || failed != 0 || dropped != 0 {
+		t.Errorf("bad webhook stats: %d %d %d", sent, failed, dropped)
+	}
+	if dropped, panics := hooks.Dropped(); dropped != 0 || panics != 3 {
+		t.Errorf("bad hooks stats: %d %d", dropped, panics)
+	}
+}
+
+// richErrCode - ошибка с slog.LogValuer для TestRichErr
+type richErrCode int
+
+func (e richErrCode) Error() string        { return "code " + strconv.Itoa(int(e)) }
+func (e richErrCode) LogValue() slog.Value { return slog.GroupValue(slog.Int("code", int(e))) }
+
+func TestRichErr(t *testing.T) {
+	base := errors.New("base")
+	err := WrapErr(errors.Join(base, richErrCode(42)), "load")
+	if !errors.Is(err, base) || err.Error() != "load: base\ncode 42" {
+		t.Fatalf("bad wrapped error: %q", err)
+	}
+	if s := ErrStack(err); len(s) == 0 || !strings.HasSuffix(s[0].Function, ".TestRichErr") {
+		t.Errorf("bad error stack: %v", s)
+	}
+	if WrapErr(nil, "skip") != nil || len(ErrStack(WrapErr(err, "again"))) == 0 {
+		t.Error("bad WrapErr() result")
+	}
+
+	conf := Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		log.Error("rich", Err(err))
+		log.Error("plain", Err(base))
+	})
+	for _, rec := range recs {
+		res, e := ChecksumVerify(true, rec)
+		if e != nil || res.Sum != res.LogSum {
+			t.Errorf("bad checksum: %v (%v)", rec, e)
+		}
+	}
+	if len(recs) != 2 || recs[1][ErrKey] != "base" {
+		t.Fatalf("bad records: %v", recs)
+	}
+	rich, _ := recs[0][ErrKey].(map[string]any)
+	cause, _ := rich["cause"].(map[string]any)
+	join, _ := cause["join"].(map[string]any)
+	branch, _ := join["1"].(map[string]any)
+	stack, _ := rich[StackKey].([]any)
+	if rich["msg"] != "load: base\ncode 42" || rich["type"] != "*fmt.wrapError" ||
+		cause["type"] != "*errors.joinError" || len(join) != 2 ||
+		fmt.Sprint(branch["value"]) != "map[code:42]" || len(stack) == 0 {
+		t.Errorf("bad rich error: %v", rich)
+	}
+
+	var buf bytes.Buffer
+	log := NewWithWriter(Conf{Level: "info", Pipe: "null", Format: "tint", ColorOff: true}, &buf)
+	log.Error("rich", Err(Errf("open %q: %w", "x.conf", base)))
+	out := buf.String()
+	for _, s := range []string{
+		`err="open \"x.conf\": base" err.type=*fmt.wrapError err.stack="xlog.TestRichErr xlog_test:`,
+		" err.cause.msg=base err.cause.type=*errors.errorString",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("no %q in tinted record: %q", s, out)
+		}
+	}
+}
+
+func TestStackLevel(t *testing.T) {
+	conf := Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true,
+		StackLevel: "crit", StackAll: true}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		log.Error("no stack")
+		log.Crit("stack")
+		log.Emerg("all")
+	})
+	if len(recs) != 3 {
+		t.Fatalf("bad records number: %d", len(recs))
+	}
+	for _, rec := range recs {
+		res, err := ChecksumVerify(true, rec)
+		if err != nil || res.Sum != res.LogSum {
+			t.Errorf("bad checksum: %v (%v)", rec, err)
+		}
+	}
+	if _, ok := recs[0][StackKey]; ok {
+		t.Errorf("unexpected stack: %v", recs[0])
+	}
+	stack, _ := recs[1][StackKey].([]any)
+	frame, _ := stack[0].(map[string]any)
+	if len(stack) < 2 || frame["function"] != "github.com/azorg/xlog.TestStackLevel.func1" ||
+		frame["file"] != "xlog_test" || recs[1][GoroutinesKey] != nil {
+		t.Errorf("bad stack: %v", recs[1])
+	}
+	if g, _ := recs[2][GoroutinesKey].(string); !strings.HasPrefix(g, "goroutine ") {
+		t.Errorf("bad goroutines dump: %v", recs[2])
+	}
+
+	// Неизвестный уровень не добавляет стек ко всем записям
+	recs = jsonRecords(t, Conf{Level: "info", StackLevel: "crtical"}, func(log *Logger) {
+		log.Info("no stack")
+	})
+	if _, ok := recs[0][StackKey]; ok {
+		t.Errorf("stack for unknown stack level: %v", recs[0])
+	}
+
+	// Стек и дамп стеков горутин в пределах общего размера записи
+	conf.Limits = &Limits{Size: 400}
+	recs = jsonRecords(t, conf, func(log *Logger) { log.Emerg("all", "a", 1) })
+	stack, _ = recs[0][StackKey].([]any)
+	js, _ := json.Marshal(stack)
+	g, _ := recs[0][GoroutinesKey].(string)
+	if len(stack) == 0 || len(js)+len(g) > 400 || !strings.HasSuffix(g, " bytes)") {
+		t.Errorf("bad size limited stack: %v", recs[0])
+	}
+	if res, err := ChecksumVerify(true, recs[0]); err != nil || res.Sum != res.LogSum {
+		t.Errorf("bad checksum: %v (%v)", recs[0], err)
+	}
+
+	var buf bytes.Buffer
+	conf = Conf{Level: "info", Pipe: "null", Format: "tint", ColorOff: true,
+		StackLevel: "error", SrcExt: true}
+	NewWithWriter(conf, &buf).Error("stack")
+	if out := buf.String(); !strings.Contains(out,
+		` stack="xlog.TestStackLevel xlog_test.go:`) {
+		t.Errorf("bad tinted stack: %q", out)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	if _, err := ParseLimits("message=10,bad=1"); err == nil {
+		t.Error("bad limits accepted")
+	}
+	limits, err := ParseLimits("msg=8, value=6, attrs=4, depth=2, size=200")
+	if err != nil || limits.String() != "message=8,value=6,attrs=4,depth=2,size=200" {
+		t.Fatalf("bad limits: %v (%v)", limits, err)
+	}
+	type node struct{ Next *node }
+	deep := &node{&node{&node{}}}
+	log := func(log *Logger) {
+		log.Info("message too long", "s", "привет мир", "b", []byte("0123456789"),
+			slog.Group("g", slog.Group("a", slog.Group("b", "c", 1))), "deep", deep, "skip", 1)
+		log.Info("short", "s", strings.Repeat("x", 500))
+		log.Info("ok", "s", "short")
+	}
+
+	conf := Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true, Limits: limits}
+	recs := jsonRecords(t, conf, log)
+	for _, rec := range recs {
+		res, err := ChecksumVerify(true, rec)
+		if err != nil || res.Sum != res.LogSum {
+			t.Errorf("bad checksum: %v (%v)", rec, err)
+		}
+	}
+	g, _ := recs[0]["g"].(map[string]any)
+	ga, _ := g["a"].(map[string]any)
+	if len(recs) != 3 || recs[0][MsgKey] != "message …(+8 bytes)" ||
+		recs[0]["s"] != "при…(+13 bytes)" || recs[0]["b"] != "012345…(+4 bytes)" ||
+		ga["b"] != TruncDepth ||
+		recs[0]["deep"] != TruncDepth || recs[0][TruncKey] != float64(1) ||
+		recs[1]["s"] != "xxxxxx…(+494 bytes)" || recs[2]["s"] != "short" {
+		t.Errorf("bad truncated records: %v", recs)
+	}
+	if limits.Truncated() != 2 {
+		t.Errorf("bad truncated records counter: %d", limits.Truncated())
+	}
+
+	// Ограничение общего размера записи
+	small := &Limits{Size: 40}
+	recs = jsonRecords(t, Conf{Level: "info", Limits: small}, func(log *Logger) {
+		log.Info("size", "a", 1, "s", strings.Repeat("y", 100), "b", 2)
+	})
+	if s, _ := recs[0]["s"].(string); recs[0]["a"] != float64(1) ||
+		!strings.HasSuffix(s, " bytes)") || recs[0][TruncKey] != float64(1) {
+		t.Errorf("bad size limited record: %v", recs[0])
+	}
+
+	// Токены и зашифрованные значения не укорачиваются, а отбрасываются
+	p, _ := NewPseudonymizer("p1", []byte("key"), "email")
+	key, _ := GenerateFieldKey("k1", FieldKeyAES)
+	enc, _ := NewFieldEncryptor(key, "inn")
+	conf = Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true,
+		Pseudonymizer: p, FieldEncryptor: enc, Limits: &Limits{Value: 16}}
+	recs = jsonRecords(t, conf, func(log *Logger) {
+		log.Info("opaque", "email", "bob@example.com", slog.Group("user", "inn", "7701", "id", 1),
+			"s", strings.Repeat("z", 20), "pii", "pii:not a token at all")
+	})
+	user, _ := recs[0]["user"].(map[string]any)
+	if _, ok := recs[0]["email"]; ok || user["inn"] != nil || user["id"] != float64(1) ||
+		recs[0]["s"] != "zzzzzzzzzzzzzzzz…(+4 bytes)" ||
+		recs[0]["pii"] != "pii:not a token …(+6 bytes)" || recs[0][TruncKey] != float64(2) {
+		t.Errorf("bad limited opaque values: %v", recs[0])
+	}
+	if res, err := ChecksumVerify(true, recs[0]); err != nil || res.Sum != res.LogSum {
+		t.Errorf("bad checksum: %v (%v)", recs[0], err)
+	}
+
+	for _, format := range []string{"logfmt", "tint"} {
+		var buf bytes.Buffer
+		conf := Conf{Level: "info", Pipe: "null", Format: format, ColorOff: true, Limits: limits}
+		log(NewWithWriter(conf, &buf))
+		if out := buf.String(); !strings.Contains(out, "…(+494 bytes)") ||
+			!strings.Contains(out, "logTrunc=1") || !strings.Contains(out, "deep=…(depth)") {
+			t.Errorf("bad %s truncated records: %q", format, out)
+		}
+	}
+}
+
+func TestMiddlewareRegistry(t *testing.T) {
+	err := RegisterMiddleware("upper", func(opts map[string]any) (Middleware, error) {
+		return NewMiddleware(func(ctx context.Context, r slog.Record, next HandleFunc) error {
+			r.Message = strings.ToUpper(r.Message)
+			return next(ctx, r)
+		}), nil
+	})
+	if err != nil || RegisterMiddleware("bad name", nil) == nil {
+		t.Fatalf("bad RegisterMiddleware(): %v", err)
+	}
+	names := strings.Join(RegisteredMiddlewares(), ",")
+	if !strings.Contains(names, "redact") || !strings.Contains(names, "upper") {
+		t.Errorf("bad registered middlewares: %s", names)
+	}
+
+	confs, err := ParseMiddlewares(" upper; limits:message=5 ; fields:app=demo,ver=1")
+	if err != nil || len(confs) != 3 || confs[1].Opts["message"] != "5" {
+		t.Fatalf("bad middlewares spec: %v (%v)", confs, err)
+	}
+	if js, _ := ParseMiddlewares(`[{"name":"limits","opts":{"message":5}}]`); len(js) != 1 {
+		t.Errorf("bad JSON middlewares spec: %v", js)
+	}
+	if _, err = NewMiddlewares([]MiddlewareConf{{Name: "nope"}}); !errors.Is(err, ErrBadMiddleware) {
+		t.Errorf("unknown middleware accepted: %v", err)
+	}
+	_, err = NewMiddlewareByName("sampler", map[string]any{"first": "x"})
+	if _, err2 := NewMiddlewareByName("damper", map[string]any{"typo": 1}); err == nil || err2 == nil {
+		t.Errorf("bad middleware options accepted: %v %v", err, err2)
+	}
+
+	conf := Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true, Middlewares: confs}
+	recs := jsonRecords(t, conf, func(log *Logger) {
+		log.Named("reg").Info("hello world")
+	})
+	if len(recs) != 1 || recs[0][MsgKey] != "HELLO…(+6 bytes)" ||
+		recs[0]["app"] != "demo" || recs[0][LoggerKey] != "reg" {
+		t.Fatalf("bad record: %v", recs)
+	}
+	if res, err := ChecksumVerify(true, recs[0]); err != nil || res.Sum != res.LogSum {
+		t.Errorf("bad checksum: %v (%v)", recs[0], err)
+	}
+
+	// redact/pseudo/fieldenc задают опции IdHandler (обрабатываются и With)
+	key, _ := GenerateFieldKey("k1", FieldKeyAES)
+	confs = []MiddlewareConf{
+		{Name: "pseudo", Opts: map[string]any{"key": "p1:0011", "keys": "email"}},
+		{Name: "fieldenc", Opts: map[string]any{"key": key.String(), "keys": "inn"}},
+		{Name: "Redact", Opts: map[string]any{"keys": "pin"}},
+	}
+	conf.Middlewares = confs
+	recs = jsonRecords(t, conf, func(log *Logger) {
+		log.With("email", "bob@example.com", "inn", "7701", "pin", "1234").Info("with")
+	})
+	inn, _ := recs[0]["inn"].(string)
+	if s, err := NewFieldDecryptor(key).Decrypt(inn); err != nil || s != "7701" ||
+		recs[0]["email"] != PseudoToken("p1", []byte{0x00, 0x11}, "bob@example.com") ||
+		recs[0]["pin"] != RedactMaskString {
+		t.Errorf("bad With attributes: %v (%v)", recs[0], err)
+	}
+	if res, err := ChecksumVerify(true, recs[0]); err != nil || res.Sum != res.LogSum {
+		t.Errorf("bad checksum: %v (%v)", recs[0], err)
+	}
+
+	// Опция, заданная явно, не заменяется
+	rd, _ := NewRedactor(RedactRule{Key: "pin", Strategy: RedactDrop})
+	conf.Redactor = rd
+	if c, _ := confMiddlewares(conf); c.Redactor != rd || c.Pseudonymizer == nil {
+		t.Errorf("bad configured IdHandler options: %+v", c)
+	}
+}
+
+// benchIdHandler выводит b.N записей в io.Discard из n горутин
+func benchIdHandler(b *testing.B, conf Conf, n int) {
+	conf.Pipe = "null"
+	conf.Format = "json"
+	log := NewWithWriter(conf, io.Discard).With("pid", 1).WithGroup("req")
+	b.ReportAllocs()
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for g := 0; g < n; g++ {
+		wg.Add(1)
+		go func(cnt int) {
+			defer wg.Done()
+			for i := 0; i < cnt; i++ {
+				log.Info("bench", "i", i)
+			}
+		}((b.N + g) / n)
+	}
+	wg.Wait()
+}
+
+func BenchmarkIdHandler(b *testing.B) {
+	confs := []struct {
+		name string
+		conf Conf
+	}{
+		{"id", Conf{Level: "info", IdOn: true}},
+		{"sum", Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true}},
+		{"chain", Conf{Level: "info", IdOn: true, SumOn: true, SumFull: true, SumChain: true}},
+	}
+	for _, c := range confs {
+		for _, n := range []int{1, 8, 64} {
+			b.Run(fmt.Sprintf("%s-%d", c.name, n), func(b *testing.B) {
+				benchIdHandler(b, c.conf, n)
+			})
+		}
+	}
+}
+
+// Накладные расходы LOG_GOID=1
+func BenchmarkGoId(b *testing.B) {
+	for _, goId := range []bool{false, true} {
+		b.Run(fmt.Sprintf("goid=%v", goId), func(b *testing.B) {
+			benchIdHandler(b, Conf{Level: "info", GoId: goId}, 1)
+		})
+	}
+	b.Run("fast", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			GoId()
+		}
+	})
+	b.Run("stack", func(b *testing.B) { // резервный способ (runtime.Stack)
+		for i := 0; i < b.N; i++ {
+			goIdSlow()
+		}
+	})
+}
+
+// Стоимость отключённых вызовов при наличии переопределений уровней
+func BenchmarkLevelSpec(b *testing.B) {
+	for _, spec := range []string{"info", "info,github.com/acme/db=debug", "info,github.com/azorg/xlog=warn"} {
+		b.Run(spec, func(b *testing.B) {
+			log := NewWithWriter(Conf{Level: spec, Pipe: "null", Format: "json"}, io.Discard)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				log.Debug("disabled", "i", i) // отсекается в Enabled() или по PC
+			}
+		})
+	}
+}
+
+func BenchmarkFilter(b *testing.B) {
+	for _, filter := range []string{"", `level>=info && i>=0`, `user=="42" || msg~"^bench"`} {
+		b.Run(filter, func(b *testing.B) {
+			benchIdHandler(b, Conf{Level: "info", Filter: filter}, 1)
+		})
+	}
+}
+
+func BenchmarkMetrics(b *testing.B) {
+	for _, n := range []int{1, 8} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchIdHandler(b, Conf{Level: "info", Metrics: NewMetrics()}, n)
+		})
+	}
+}
+
 // EOF: "xlog_test.go"